@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/pflag"
+	"github.com/tillitis/tkey-verification/internal/emulator"
+	"github.com/tillitis/tkey-verification/internal/util"
+)
+
+const progname = "tkey-emulator"
+
+var version string
+var le = log.New(os.Stderr, "", 0)
+
+func main() {
+	var udsHex, udiHex, firmwareFile, link string
+	var resetOnClose, verbose, helpOnly, versionOnly bool
+
+	pflag.CommandLine.SetOutput(os.Stderr)
+	pflag.CommandLine.SortFlags = false
+	pflag.StringVar(&udsHex, "uds", "",
+		"Unique Device Secret as 32 bytes in `HEX`. If not given, a random UDS is used.")
+	pflag.StringVar(&udiHex, "udi", "0133708200000001",
+		"Unique Device Identifier as 8 bytes Big Endian `HEX`.")
+	pflag.StringVar(&firmwareFile, "firmware", "",
+		"`PATH` to the firmware image the signer computes the firmware digest over.")
+	pflag.StringVar(&link, "link", "",
+		"Make a symbolic link at `PATH` to the port, to use a fixed --port.")
+	pflag.BoolVar(&resetOnClose, "reset-on-close", false,
+		"Go back to firmware mode when the port is closed, as if the TKey was plugged in again.")
+	pflag.BoolVar(&verbose, "verbose", false, "Output every command.")
+	pflag.BoolVar(&helpOnly, "help", false, "Output this help")
+	pflag.BoolVar(&versionOnly, "version", false, "Output version information")
+	pflag.Usage = usage
+	pflag.Parse()
+
+	if helpOnly {
+		pflag.Usage()
+		os.Exit(0)
+	}
+
+	if versionOnly {
+		fmt.Printf("%s %s\n", progname, util.Version(version))
+		os.Exit(0)
+	}
+
+	if pflag.NArg() != 0 {
+		le.Printf("Unexpected argument\n\n")
+		pflag.Usage()
+		os.Exit(2)
+	}
+
+	conf := emulator.Config{
+		Verbose: verbose,
+	}
+
+	var err error
+
+	if udsHex == "" {
+		if _, err = rand.Read(conf.UDS[:]); err != nil {
+			le.Printf("rand.Read failed: %v\n", err)
+			os.Exit(1)
+		}
+	} else if err = util.DecodeHex(conf.UDS[:], udsHex); err != nil {
+		le.Printf("Couldn't decode UDS, expected 32 bytes in hex\n")
+		os.Exit(2)
+	}
+
+	if conf.UDI, err = hex.DecodeString(udiHex); err != nil {
+		le.Printf("Couldn't decode UDI: %v\n", err)
+		os.Exit(2)
+	}
+
+	if firmwareFile != "" {
+		if conf.Firmware, err = os.ReadFile(firmwareFile); err != nil {
+			le.Printf("Couldn't read firmware: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	emu, err := emulator.New(conf)
+	if err != nil {
+		le.Printf("%v\n", err)
+		os.Exit(2)
+	}
+
+	p, err := emu.OpenPTY()
+	if err != nil {
+		le.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	p.ResetOnClose = resetOnClose
+
+	exit := func(code int) {
+		p.Close()
+		if link != "" {
+			os.Remove(link)
+		}
+		os.Exit(code)
+	}
+
+	if link != "" {
+		if err = os.Symlink(p.Path(), link); err != nil {
+			le.Printf("Couldn't link port: %v\n", err)
+			exit(1)
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				le.Printf("Reset to firmware mode\n")
+				emu.Reset()
+
+				continue
+			}
+
+			exit(0)
+		}
+	}()
+
+	// The port on stdout, for scripts.
+	fmt.Printf("%s\n", p.Path())
+	if verbose {
+		le.Printf("Emulating TKey with UDI %s\n", udiHex)
+	}
+
+	if err = p.Serve(); err != nil {
+		le.Printf("%v\n", err)
+		exit(1)
+	}
+
+	exit(0)
+}
+
+func usage() {
+	desc := fmt.Sprintf(`Usage: %s [flags...]
+
+Emulates a TKey on a pseudo terminal, for testing without hardware.
+The path of the port is output on stdout. Use it with --port.
+
+The emulated TKey runs the firmware until an app is loaded. Any app
+then behaves like the signer, with a key derived from the UDS and the
+app as on a real TKey. Send SIGHUP to go back to firmware mode.`, progname)
+
+	le.Printf("%s\n\nFlags:\n%s\n", desc, pflag.CommandLine.FlagUsagesWrapped(86))
+}
@@ -4,22 +4,15 @@
 package main
 
 import (
-	"context"
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"path"
 
 	"github.com/spf13/pflag"
 	"github.com/tillitis/tkey-verification/internal/sigsum"
 	"github.com/tillitis/tkey-verification/internal/submission"
 	"github.com/tillitis/tkey-verification/internal/util"
-	"github.com/tillitis/tkey-verification/internal/verification"
-	"sigsum.org/sigsum-go/pkg/proof"
-	"sigsum.org/sigsum-go/pkg/requests"
-	"sigsum.org/sigsum-go/pkg/submit"
 )
 
 const progname = "tkey-sigsum-submit"
@@ -94,106 +87,22 @@ type SigsumSubmit struct {
 	HTTPClient *http.Client
 }
 
-func (s SigsumSubmit) processSubmissions() error {
-	verFileCount, err := os.ReadDir(s.verDir)
-	if err != nil {
-		return fmt.Errorf("failed to read directory '%s': %w", s.verDir, err)
-	}
-	if len(verFileCount) != 0 {
-		return errors.New("verification directory must be empty")
-	}
-
-	doneSubmFileCount, err := os.ReadDir(s.doneSubmDir)
-	if err != nil {
-		return fmt.Errorf("failed to read directory '%s': %w", s.doneSubmDir, err)
-	}
-	if len(doneSubmFileCount) != 0 {
-		return errors.New("processed submission directory must be empty")
-	}
-
-	entries, err := os.ReadDir(s.submDir)
-	if err != nil {
-		return fmt.Errorf("failed to read directory '%s': %w", s.submDir, err)
-	}
-
-	for _, entry := range entries {
-		var submission submission.Submission
-		err = submission.FromFile(path.Join(s.submDir, entry.Name()))
-		if err != nil {
-			return fmt.Errorf("invalid submission file: %w", err)
-		}
-	}
-
-	for _, entry := range entries {
-		err = s.processSubmissionFile(entry.Name())
-		if err != nil {
-			return fmt.Errorf("failed to process submission file: %w", err)
-		}
+func (s SigsumSubmit) submitter() submission.Submitter {
+	return submission.Submitter{
+		SubmDir:     s.submDir,
+		DoneSubmDir: s.doneSubmDir,
+		VerDir:      s.verDir,
+		Log:         s.log,
+		HTTPClient:  s.HTTPClient,
 	}
-
-	return nil
 }
 
-func (s SigsumSubmit) processSubmissionFile(fn string) error {
-	submissionPath := path.Join(s.submDir, fn)
-	doneSubmissionPath := path.Join(s.doneSubmDir, fn)
-	verificationPath := path.Join(s.verDir, fn)
-
-	var submission submission.Submission
-	err := submission.FromFile(submissionPath)
-	if err != nil {
-		return fmt.Errorf("failed to open submission file: %w", err)
-	}
-
-	submitConfig := submit.Config{
-		Policy:     s.log.Policy,
-		HTTPClient: s.HTTPClient,
-	}
-
-	proof, err := logDevice(submission.Request, submitConfig)
-	if err != nil {
-		return fmt.Errorf("failed to log device: %w", err)
-	}
-
-	verification := verification.Verification{
-		Type:      verification.VerProof,
-		Timestamp: submission.Timestamp,
-		AppTag:    submission.AppTag,
-		AppHash:   submission.AppHash,
-		Proof:     proof,
-	}
-
-	_, err = verification.VerifyProofDigest(submission.Request.Message, s.log)
-	if err != nil {
-		return fmt.Errorf("got invalid proof: %w", err)
-	}
-
-	err = verification.ToFile(verificationPath)
-	if err != nil {
-		return fmt.Errorf("failed to store verification file: %w", err)
-	}
-
-	err = os.Rename(submissionPath, doneSubmissionPath)
-	if err != nil {
-		return fmt.Errorf("failed to move verification file: %w", err)
-	}
-
-	return nil
+func (s SigsumSubmit) processSubmissions() error {
+	return s.submitter().ProcessSubmissions()
 }
 
-func logDevice(req requests.Leaf, submitConfig submit.Config) (proof.SigsumProof, error) {
-	ctx := context.Background()
-	reqs := []requests.Leaf{req}
-
-	proofs, err := submit.SubmitLeafRequests(ctx, &submitConfig, reqs)
-	if err != nil {
-		return proof.SigsumProof{}, fmt.Errorf("failed to submit sigsum log request: %w", err)
-	}
-	if len(proofs) != 1 {
-		return proof.SigsumProof{}, fmt.Errorf("expected one proof from log, got %d", len(proofs))
-	}
-
-	return proofs[0], nil
+func (s SigsumSubmit) processSubmissionFile(fn string) error {
+	return s.submitter().ProcessSubmissionFile(fn)
 }
 
 func usage() {
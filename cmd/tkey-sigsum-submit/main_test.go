@@ -123,6 +123,26 @@ func Test_processSubmissionDir(t *testing.T) {
 			postVerFiles:      map[string]string{},
 			errString:         "invalid submission file",
 		},
+		{
+			name:              "One valid submission file with UDI generates one version 2 verification file",
+			preSubmFiles:      map[string]string{"0001020304050607-subm-valid-udi": "0001020304050607"},
+			preDoneSubmFiles:  map[string]string{},
+			preVerFiles:       map[string]string{},
+			postSubmFiles:     map[string]string{},
+			postDoneSubmFiles: map[string]string{"0001020304050607-subm-valid-udi": "0001020304050607"},
+			postVerFiles:      map[string]string{"0001020304050607-ver-valid-v2": "0001020304050607"},
+			errString:         "",
+		},
+		{
+			name:              "Should abort if a submission file is not named after its UDI",
+			preSubmFiles:      map[string]string{"0001020304050607-subm-valid-udi": "0001020304050608"},
+			preDoneSubmFiles:  map[string]string{},
+			preVerFiles:       map[string]string{},
+			postSubmFiles:     map[string]string{"0001020304050607-subm-valid-udi": "0001020304050608"},
+			postDoneSubmFiles: map[string]string{},
+			postVerFiles:      map[string]string{},
+			errString:         "invalid submission file: submission for UDI 0001020304050607 is named 0001020304050608",
+		},
 	}
 
 	for _, tt := range tests {
@@ -23,19 +23,43 @@ import (
 const MessageLen = tkey.UDISize + sha512.Size + ed25519.PublicKeySize
 
 type API struct {
-	mu           sync.Mutex
-	vendorPubKey []byte
-	tk           tkey.TKey
+	mu      *sync.Mutex
+	keys    *SubmitKeys
+	dir     string // Where submissions are written
+	station Station
 }
 
-func NewAPI(vendorPubKey []byte, tk tkey.TKey) *API {
+// Signer signs with the Sigsum submit key, like a TKey running the
+// signer device app.
+type Signer interface {
+	GetPubkey() ([]byte, error)
+	Sign(message []byte) ([]byte, error)
+}
+
+// Station is the provisioning station on the other end of a
+// connection, from its TLS client certificate.
+type Station struct {
+	Name     string // Common name
+	CertHash string // SHA-256 of the certificate, in hex
+}
+
+func NewAPI(keys *SubmitKeys, dir string) *API {
 	return &API{
-		mu:           sync.Mutex{},
-		vendorPubKey: vendorPubKey,
-		tk:           tk,
+		mu:   &sync.Mutex{},
+		keys: keys,
+		dir:  dir,
 	}
 }
 
+// ForStation returns an API for a connection from station, sharing
+// the signer and lock with api.
+func (api *API) ForStation(station Station) *API {
+	a := *api
+	a.station = station
+
+	return &a
+}
+
 func (*API) Ping(_ *struct{}, _ *struct{}) error {
 	le.Printf("Got Ping\n")
 
@@ -81,7 +105,20 @@ func (api *API) Sign(args *Args, _ *struct{}) error {
 		return ErrWrongLen
 	}
 
-	signer := TkeySigsumSigner{api.tk}
+	now := time.Now().UTC()
+
+	key, err := api.keys.At(now)
+	if err != nil {
+		le.Printf("Refusing to sign: %v\n", err)
+
+		return ErrKeyNotValid
+	}
+
+	if warning := api.keys.Expiring(now); warning != "" {
+		le.Printf("Warning: %s\n", warning)
+	}
+
+	signer := TkeySigsumSigner{key.Signer}
 	sigsumMsg := sigsumcrypto.HashBytes(args.Message)
 	signature, err := types.SignLeafMessage(signer, sigsumMsg[:])
 	if err != nil {
@@ -95,7 +132,7 @@ func (api *API) Sign(args *Args, _ *struct{}) error {
 	}
 
 	// File named after the UDIBE in hex
-	fn := fmt.Sprintf("%s/%s", signaturesDir, hex.EncodeToString(args.UDIBE))
+	fn := fmt.Sprintf("%s/%s", api.dir, hex.EncodeToString(args.UDIBE))
 	if _, err = os.Stat(fn); err == nil || !errors.Is(err, os.ErrNotExist) {
 		le.Printf("Signature file %s already exists\n", fn)
 
@@ -103,10 +140,14 @@ func (api *API) Sign(args *Args, _ *struct{}) error {
 	}
 
 	subm := submission.Submission{
-		Timestamp: time.Now().UTC(),
+		UDI:       args.UDIBE,
+		Timestamp: now,
 		AppTag:    args.AppTag,
 		AppHash:   args.AppHash,
 		Request:   leafReq,
+
+		Station:     api.station.Name,
+		StationCert: api.station.CertHash,
 	}
 
 	err = subm.ToFile(fn)
@@ -122,13 +163,12 @@ func (api *API) Sign(args *Args, _ *struct{}) error {
 }
 
 type TkeySigsumSigner struct {
-	tk tkey.TKey
+	signer Signer
 }
 
 func (s TkeySigsumSigner) Public() sigsumcrypto.PublicKey {
-	pubkey, err := s.tk.GetPubkey()
+	pubkey, err := s.signer.GetPubkey()
 	if err != nil {
-		s.tk.Close()
 		le.Fatal("GetPubKey failed: %w", err)
 	}
 	if len(pubkey) != sigsumcrypto.PublicKeySize {
@@ -141,7 +181,7 @@ func (s TkeySigsumSigner) Public() sigsumcrypto.PublicKey {
 }
 
 func (s TkeySigsumSigner) Sign(msg []byte) (sigsumcrypto.Signature, error) {
-	sig, err := s.tk.Sign(msg)
+	sig, err := s.signer.Sign(msg)
 	if err != nil {
 		return sigsumcrypto.Signature{}, fmt.Errorf("%w", err)
 	}
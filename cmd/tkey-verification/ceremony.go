@@ -0,0 +1,438 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/appbins"
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+	"github.com/tillitis/tkey-verification/internal/ssh"
+	"github.com/tillitis/tkey-verification/internal/tkey"
+	"github.com/tillitis/tkey-verification/internal/util"
+)
+
+// The SSH signature namespace of key ceremony records.
+const ceremonyNamespace = "tkey-verification-key-ceremony"
+
+const ceremonyVersion = 1
+
+// CeremonyKey describes a Sigsum submit key in a key ceremony.
+type CeremonyKey struct {
+	Name      string `json:"name"`
+	PubKey    string `json:"pubkey"`        // OpenSSH format
+	UDI       string `json:"udi,omitempty"` // TKey with the key in hex, if known
+	AppTag    string `json:"app_tag"`
+	AppHash   string `json:"app_hash"`
+	ValidFrom string `json:"valid_from"`
+	ValidTo   string `json:"valid_to"`
+}
+
+// Ceremony is the record of introducing a new Sigsum submit key. It
+// is signed with SSH signatures by the new key, and by the old, active
+// key if it is available.
+type Ceremony struct {
+	Version    int          `json:"version"`
+	Time       string       `json:"time"`
+	Tool       string       `json:"tool"` // Name and version of the program
+	NewKey     CeremonyKey  `json:"new_key"`
+	OldKey     *CeremonyKey `json:"old_key,omitempty"` // The active submit key, if any
+	SigsumConf string       `json:"sigsum_conf"`       // Entry for the new key in SigsumConf
+}
+
+func newCeremonyKey(key sigsum.PubKey, udi string) CeremonyKey {
+	return CeremonyKey{
+		Name:      key.Name,
+		PubKey:    ssh.NewKey(key.Key, key.Name).String(),
+		UDI:       udi,
+		AppTag:    key.Tag,
+		AppHash:   hex.EncodeToString(key.AppHash[:]),
+		ValidFrom: key.Start.Format(time.RFC3339),
+		ValidTo:   key.End.Format(time.RFC3339),
+	}
+}
+
+// tkeySigner makes a TKey running the signer a crypto.Signer, to
+// make SSH signatures with it.
+type tkeySigner struct {
+	pub  ed25519.PublicKey
+	sign func(message []byte) ([]byte, error)
+}
+
+func (s tkeySigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s tkeySigner) Sign(_ io.Reader, message []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return s.sign(message)
+}
+
+// signCeremony returns an SSH signature of the ceremony record in
+// msg, made with sign by the key pub.
+func signCeremony(msg []byte, pub []byte, sign func([]byte) ([]byte, error)) ([]byte, error) {
+	signer, err := ssh.NewSigner(tkeySigner{pub: pub, sign: sign})
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	sig, err := ssh.Sign(signer, ceremonyNamespace, msg)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return sig, nil
+}
+
+// ceremonyFiles are the files of the transcript of the ceremony for
+// the key name in dir.
+type ceremonyFiles struct {
+	Record, NewSig, OldSig, AllowedSigners, SigsumConf string
+}
+
+func newCeremonyFiles(dir string, name string) ceremonyFiles {
+	record := filepath.Join(dir, name+".ceremony.json")
+
+	return ceremonyFiles{
+		Record:         record,
+		NewSig:         record + ".new.sig",
+		OldSig:         record + ".old.sig",
+		AllowedSigners: filepath.Join(dir, name+".allowed_signers"),
+		SigsumConf:     filepath.Join(dir, name+".sigsum-conf"),
+	}
+}
+
+// writeCeremony writes the transcript of the ceremony c: the record
+// msg, its signatures, the allowed signers for ssh-keygen -Y verify,
+// and the Sigsum configuration entry. oldSig is nil if the old key
+// didn't sign.
+func writeCeremony(files ceremonyFiles, c Ceremony, msg []byte, newSig []byte, oldSig []byte) error {
+	allowed := fmt.Sprintf("%s namespaces=%q %s\n", c.NewKey.Name, ceremonyNamespace, c.NewKey.PubKey)
+	if c.OldKey != nil && oldSig != nil {
+		allowed += fmt.Sprintf("%s namespaces=%q %s\n", c.OldKey.Name, ceremonyNamespace, c.OldKey.PubKey)
+	}
+
+	write := []struct {
+		fn      string
+		content []byte
+	}{
+		{files.Record, msg},
+		{files.NewSig, newSig},
+		{files.OldSig, oldSig},
+		{files.AllowedSigners, []byte(allowed)},
+		{files.SigsumConf, []byte(c.SigsumConf)},
+	}
+
+	// Don't leave the old key's signature from an earlier ceremony
+	// in the same directory, checkCeremony would check it
+	if oldSig == nil {
+		if err := os.Remove(files.OldSig); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	for _, w := range write {
+		if w.content == nil {
+			continue
+		}
+
+		if err := os.WriteFile(w.fn, w.content, 0o644); err != nil { // #nosec G306
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkCeremony checks the transcript in files: that the record is
+// signed by the new key in it, and by the old key if it has a
+// signature. It returns the record.
+func checkCeremony(files ceremonyFiles) (Ceremony, error) {
+	var c Ceremony
+
+	msg, err := os.ReadFile(files.Record)
+	if err != nil {
+		return c, fmt.Errorf("%w", err)
+	}
+
+	if err = json.Unmarshal(msg, &c); err != nil {
+		return c, fmt.Errorf("couldn't unmarshal JSON: %w", err)
+	}
+
+	if c.Version != ceremonyVersion {
+		return c, fmt.Errorf("unsupported ceremony record version %d", c.Version)
+	}
+
+	check := func(key CeremonyKey, sigFn string) error {
+		pub, err := ssh.ParseKey(key.PubKey)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key.Name, err)
+		}
+
+		sig, err := os.ReadFile(sigFn)
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		if _, err = ssh.Verify(pub, ceremonyNamespace, msg, sig); err != nil {
+			return fmt.Errorf("key %s: %w", key.Name, err)
+		}
+
+		return nil
+	}
+
+	if err = check(c.NewKey, files.NewSig); err != nil {
+		return c, err
+	}
+
+	if c.OldKey != nil {
+		if _, err = os.Stat(files.OldSig); err == nil {
+			if err = check(*c.OldKey, files.OldSig); err != nil {
+				return c, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// keyCeremony walks the operator through introducing a new Sigsum
+// submit key made by the device app in binPath on a vendor TKey. The
+// record of the ceremony is signed by the new key and, if the
+// operator has it, by the active key in the serve-signer
+// configuration in configFile. The transcript is written to outDir.
+func keyCeremony(binPath string, configFile string, outDir string, opts PubkeyOpts, dev Device, verbose bool) {
+	opts.Format = "sigsum-conf"
+
+	start, end, err := checkPubkeyOpts(opts)
+	if err != nil {
+		le.Printf("%v\n", err)
+		os.Exit(2)
+	}
+
+	content, err := os.ReadFile(binPath)
+	if err != nil {
+		le.Printf("ReadFile: %v\n", err)
+		os.Exit(1)
+	}
+
+	appBin := appbins.AppBin{
+		Tag:  strings.TrimSuffix(filepath.Base(binPath), ".bin"),
+		Bin:  content,
+		Path: binPath,
+	}
+
+	var log sigsum.Log
+	if err = log.FromEmbedded(); err != nil {
+		le.Printf("Found no usable Sigsum configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if strings.ContainsAny(opts.Name, "/\\ \t") {
+		le.Printf("Use a key name without spaces and slashes, it names the transcript files\n")
+		os.Exit(2)
+	}
+
+	for _, key := range log.Keys {
+		if key.Name == opts.Name {
+			le.Printf("There already is a submit key named %s\n", opts.Name)
+			os.Exit(1)
+		}
+	}
+
+	oldKey, err := activeSubmitKey(configFile, log)
+	if err != nil {
+		le.Printf("No active submit key, only the new key signs: %v\n", err)
+	} else {
+		le.Printf("Active submit key: %s", oldKey.String())
+	}
+
+	files := newCeremonyFiles(outDir, opts.Name)
+	in := bufio.NewReader(os.Stdin)
+
+	le.Printf("\nStep 1: The new submit key %s, made by %s.\n", opts.Name, appBin.String())
+	if _, err = prompt(in, "Insert the vendor TKey for the new key and press Enter: "); err != nil {
+		le.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	c := Ceremony{
+		Version: ceremonyVersion,
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Tool:    fmt.Sprintf("%s %s", progname, util.Version(version)),
+	}
+
+	var msg, newSig []byte
+
+	err = withSigner(dev, verbose, appBin.Bin, func(tk *tkey.TKey, pubKey []byte) error {
+		var err error
+
+		if _, ok := log.Keys[[ed25519.PublicKeySize]byte(pubKey)]; ok {
+			return fmt.Errorf("public key %x is already a submit key", pubKey)
+		}
+
+		le.Printf("TKey UDI: %s\n", tk.Udi.String())
+
+		if c.SigsumConf, err = pubkeyEntry(opts, start, end, pubKey, appBin, tk.Udi.String()); err != nil {
+			return err
+		}
+
+		newKey := sigsum.PubKey{
+			Name:    opts.Name,
+			Tag:     appBin.Tag,
+			AppHash: appBin.Hash(),
+			Start:   start,
+			End:     end,
+		}
+		copy(newKey.Key[:], pubKey)
+
+		c.NewKey = newCeremonyKey(newKey, hex.EncodeToString(tk.Udi.Bytes))
+		if oldKey != nil {
+			old := newCeremonyKey(*oldKey, "")
+			c.OldKey = &old
+		}
+
+		if msg, err = json.MarshalIndent(c, "", "  "); err != nil {
+			return fmt.Errorf("couldn't marshal JSON: %w", err)
+		}
+		msg = append(msg, '\n')
+
+		newSig, err = signCeremony(msg, pubKey, tk.Sign)
+
+		return err
+	})
+	if err != nil {
+		le.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	le.Printf("The new key signed the ceremony record.\n")
+
+	var oldSig []byte
+
+	if oldKey != nil {
+		le.Printf("\nStep 2: The active submit key %s, made by %s.\n", oldKey.Name, oldKey.AppBin.String())
+
+		answer, err := prompt(in, "Remove the TKey. Insert the vendor TKey for the active key and press Enter, or enter \"skip\" if it isn't available: ")
+		if err != nil {
+			le.Printf("%v\n", err)
+			os.Exit(1)
+		}
+
+		if answer == "skip" {
+			le.Printf("Skipped. The ceremony record is only signed by the new key.\n")
+		} else {
+			err = withSigner(dev, verbose, oldKey.AppBin.Bin, func(tk *tkey.TKey, pubKey []byte) error {
+				var err error
+
+				if [ed25519.PublicKeySize]byte(pubKey) != oldKey.Key {
+					return fmt.Errorf("TKey UDI %s has public key %x, not the active submit key", tk.Udi.String(), pubKey)
+				}
+
+				oldSig, err = signCeremony(msg, pubKey, tk.Sign)
+
+				return err
+			})
+			if err != nil {
+				le.Printf("%v\n", err)
+				os.Exit(1)
+			}
+
+			le.Printf("The active key signed the ceremony record.\n")
+		}
+	}
+
+	if err = os.MkdirAll(outDir, 0o755); err != nil { // #nosec G301
+		le.Printf("MkdirAll failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err = writeCeremony(files, c, msg, newSig, oldSig); err != nil {
+		le.Printf("Couldn't write the ceremony transcript: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Check that what we wrote can be checked.
+	if _, err = checkCeremony(files); err != nil {
+		le.Printf("Written ceremony transcript not verified: %v\n", err)
+		os.Exit(1)
+	}
+
+	le.Printf("\nWrote the ceremony transcript to %s. Check the signatures with:\n", outDir)
+	le.Printf("  ssh-keygen -Y verify -f %s -I %s -n %s -s %s < %s\n",
+		files.AllowedSigners, c.NewKey.Name, ceremonyNamespace, files.NewSig, files.Record)
+	if oldSig != nil {
+		le.Printf("  ssh-keygen -Y verify -f %s -I %s -n %s -s %s < %s\n",
+			files.AllowedSigners, c.OldKey.Name, ceremonyNamespace, files.OldSig, files.Record)
+	}
+
+	le.Printf("\nAdd this entry to SigsumConf in internal/data/data.go and rebuild. It is also in %s:\n", files.SigsumConf)
+	fmt.Print(c.SigsumConf)
+
+	os.Exit(0)
+}
+
+// activeSubmitKey returns the submit key in log that is active in the
+// serve-signer configuration in configFile.
+func activeSubmitKey(configFile string, log sigsum.Log) (*sigsum.PubKey, error) {
+	conf, err := loadServeSignerConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	authorities, err := certAuthorities(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := embeddedSubmitKey(conf.ActiveKey, authorities, log)
+	if err != nil {
+		return nil, fmt.Errorf("activekey: %w", err)
+	}
+
+	return &key, nil
+}
+
+// withSigner connects to a TKey, loads the signer in bin and calls f
+// with the TKey and its public key.
+func withSigner(dev Device, verbose bool, bin []byte, f func(tk *tkey.TKey, pubKey []byte) error) error {
+	tk, err := tkey.NewTKey(dev.Path, dev.Speed, verbose)
+	if err != nil {
+		return fmt.Errorf("couldn't connect to TKey: %w", err)
+	}
+	defer tk.Close()
+
+	pubKey, err := tk.LoadSigner(bin)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if len(pubKey) != ed25519.PublicKeySize {
+		return errors.New("public key has wrong length")
+	}
+
+	return f(tk, pubKey)
+}
+
+// prompt asks the operator with msg and returns the answer.
+func prompt(in *bufio.Reader, msg string) (string, error) {
+	le.Printf("%s", msg)
+
+	answer, err := in.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("no answer: %w", err)
+	}
+
+	return strings.TrimSpace(answer), nil
+}
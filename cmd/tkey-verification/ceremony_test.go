@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+)
+
+func TestCeremony(t *testing.T) {
+	newPriv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	oldPriv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))
+
+	keyOf := func(name string, priv ed25519.PrivateKey) sigsum.PubKey {
+		k := sigsum.PubKey{
+			Name:  name,
+			Tag:   "signer-v1.0.1",
+			Start: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:   time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+		copy(k.Key[:], priv.Public().(ed25519.PublicKey))
+
+		return k
+	}
+
+	oldKey := newCeremonyKey(keyOf("tillitis-sigsum1", oldPriv), "")
+	c := Ceremony{
+		Version:    ceremonyVersion,
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Tool:       "test",
+		NewKey:     newCeremonyKey(keyOf("tillitis-sigsum2", newPriv), "0133708200000001"),
+		OldKey:     &oldKey,
+		SigsumConf: keyOf("tillitis-sigsum2", newPriv).Entry(),
+	}
+
+	msg, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(priv ed25519.PrivateKey) []byte {
+		t.Helper()
+
+		sig, err := signCeremony(msg, priv.Public().(ed25519.PublicKey), func(m []byte) ([]byte, error) {
+			return ed25519.Sign(priv, m), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return sig
+	}
+
+	files := newCeremonyFiles(t.TempDir(), "tillitis-sigsum2")
+	if err = writeCeremony(files, c, msg, sign(newPriv), sign(oldPriv)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := checkCeremony(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.NewKey != c.NewKey || got.SigsumConf != c.SigsumConf {
+		t.Fatalf("unexpected record %+v", got)
+	}
+
+	// The standard tool agrees
+	if _, err = exec.LookPath("ssh-keygen"); err == nil {
+		for _, check := range []struct{ name, sig string }{
+			{c.NewKey.Name, files.NewSig},
+			{c.OldKey.Name, files.OldSig},
+		} {
+			cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", files.AllowedSigners, // #nosec G204
+				"-I", check.name, "-n", ceremonyNamespace, "-s", check.sig)
+			cmd.Stdin = bytes.NewReader(msg)
+
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("ssh-keygen -Y verify %s: %v\n%s", check.name, err, out)
+			}
+		}
+	}
+
+	// The old key signed something else
+	if err = os.WriteFile(files.OldSig, sign(newPriv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = checkCeremony(files); err == nil || !strings.Contains(err.Error(), "tillitis-sigsum1") {
+		t.Fatalf("expected error for the old key, got %v", err)
+	}
+
+	// Again without the old key, a stale signature from it is removed
+	if err = writeCeremony(files, c, msg, sign(newPriv), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(files.OldSig); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stale signature by the old key left: %v", err)
+	}
+
+	if _, err = checkCeremony(files); err != nil {
+		t.Fatal(err)
+	}
+
+	// A changed record
+	if err = os.WriteFile(files.Record, bytes.Replace(msg, []byte("2028"), []byte("2029"), 1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = checkCeremony(files); err == nil {
+		t.Fatal("expected error for changed record")
+	}
+}
@@ -22,6 +22,17 @@ type ServerConfig struct {
 	ServerKey  string `yaml:"serverkey"`
 	ListenAddr string `yaml:"listen"`
 	ActiveKey  string `yaml:"activekey"`
+
+	// Keys certifying activekey and nextkey, if they are
+	// certificates, in the authorized_keys format
+	CertAuthority string `yaml:"certauthority"`
+
+	// Planned handover to a successor submit key on another TKey
+	NextKey       string `yaml:"nextkey"`
+	NextPort      string `yaml:"nextport"`
+	Handover      string `yaml:"handover"`      // Default when nextkey becomes valid
+	ExpiryWarning string `yaml:"expirywarning"` // Default 720h
+	SubmitMargin  string `yaml:"submitmargin"`  // Default 168h
 }
 
 type ProvConfig struct {
@@ -32,6 +43,21 @@ type ProvConfig struct {
 	SigningAppHash string `yaml:"signingapphash"`
 }
 
+// AppsConfig tells how to rebuild the embedded device apps, indexed
+// by app tag.
+type AppsConfig struct {
+	Apps map[string]AppBuild `yaml:"apps"`
+}
+
+type AppBuild struct {
+	Source    string `yaml:"source"`    // Source checkout
+	Build     string `yaml:"build"`     // Shell command to build, default make
+	Output    string `yaml:"output"`    // Built app, relative to source
+	Container string `yaml:"container"` // Build in this container image
+	Engine    string `yaml:"engine"`    // Container engine, default podman
+	Toolchain string `yaml:"toolchain"` // Directory first in PATH when not in a container
+}
+
 func loadServeSignerConfig(fn string) (ServerConfig, error) {
 	var conf ServerConfig
 
@@ -63,3 +89,19 @@ func loadRemoteSignConfig(fn string) (ProvConfig, error) {
 
 	return conf, nil
 }
+
+func loadVerifyAppsConfig(fn string) (AppsConfig, error) {
+	var conf AppsConfig
+
+	rawConfig, err := os.ReadFile(fn)
+	if err != nil {
+		return conf, fmt.Errorf("couldn't read config file: %w", err)
+	}
+
+	err = yaml.Unmarshal(rawConfig, &conf)
+	if err != nil {
+		return conf, fmt.Errorf("parse error in config file: %w", err)
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/tillitis/tkey-verification/internal/data"
+	"github.com/tillitis/tkey-verification/internal/firmware"
+	"github.com/tillitis/tkey-verification/internal/tkey"
+	"github.com/tillitis/tkey-verification/internal/verification"
+)
+
+// convertVerifications converts all verification files in inDir to
+// the current format version and writes them to outDir. Files
+// already in the current version are copied unchanged.
+//
+// The UDI is taken from the file name. The firmware is looked up in
+// the embedded firmware database.
+func convertVerifications(inDir string, outDir string, verbose bool) {
+	var firmwares firmware.Firmwares
+	if err := firmwares.FromString(data.FirmwaresConf); err != nil {
+		le.Printf("Couldn't parse firmware database: %v\n", err)
+		os.Exit(1)
+	}
+
+	entries, err := os.ReadDir(inDir)
+	if err != nil {
+		le.Printf("ReadDir: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	converted := 0
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		udiBE, err := hex.DecodeString(entry.Name())
+		if err != nil || len(udiBE) != tkey.UDISize {
+			if verbose {
+				le.Printf("Skipping %s, not named after a UDI\n", entry.Name())
+			}
+
+			continue
+		}
+
+		if err = convertVerification(firmwares, inDir, outDir, entry.Name(), udiBE); err != nil {
+			le.Printf("%s: %v\n", entry.Name(), err)
+			failed++
+
+			continue
+		}
+
+		if verbose {
+			le.Printf("Converted %s\n", entry.Name())
+		}
+
+		converted++
+	}
+
+	le.Printf("Converted %d verification files to version %d in %s, %d failed\n",
+		converted, verification.Version, outDir, failed)
+
+	if failed != 0 {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+func convertVerification(firmwares firmware.Firmwares, inDir string, outDir string, fn string, udiBE []byte) error {
+	content, err := os.ReadFile(path.Join(inDir, fn))
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	var orig verification.Verification
+	if err = orig.FromJSON(content); err != nil {
+		return err
+	}
+
+	out := content
+
+	if orig.Version != verification.Version {
+		v := orig
+		if err = v.SetVersion2(udiBE, firmwares); err != nil {
+			return err
+		}
+
+		out, err = v.ToJSON()
+		if err != nil {
+			return err
+		}
+
+		out = append(out, '\n')
+
+		// Make sure we didn't change anything that is
+		// verified.
+		var conv verification.Verification
+		if err = conv.FromJSON(out); err != nil {
+			return fmt.Errorf("converted file doesn't parse: %w", err)
+		}
+
+		if err = sameVerified(orig, conv); err != nil {
+			return fmt.Errorf("conversion changed verified data: %w", err)
+		}
+	} else if err = orig.CheckUDI(udiBE); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path.Join(outDir, fn), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if _, err = f.Write(out); err != nil {
+		f.Close()
+		return fmt.Errorf("%w", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// sameVerified returns an error if a and b differ in anything that
+// is used when verifying a TKey.
+func sameVerified(a verification.Verification, b verification.Verification) error {
+	switch {
+	case a.Type != b.Type:
+		return errors.New("type")
+	case !a.Timestamp.Equal(b.Timestamp):
+		return errors.New("timestamp")
+	case a.AppTag != b.AppTag:
+		return errors.New("app tag")
+	case a.AppHash != b.AppHash:
+		return errors.New("app digest")
+	case !bytes.Equal(a.Signature, b.Signature):
+		return errors.New("vendor signature")
+	}
+
+	if a.Type == verification.VerProof {
+		aJ, err := proofASCII(a)
+		if err != nil {
+			return err
+		}
+
+		bJ, err := proofASCII(b)
+		if err != nil {
+			return err
+		}
+
+		if aJ != bJ {
+			return errors.New("Sigsum proof")
+		}
+	}
+
+	return nil
+}
+
+func proofASCII(v verification.Verification) (string, error) {
+	var buf bytes.Buffer
+
+	if err := v.Proof.ToASCII(&buf); err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	return buf.String(), nil
+}
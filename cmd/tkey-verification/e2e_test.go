@@ -0,0 +1,480 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/appbins"
+	"github.com/tillitis/tkey-verification/internal/emulator"
+	"github.com/tillitis/tkey-verification/internal/firmware"
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+	"github.com/tillitis/tkey-verification/internal/sigsumtest"
+	"github.com/tillitis/tkey-verification/internal/ssh"
+	"github.com/tillitis/tkey-verification/internal/submission"
+	"github.com/tillitis/tkey-verification/internal/verification"
+	"github.com/tillitis/tkey-verification/pkg/verify"
+	"github.com/tillitis/tkeyclient"
+)
+
+// The end-to-end tests provision emulated TKeys like the production
+// line does, but against a Sigsum log and witness in memory:
+//
+//   - remote-sign authenticates the TKey and asks serve-signer, with
+//     a software submit key, to sign over TLS,
+//
+//   - the submission is logged as tkey-sigsum-submit does,
+//
+//   - and the TKey is verified from the verification file, as
+//     tkey-verify does.
+
+// Castor, which demands a Sigsum proof.
+const e2eUDI = "013370c000000001"
+
+// The device app that signs with the submit key, only recorded in
+// the Sigsum configuration.
+const e2eSubmitAppTag = "verisigner-v0.0.3"
+const e2eSubmitAppHash = "f8ecdcda53a296636a0297c250b27fb649860645626cc8ad935eabb4c43ea3e1841c40300544fade4189aa4143c1ca8fe82361e3d874b42b0e2404793a170142"
+
+var (
+	e2eKeyStart = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	e2eKeyEnd   = time.Date(2125, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// softSigner is a Signer with the key in memory, instead of on a
+// TKey.
+type softSigner ed25519.PrivateKey
+
+func (s softSigner) GetPubkey() ([]byte, error) {
+	pub, _ := ed25519.PrivateKey(s).Public().(ed25519.PublicKey)
+
+	return pub, nil
+}
+
+func (s softSigner) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(s), message), nil
+}
+
+type harness struct {
+	sumLog    *sigsumtest.Log
+	log       sigsum.Log
+	firmware  []byte
+	firmwares firmware.Firmwares
+	appBin    appbins.AppBin
+	server    Server
+
+	submDir     string
+	doneSubmDir string
+	verDir      string
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	h := harness{
+		firmware:    bytes.Repeat([]byte("castor firmware "), 256),
+		submDir:     t.TempDir(),
+		doneSubmDir: t.TempDir(),
+		verDir:      t.TempDir(),
+	}
+
+	var err error
+
+	h.sumLog, err = sigsumtest.NewLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.sumLog.Close)
+
+	fwHash := sha512.Sum512(h.firmware)
+	if err = h.firmwares.FromString(fmt.Sprintf("%s 1337 3 0 %d %x e2e", e2eUDI[:8], len(h.firmware), fwHash)); err != nil {
+		t.Fatal(err)
+	}
+
+	bins, err := appbins.NewAppBins()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bin := range bins.Bins {
+		if bin.Tag == "signer-v1.0.1" {
+			h.appBin = bin
+		}
+	}
+
+	// The submit key of serve-signer
+	_, submitKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pub ssh.PublicKey
+	copy(pub[:], submitKey[32:])
+
+	sigsumConf := strings.Join([]string{
+		"tillitis-sigsum-e2e",
+		strings.TrimSpace(ssh.FormatPublicEd25519(pub)),
+		e2eSubmitAppTag,
+		e2eSubmitAppHash,
+		e2eKeyStart.Format(time.RFC3339),
+		e2eKeyEnd.Format(time.RFC3339),
+	}, "\n")
+
+	if err = h.log.FromString(sigsumConf, h.sumLog.Policy()); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := SubmitKeys{
+		Active: SubmitKey{Key: h.log.Keys[pub], Signer: softSigner(submitKey)},
+	}
+
+	h.server = startServeSigner(t, NewAPI(&keys, h.submDir))
+
+	return &h
+}
+
+// newDevice starts an emulated TKey with uds and firmware. It goes
+// back to firmware mode every time it is closed, like a TKey plugged
+// in again.
+func newDevice(t *testing.T, uds byte, fw []byte) Device {
+	t.Helper()
+
+	udi, _ := hex.DecodeString(e2eUDI)
+
+	emu, err := emulator.New(emulator.Config{
+		UDS:      [32]byte{uds},
+		UDI:      udi,
+		Firmware: fw,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := emu.OpenPTY()
+	if err != nil {
+		t.Skipf("no PTY: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+
+	p.ResetOnClose = true
+
+	go func() {
+		_ = p.Serve()
+	}()
+
+	return Device{Path: p.Path(), Speed: tkeyclient.SerialSpeed}
+}
+
+// provision does what remote-sign does.
+func (h *harness) provision(dev Device) error {
+	message, err := authDevice(dev, h.appBin, h.firmwares, false)
+	if err != nil {
+		return err
+	}
+
+	return vendorSign(&h.server, message.udi.Bytes, message.pubKey, message.fw, h.appBin)
+}
+
+// submit does what tkey-sigsum-submit does.
+func (h *harness) submit() error {
+	s := submission.Submitter{
+		SubmDir:     h.submDir,
+		DoneSubmDir: h.doneSubmDir,
+		VerDir:      h.verDir,
+		Log:         h.log,
+		Firmwares:   &h.firmwares,
+	}
+
+	return s.ProcessSubmissions()
+}
+
+// verify does what tkey-verify does.
+func (h *harness) verify(dev Device) (verify.Result, error) {
+	tk, err := verify.Open(dev.Path, dev.Speed)
+	if err != nil {
+		return verify.Result{}, err
+	}
+	defer tk.Close()
+
+	bins, err := appbins.NewAppBins()
+	if err != nil {
+		return verify.Result{}, err
+	}
+
+	trust := verify.TrustStore{
+		Log:       h.log,
+		Firmwares: h.firmwares,
+		AppBins:   bins,
+	}
+
+	return verify.New(trust, verify.DirFetcher(h.verDir)).Verify(context.Background(), tk)
+}
+
+func (h *harness) mustProvisionAndSubmit(t *testing.T, dev Device) {
+	t.Helper()
+
+	if err := h.provision(dev); err != nil {
+		t.Fatalf("remote-sign: %v", err)
+	}
+
+	if err := h.submit(); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+}
+
+func TestE2EGenuine(t *testing.T) {
+	h := newHarness(t)
+	dev := newDevice(t, 1, h.firmware)
+
+	h.mustProvisionAndSubmit(t, dev)
+
+	var subm submission.Submission
+	if err := subm.FromFile(filepath.Join(h.doneSubmDir, e2eUDI)); err != nil {
+		t.Fatal(err)
+	}
+
+	if subm.Station != "station-1" {
+		t.Fatalf("submission from station %q, expected station-1", subm.Station)
+	}
+
+	res, err := h.verify(dev)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	if res.Method != verify.MethodSigsum {
+		t.Fatalf("verified with %v, expected Sigsum proof", res.Method)
+	}
+
+	if res.Firmware.Label != "e2e" {
+		t.Fatalf("unexpected firmware %q", res.Firmware.Label)
+	}
+}
+
+func TestE2EWrongFirmwareAtProvisioning(t *testing.T) {
+	h := newHarness(t)
+	dev := newDevice(t, 1, bytes.Repeat([]byte("manipulated fw! "), 256))
+
+	err := h.provision(dev)
+	if !errors.Is(err, ErrWrongFirmware) {
+		t.Fatalf("expected wrong firmware, got %v", err)
+	}
+
+	if entries, _ := os.ReadDir(h.submDir); len(entries) != 0 {
+		t.Fatal("submission written for TKey with wrong firmware")
+	}
+}
+
+func TestE2EWrongFirmwareAtVerification(t *testing.T) {
+	h := newHarness(t)
+	h.mustProvisionAndSubmit(t, newDevice(t, 1, h.firmware))
+
+	// Same TKey, but with other firmware.
+	_, err := h.verify(newDevice(t, 1, bytes.Repeat([]byte("manipulated fw! "), 256)))
+	if !errors.Is(err, verify.ErrFirmwareMismatch) || !verify.IsCounterfeit(err) {
+		t.Fatalf("expected firmware mismatch, got %v", err)
+	}
+}
+
+func TestE2EOtherDevice(t *testing.T) {
+	h := newHarness(t)
+	h.mustProvisionAndSubmit(t, newDevice(t, 1, h.firmware))
+
+	// Same UDI and firmware, other UDS and so other identity.
+	_, err := h.verify(newDevice(t, 2, h.firmware))
+	if !errors.Is(err, verify.ErrProofInvalid) || !verify.IsCounterfeit(err) {
+		t.Fatalf("expected invalid proof, got %v", err)
+	}
+}
+
+func TestE2EKeyOutsideLifetime(t *testing.T) {
+	h := newHarness(t)
+
+	if err := h.provision(newDevice(t, 1, h.firmware)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The witness cosigns after the submit key expired.
+	h.sumLog.SetTime(e2eKeyEnd.Add(time.Hour))
+
+	err := h.submit()
+	if !errors.Is(err, verification.ErrKeyOutsideLifetime) {
+		t.Fatalf("expected key outside lifetime, got %v", err)
+	}
+
+	if entries, _ := os.ReadDir(h.verDir); len(entries) != 0 {
+		t.Fatal("verification file written with proof outside key lifetime")
+	}
+}
+
+func TestE2ERevokedKey(t *testing.T) {
+	h := newHarness(t)
+	dev := newDevice(t, 1, h.firmware)
+	h.mustProvisionAndSubmit(t, dev)
+
+	// The submit key compromised before the device was logged.
+	for k, key := range h.log.Keys {
+		key.Revoked = true
+		key.RevokedAt = time.Now().Add(-time.Hour)
+		key.RevokeReason = "e2e"
+		h.log.Keys[k] = key
+	}
+
+	_, err := h.verify(dev)
+	if !errors.Is(err, verify.ErrKeyRevoked) {
+		t.Fatalf("expected revoked key, got %v", err)
+	}
+}
+
+func TestE2ETamperedProof(t *testing.T) {
+	h := newHarness(t)
+	dev := newDevice(t, 1, h.firmware)
+	h.mustProvisionAndSubmit(t, dev)
+
+	udi, _ := hex.DecodeString(e2eUDI)
+	fn := filepath.Join(h.verDir, e2eUDI)
+
+	var ver verification.Verification
+	if err := ver.FromFile(fn, udi); err != nil {
+		t.Fatal(err)
+	}
+
+	ver.Proof.TreeHead.RootHash[0] ^= 1
+
+	if err := ver.ToFile(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := h.verify(dev)
+	if !errors.Is(err, verify.ErrProofInvalid) || !verify.IsCounterfeit(err) {
+		t.Fatalf("expected invalid proof, got %v", err)
+	}
+}
+
+func TestE2EWrongUDI(t *testing.T) {
+	h := newHarness(t)
+	h.mustProvisionAndSubmit(t, newDevice(t, 1, h.firmware))
+
+	// The verification file of the TKey, served for another.
+	other := "013370c000000002"
+	if err := os.Rename(filepath.Join(h.verDir, e2eUDI), filepath.Join(h.verDir, other)); err != nil {
+		t.Fatal(err)
+	}
+
+	udi, _ := hex.DecodeString(other)
+	emu, err := emulator.New(emulator.Config{UDS: [32]byte{1}, UDI: udi, Firmware: h.firmware})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := emu.OpenPTY()
+	if err != nil {
+		t.Skipf("no PTY: %v", err)
+	}
+	defer p.Close()
+
+	go func() {
+		_ = p.Serve()
+	}()
+
+	_, err = h.verify(Device{Path: p.Path(), Speed: tkeyclient.SerialSpeed})
+	if !errors.Is(err, verify.ErrWrongUDI) {
+		t.Fatalf("expected wrong UDI, got %v", err)
+	}
+}
+
+// startServeSigner serves api like serve-signer does, with
+// certificates from a new CA. It returns how a station with a client
+// certificate for "station-1" reaches it.
+func startServeSigner(t *testing.T, api *API) Server {
+	t.Helper()
+
+	caCert, caKey := newCert(t, "tillitis", nil, nil)
+	serverCert, serverKey := newCert(t, "server", caCert, caKey)
+	clientCert, clientKey := newCert(t, "station-1", caCert, caKey)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		_ = serve(listener, api)
+	}()
+
+	return Server{
+		Addr: listener.Addr().String(),
+		TLSConfig: tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}},
+			RootCAs:      pool,
+			MinVersion:   tls.VersionTLS13,
+		},
+	}
+}
+
+// newCert returns a certificate for cn signed by parent, or a CA
+// certificate if parent is nil.
+func newCert(t *testing.T, cn string, parent *x509.Certificate, parentKey ed25519.PrivateKey) (*x509.Certificate, ed25519.PrivateKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = &template, priv
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, parent, pub, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, priv
+}
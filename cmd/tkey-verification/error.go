@@ -16,6 +16,7 @@ const (
 	ErrWrongDigest        = constError("erroneous app digest")
 	ErrWrongLen           = constError("wrong message length")
 	ErrSignFailed         = constError("signing failed")
+	ErrKeyNotValid        = constError("submit key not valid")
 	ErrVerificationFailed = constError("signature failed verification")
 	ErrSigExist           = constError("vendor signature already exist")
 	ErrInternal           = constError("internal error")
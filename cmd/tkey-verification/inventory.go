@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/inventory"
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+)
+
+const defaultInventoryFile = "./inventory.db"
+
+// InventoryOpts are the flags used by the inventory commands.
+type InventoryOpts struct {
+	File    string
+	Dirs    inventory.Dirs
+	UDI     string
+	State   string
+	Product int
+	Station string
+	AppTag  string
+	Since   string
+	Until   string
+	Format  string
+}
+
+func inventoryCmd(subcmd string, opts InventoryOpts, verbose bool) {
+	switch subcmd {
+	case "import":
+		importInventory(opts, verbose)
+
+	case "query", "export":
+		filter, err := opts.filter()
+		if err != nil {
+			le.Printf("%v\n", err)
+			os.Exit(2)
+		}
+
+		s, err := inventory.Open(opts.File)
+		if err != nil {
+			le.Printf("Couldn't open inventory %s: %v\n", opts.File, err)
+			os.Exit(1)
+		}
+
+		devices, err := inventory.Query(s, filter)
+		s.Close()
+		if err != nil {
+			le.Printf("Query failed: %v\n", err)
+			os.Exit(1)
+		}
+
+		if subcmd == "query" {
+			err = printInventory(devices)
+		} else {
+			err = exportInventory(devices, opts.Format)
+		}
+
+		if err != nil {
+			le.Printf("%v\n", err)
+			os.Exit(1)
+		}
+
+	default:
+		le.Printf("%s is not an inventory command: import, query, or export\n", subcmd)
+		os.Exit(2)
+	}
+
+	os.Exit(0)
+}
+
+// importInventory rebuilds the inventory from the directories
+// provisioning leaves files in.
+func importInventory(opts InventoryOpts, verbose bool) {
+	if opts.Dirs == (inventory.Dirs{}) {
+		le.Printf("Needs at least one directory to import from, use `--submissions-dir`, `--processed-submissions-dir`, `--verifications-dir`, or `--published-dir`\n")
+		os.Exit(2)
+	}
+
+	var log sigsum.Log
+	if err := log.FromEmbedded(); err != nil {
+		le.Printf("Found no usable Sigsum configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	s, err := inventory.Open(opts.File)
+	if err != nil {
+		le.Printf("Couldn't open inventory %s: %v\n", opts.File, err)
+		os.Exit(1)
+	}
+	defer s.Close()
+
+	// Clear and import in one transaction, so a failed import
+	// leaves the inventory as it was
+	imported, skipped := 0, 0
+	err = s.Rebuild(func(tx inventory.Store) error {
+		var importErr error
+		imported, importErr = inventory.Import(tx, opts.Dirs, log, func(fn string, err error) {
+			if verbose {
+				le.Printf("Skipping %s: %v\n", fn, err)
+			}
+
+			skipped++
+		})
+
+		return importErr
+	})
+	if err != nil {
+		le.Printf("Import failed, inventory %s left unchanged: %v\n", opts.File, err)
+		os.Exit(1)
+	}
+
+	all, err := s.All()
+	if err != nil {
+		le.Printf("Couldn't read inventory %s: %v\n", opts.File, err)
+		os.Exit(1)
+	}
+
+	le.Printf("Imported %d files about %d TKeys to %s, skipped %d\n", imported, len(all), opts.File, skipped)
+}
+
+func (o InventoryOpts) filter() (inventory.Filter, error) {
+	var f inventory.Filter
+	var err error
+
+	f.UDI = o.UDI
+	f.Station = o.Station
+	f.AppTag = o.AppTag
+
+	if o.State != "" {
+		if f.State, err = inventory.ParseState(o.State); err != nil {
+			return f, fmt.Errorf("%w", err)
+		}
+	}
+
+	if o.Product >= 0 {
+		if o.Product > 0x3f {
+			return f, fmt.Errorf("product ID %d out of range", o.Product)
+		}
+
+		productID := uint8(o.Product)
+		f.ProductID = &productID
+	}
+
+	if o.Since != "" {
+		if f.Since, err = parseTime(o.Since); err != nil {
+			return f, err
+		}
+	}
+
+	if o.Until != "" {
+		if f.Until, err = parseTime(o.Until); err != nil {
+			return f, err
+		}
+	}
+
+	return f, nil
+}
+
+// parseTime parses a date or RFC 3339 time.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("couldn't parse time %q, use YYYY-MM-DD or RFC 3339", s)
+	}
+
+	return t, nil
+}
+
+func printInventory(devices []inventory.Device) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "UDI\tPRODUCT\tPROVISIONED\tSTATION\tAPPTAG\tSUBMIT KEY\tSTATE\tLOG INDEX\n")
+
+	for _, d := range devices {
+		var logIndex string
+		if d.LogIndex != nil {
+			logIndex = strconv.FormatUint(*d.LogIndex, 10)
+		}
+
+		fmt.Fprintf(w, "%s\t%d/%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.UDI, d.ProductID, d.ProductRev, d.Provisioned.UTC().Format(time.RFC3339),
+			d.Station, d.AppTag, d.SubmitKey, d.State, logIndex)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func exportInventory(devices []inventory.Device, format string) error {
+	switch format {
+	case "", "csv":
+		return inventory.WriteCSV(os.Stdout, devices)
+	case "json":
+		return inventory.WriteJSON(os.Stdout, devices)
+	}
+
+	return fmt.Errorf("unknown export format %q, use csv or json", format)
+}
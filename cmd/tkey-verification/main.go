@@ -34,8 +34,10 @@ type Device struct {
 
 func main() {
 	var dev Device
-	var configFile, binPath string
+	var configFile, binPath, revocationFile, firmwareFile, inDir, outDir, format string
 	var checkConfigOnly, verbose, versionOnly, build, helpOnly bool
+	var inv InventoryOpts
+	var pubkeyOpts PubkeyOpts
 
 	pflag.CommandLine.SetOutput(os.Stderr)
 	pflag.CommandLine.SortFlags = false
@@ -46,11 +48,51 @@ func main() {
 	pflag.BoolVar(&verbose, "verbose", false,
 		"Enable verbose output.")
 	pflag.StringVar(&configFile, "config", defaultConfigFile,
-		"`PATH` to configuration file (commands: serve-signer, remote-sign).")
+		"`PATH` to configuration file (commands: serve-signer, remote-sign, verify-apps, key-ceremony).")
 	pflag.BoolVar(&checkConfigOnly, "check-config", false,
 		"Only check that the configuration is usable, then exit (commands: serve-signer, remote-sign).")
 	pflag.StringVarP(&binPath, "app", "a", "",
-		"`PATH` to the device app to show vendor signing pubkey (command: show-pubkey).")
+		"`PATH` to the device app to show vendor signing pubkey or sign with (commands: show-pubkey, sign-revocations, sign-firmwares, key-ceremony).")
+	pflag.StringVar(&revocationFile, "revocation-list", "",
+		"`PATH` to the unsigned revocation list to sign (command: sign-revocations).")
+	pflag.StringVar(&firmwareFile, "firmware-db", "",
+		"`PATH` to the firmware database to sign (command: sign-firmwares).")
+	pflag.StringVar(&inDir, "in-dir", "",
+		"`DIRECTORY` with verification files to convert (command: convert-verifications).")
+	pflag.StringVar(&outDir, "out-dir", "",
+		"`DIRECTORY` to write converted verification files or the key ceremony transcript to (commands: convert-verifications, key-ceremony).")
+	pflag.StringVar(&inv.File, "inventory", defaultInventoryFile,
+		"`PATH` to the inventory SQLite database (command: inventory).")
+	pflag.StringVar(&inv.Dirs.Submissions, "submissions-dir", "",
+		"Import pending submissions from `DIRECTORY`, usually signatures (command: inventory import).")
+	pflag.StringVar(&inv.Dirs.ProcessedSubmissions, "processed-submissions-dir", "",
+		"Import logged submissions from `DIRECTORY` (command: inventory import).")
+	pflag.StringVar(&inv.Dirs.Verifications, "verifications-dir", "",
+		"Import verification files from `DIRECTORY` (command: inventory import).")
+	pflag.StringVar(&inv.Dirs.Published, "published-dir", "",
+		"Import verification files published on the verification server from `DIRECTORY` (command: inventory import).")
+	pflag.StringVar(&inv.UDI, "udi", "",
+		"Only TKeys with a UDI starting with `HEX` (commands: inventory query, export).")
+	pflag.StringVar(&inv.State, "state", "",
+		"Only TKeys in `STATE`: pending, signed, logged, or published (commands: inventory query, export).")
+	pflag.IntVar(&inv.Product, "product", -1,
+		"Only TKeys with product `ID` (commands: inventory query, export).")
+	pflag.StringVar(&inv.Station, "station", "",
+		"Only TKeys provisioned by the station with common `NAME` (commands: inventory query, export).")
+	pflag.StringVar(&inv.AppTag, "apptag", "",
+		"Only TKeys provisioned with the device app `TAG` (commands: inventory query, export).")
+	pflag.StringVar(&inv.Since, "since", "",
+		"Only TKeys provisioned at or after `TIME` (commands: inventory query, export).")
+	pflag.StringVar(&inv.Until, "until", "",
+		"Only TKeys provisioned before `TIME` (commands: inventory query, export).")
+	pflag.StringVar(&format, "format", "",
+		"Output in `FORMAT`: csv (default) or json (command: inventory export), or plain (default), sigsum-conf, or vendorkey (command: show-pubkey).")
+	pflag.StringVar(&pubkeyOpts.Name, "name", "",
+		"`NAME` of the Sigsum submit key (commands: show-pubkey --format sigsum-conf, key-ceremony).")
+	pflag.StringVar(&pubkeyOpts.ValidFrom, "valid-from", "",
+		"Start of validity of the key at `TIME` (commands: show-pubkey, key-ceremony).")
+	pflag.StringVar(&pubkeyOpts.ValidTo, "valid-to", "",
+		"End of validity of the key at `TIME` (commands: show-pubkey, key-ceremony).")
 	pflag.BoolVar(&versionOnly, "version", false, "Output version information.")
 	pflag.BoolVar(&build, "build", false, "Output build data about included device apps and firmwares")
 	pflag.BoolVar(&helpOnly, "help", false, "Output this help.")
@@ -71,9 +113,17 @@ func main() {
 		os.Exit(0)
 	}
 
-	if pflag.NArg() != 1 {
-		if pflag.NArg() > 1 {
-			le.Printf("Unexpected argument: %s\n\n", strings.Join(pflag.Args()[1:], " "))
+	// Only inventory has subcommands
+	nargs := 1
+	if pflag.Arg(0) == "inventory" {
+		nargs = 2
+	}
+
+	if pflag.NArg() != nargs {
+		if pflag.NArg() > nargs {
+			le.Printf("Unexpected argument: %s\n\n", strings.Join(pflag.Args()[nargs:], " "))
+		} else if nargs == 2 {
+			le.Printf("Please pass an inventory command: import, query, or export\n\n")
 		} else {
 			le.Printf("Please pass a command: serve-signer, remote-sign, or verify\n\n")
 		}
@@ -110,7 +160,49 @@ func main() {
 			le.Printf("Needs the path to an app, use `--app PATH`\n")
 			os.Exit(2)
 		}
-		showPubkey(binPath, dev, verbose)
+		pubkeyOpts.Format = format
+		showPubkey(binPath, dev, verbose, pubkeyOpts)
+
+	case "key-ceremony":
+		if binPath == "" || outDir == "" {
+			le.Printf("Needs the path to the new app and a directory for the transcript, use `--app PATH --out-dir PATH`\n")
+			os.Exit(2)
+		}
+		keyCeremony(binPath, configFile, outDir, pubkeyOpts, dev, verbose)
+
+	case "sign-revocations":
+		if binPath == "" || revocationFile == "" {
+			le.Printf("Needs the path to an app and a revocation list, use `--app PATH --revocation-list PATH`\n")
+			os.Exit(2)
+		}
+		signRevocations(binPath, revocationFile, dev, verbose)
+
+	case "sign-firmwares":
+		if binPath == "" || firmwareFile == "" {
+			le.Printf("Needs the path to an app and a firmware database, use `--app PATH --firmware-db PATH`\n")
+			os.Exit(2)
+		}
+		signFirmwares(binPath, firmwareFile, dev, verbose)
+
+	case "convert-verifications":
+		if inDir == "" || outDir == "" {
+			le.Printf("Needs the input and output directories, use `--in-dir PATH --out-dir PATH`\n")
+			os.Exit(2)
+		}
+		convertVerifications(inDir, outDir, verbose)
+
+	case "verify-apps":
+		conf, err := loadVerifyAppsConfig(configFile)
+		if err != nil {
+			le.Printf("Couldn't load config: %v\n", err)
+			os.Exit(1)
+		}
+
+		verifyApps(conf, verbose)
+
+	case "inventory":
+		inv.Format = format
+		inventoryCmd(pflag.Args()[1], inv, verbose)
 
 	default:
 		le.Printf("%s is not a valid command.\n", cmd)
@@ -96,9 +96,8 @@ func authDevice(dev Device, appBin appbins.AppBin, firmwares firmware.Firmwares,
 	le.Printf("TKey UDI: %s\n", tk.Udi.String())
 
 	// Authenticate against pubkey
-	err = tk.Challenge(pubKey)
-	if err != nil {
-		return message, fmt.Errorf("challenge/response failed: %w", err)
+	if _, err = tk.Challenge(pubKey, 1); err != nil {
+		return message, fmt.Errorf("%w", err)
 	}
 
 	// Verify the firmware
@@ -5,11 +5,15 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
 	"net/rpc"
 	"os"
+	"time"
 
 	"github.com/tillitis/tkey-verification/internal/sigsum"
 	"github.com/tillitis/tkey-verification/internal/ssh"
@@ -38,59 +42,64 @@ func serveSigner(conf ServerConfig, dev Device, verbose bool, checkConfigOnly bo
 		os.Exit(1)
 	}
 
-	// Do we have the configured pubkey to use for Sigsum submit key
-	activeKey, err := ssh.ParsePublicEd25519(conf.ActiveKey)
+	// Do we have the configured pubkeys to use for Sigsum submit
+	// keys, and are they valid.
+	keys, err := submitKeysFromConfig(conf, log)
 	if err != nil {
-		le.Printf("parse error in config: %v\n", err)
+		le.Printf("Config: %v\n", err)
 		os.Exit(1)
 	}
 
-	submitKey, ok := log.Keys[activeKey]
-	if !ok {
-		le.Printf("Compiled in submit key indexed by %x not found\n", activeKey)
+	if err = keys.Check(time.Now()); err != nil {
+		le.Printf("Config: %v\n", err)
 		os.Exit(1)
 	}
 
+	if warning := keys.Expiring(time.Now()); warning != "" {
+		le.Printf("Warning: %s\n", warning)
+	}
+
 	if checkConfigOnly {
 		os.Exit(0)
 	}
 
-	tk, err := tkey.NewTKey(dev.Path, dev.Speed, verbose)
+	tk, err := connectSubmitKey(keys.Active.Key, dev, verbose)
 	if err != nil {
-		le.Printf("Couldn't connect to TKey: %v\n", err)
+		le.Printf("%v\n", err)
 		os.Exit(1)
 	}
 
+	keys.Active.Signer = tk
+
 	exit := func(code int) {
 		tk.Close()
 		os.Exit(code)
 	}
 
-	le.Printf("Sigsum signing: %s\n", submitKey.String())
-	le.Printf("Loading device app built from %s ...\n", submitKey.AppBin.String())
-	foundPubKey, err := tk.LoadSigner(submitKey.AppBin.Bin)
-	if err != nil {
-		fmt.Printf("Couldn't load device app: %v\n", err)
-		exit(1)
-	}
+	if keys.Next != nil {
+		le.Printf("Handover to the next key at %s\n", keys.Handover.Format(time.RFC3339))
 
-	if !bytes.Equal(submitKey.Key[:], foundPubKey) {
-		le.Printf("TKey pubkey does not match active embedded pubkey\nExpected: %v\nReceived: %v\n",
-			ssh.FormatPublicEd25519(submitKey.Key),
-			ssh.FormatPublicEd25519(ssh.PublicKey(foundPubKey)))
-		exit(1)
+		nextTk, err := connectSubmitKey(keys.Next.Key, Device{Path: conf.NextPort, Speed: dev.Speed}, verbose)
+		if err != nil {
+			le.Printf("Next key: %v\n", err)
+			exit(1)
+		}
+
+		keys.Next.Signer = nextTk
+
+		exit = func(code int) {
+			tk.Close()
+			nextTk.Close()
+			os.Exit(code)
+		}
 	}
-	le.Printf("Found signing TKey with the expected public key and UDI: %s\n", tk.Udi.String())
 
 	if err = os.MkdirAll(signaturesDir, 0o755); err != nil {
 		le.Printf("MkdirAll failed: %s\n", err)
 		exit(1)
 	}
 
-	if err = rpc.Register(NewAPI(submitKey.Key[:], *tk)); err != nil {
-		le.Printf("Register failed: %s\n", err)
-		exit(1)
-	}
+	api := NewAPI(&keys, signaturesDir)
 
 	listener, err := tls.Listen("tcp", conf.ListenAddr, &tlsConfig)
 	if err != nil {
@@ -99,18 +108,97 @@ func serveSigner(conf ServerConfig, dev Device, verbose bool, checkConfigOnly bo
 	}
 
 	le.Printf("Listening on %s...\n", conf.ListenAddr)
+	if err = serve(listener, api); err != nil {
+		le.Printf("%s\n", err)
+		// Note: is this really fatal, should we exit?
+		exit(1)
+	}
+}
+
+// connectSubmitKey connects to the TKey on dev and loads the device
+// app of the submit key, checking that the TKey has the key.
+func connectSubmitKey(key sigsum.PubKey, dev Device, verbose bool) (*tkey.TKey, error) {
+	tk, err := tkey.NewTKey(dev.Path, dev.Speed, verbose)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to TKey: %w", err)
+	}
+
+	le.Printf("Sigsum signing: %s\n", key.String())
+	le.Printf("Loading device app built from %s ...\n", key.AppBin.String())
+	foundPubKey, err := tk.LoadSigner(key.AppBin.Bin)
+	if err != nil {
+		tk.Close()
+
+		return nil, fmt.Errorf("couldn't load device app: %w", err)
+	}
+
+	if !bytes.Equal(key.Key[:], foundPubKey) {
+		tk.Close()
+
+		return nil, fmt.Errorf("TKey pubkey does not match embedded pubkey %s\nExpected: %v\nReceived: %v\n",
+			key.Name,
+			ssh.FormatPublicEd25519(key.Key),
+			ssh.FormatPublicEd25519(ssh.PublicKey(foundPubKey)))
+	}
+	le.Printf("Found signing TKey with the expected public key and UDI: %s\n", tk.Udi.String())
+
+	return tk, nil
+}
+
+// serve answers requests to api from provisioning stations
+// connecting to the TLS listener, until Accept fails.
+func serve(listener net.Listener, api *API) error {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			le.Printf("Accept failed: %s\n", err)
-			// Note: is this really fatal, should we exit?
-			exit(1)
+			return fmt.Errorf("accept failed: %w", err)
 		}
 		le.Printf("Client from %s\n", conn.RemoteAddr())
 		go func() {
 			defer conn.Close()
-			rpc.ServeConn(conn)
+
+			station, err := clientStation(conn)
+			if err != nil {
+				le.Printf("%s: %s\n", conn.RemoteAddr(), err)
+				return
+			}
+			le.Printf("Station %s from %s\n", station.Name, conn.RemoteAddr())
+
+			// A server per connection, so we know which
+			// station asked for each signature.
+			server := rpc.NewServer()
+			if err := server.Register(api.ForStation(station)); err != nil {
+				le.Printf("Register failed: %s\n", err)
+				return
+			}
+
+			server.ServeConn(conn)
 			le.Printf("Closed %s\n", conn.RemoteAddr())
 		}()
 	}
 }
+
+// clientStation completes the TLS handshake on conn and returns the
+// station identified by the client certificate.
+func clientStation(conn net.Conn) (Station, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return Station{}, errors.New("not a TLS connection")
+	}
+
+	if err := tlsConn.Handshake(); err != nil {
+		return Station{}, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return Station{}, errors.New("no client certificate")
+	}
+
+	certHash := sha256.Sum256(certs[0].Raw)
+
+	return Station{
+		Name:     certs[0].Subject.CommonName,
+		CertHash: hex.EncodeToString(certHash[:]),
+	}, nil
+}
@@ -7,16 +7,35 @@ import (
 	"crypto/ed25519"
 	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/tillitis/tkey-verification/internal/appbins"
+	"github.com/tillitis/tkey-verification/internal/sigsum"
 	"github.com/tillitis/tkey-verification/internal/ssh"
 	"github.com/tillitis/tkey-verification/internal/tkey"
+	"github.com/tillitis/tkey-verification/internal/vendorkey"
 )
 
-func showPubkey(binPath string, dev Device, verbose bool) {
+// PubkeyOpts are the options of show-pubkey.
+type PubkeyOpts struct {
+	Format    string // plain, sigsum-conf, or vendorkey
+	Name      string // Name of the Sigsum submit key
+	ValidFrom string
+	ValidTo   string
+}
+
+func showPubkey(binPath string, dev Device, verbose bool, opts PubkeyOpts) {
+	start, end, err := checkPubkeyOpts(opts)
+	if err != nil {
+		le.Printf("%v\n", err)
+		os.Exit(2)
+	}
+
 	tk, err := tkey.NewTKey(dev.Path, dev.Speed, verbose)
 	if err != nil {
 		le.Printf("Couldn't connect to TKey: %v\n", err)
@@ -44,13 +63,134 @@ func showPubkey(binPath string, dev Device, verbose bool) {
 
 	tag := strings.TrimSuffix(filepath.Base(binPath), ".bin")
 
-	le.Printf("Public Key, app tag, and app hash for embedded vendor pubkeys follows on stdout:\n")
-	fmt.Printf("%s %s %s\n", hex.EncodeToString(pubKey), tag, hex.EncodeToString(appHash[:]))
+	le.Printf("TKey UDI: %s\n", tk.Udi.String())
+
+	if opts.Format == "" || opts.Format == "plain" {
+		le.Printf("Public Key, app tag, and app hash for embedded vendor pubkeys follows on stdout:\n")
+		fmt.Printf("%s %s %s\n", hex.EncodeToString(pubKey), tag, hex.EncodeToString(appHash[:]))
 
-	var sshPubKey [ed25519.PublicKeySize]byte
+		var sshPubKey [ed25519.PublicKeySize]byte
 
-	copy(sshPubKey[:], pubKey)
-	fmt.Printf("SSH version: %v\n", ssh.FormatPublicEd25519(sshPubKey))
+		copy(sshPubKey[:], pubKey)
+		fmt.Printf("SSH version: %v\n", ssh.FormatPublicEd25519(sshPubKey))
+
+		exit(0)
+	}
+
+	entry, err := pubkeyEntry(opts, start, end, pubKey, appbins.AppBin{Tag: tag, Bin: content}, tk.Udi.String())
+	if err != nil {
+		le.Printf("%v\n", err)
+		exit(1)
+	}
+
+	le.Printf("Entry for %s follows on stdout:\n", opts.Format)
+	fmt.Print(entry)
 
 	exit(0)
 }
+
+// checkPubkeyOpts checks opts and returns the validity of the key,
+// zero if not given.
+func checkPubkeyOpts(opts PubkeyOpts) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+
+	if opts.ValidFrom != "" || opts.ValidTo != "" {
+		if opts.ValidFrom == "" || opts.ValidTo == "" {
+			return start, end, errors.New("needs both --valid-from and --valid-to")
+		}
+
+		if start, err = parseTime(opts.ValidFrom); err != nil {
+			return start, end, err
+		}
+
+		if end, err = parseTime(opts.ValidTo); err != nil {
+			return start, end, err
+		}
+
+		if !end.After(start) {
+			return start, end, errors.New("--valid-to not after --valid-from")
+		}
+	}
+
+	switch opts.Format {
+	case "", "plain", "vendorkey":
+	case "sigsum-conf":
+		if opts.Name == "" || start.IsZero() {
+			return start, end, errors.New("format sigsum-conf needs --name, --valid-from and --valid-to")
+		}
+	default:
+		return start, end, fmt.Errorf("unknown format %q, use plain, sigsum-conf, or vendorkey", opts.Format)
+	}
+
+	return start, end, nil
+}
+
+// pubkeyEntry formats pubKey, made by the device app appBin on the
+// TKey with udi, as an entry in the Sigsum configuration or the
+// vendor public keys, as in opts, valid from start to end. The entry
+// is parsed back and compared before it is returned, so it can be
+// used as is.
+func pubkeyEntry(opts PubkeyOpts, start time.Time, end time.Time, pubKey []byte, appBin appbins.AppBin, udi string) (string, error) {
+	if len(pubKey) != ed25519.PublicKeySize {
+		return "", errors.New("public key has wrong length")
+	}
+
+	appHash := appBin.Hash()
+
+	// Only the app of this key, it might not be embedded yet.
+	appBins := appbins.AppBins{
+		Bins: map[[sha512.Size]byte]appbins.AppBin{appHash: appBin},
+	}
+
+	comment := fmt.Sprintf("# TKey UDI %s, %s\n", udi, time.Now().UTC().Format(time.RFC3339))
+
+	if opts.Format == "vendorkey" {
+		key := vendorkey.PubKey{
+			Tag:    appBin.Tag,
+			AppBin: appBin,
+			Start:  start,
+			End:    end,
+		}
+		copy(key.PubKey[:], pubKey)
+
+		entry := key.Entry()
+
+		var keys vendorkey.VendorKeys
+		if err := keys.FromString(comment+entry, appBins); err != nil {
+			return "", fmt.Errorf("vendor key entry doesn't parse: %w", err)
+		}
+
+		got, ok := keys.Keys[hex.EncodeToString(appHash[:])]
+		if len(keys.Keys) != 1 || !ok || got.PubKey != key.PubKey || got.Tag != key.Tag ||
+			!got.Start.Equal(start) || !got.End.Equal(end) {
+			return "", errors.New("vendor key entry doesn't parse to the same key")
+		}
+
+		return comment + entry, nil
+	}
+
+	key := sigsum.PubKey{
+		Name:    opts.Name,
+		Tag:     appBin.Tag,
+		AppHash: appHash,
+		Start:   start,
+		End:     end,
+	}
+	copy(key.Key[:], pubKey)
+
+	entry := key.Entry()
+
+	keys, err := sigsum.ParseKeys(strings.NewReader(comment+entry), appBins)
+	if err != nil {
+		return "", fmt.Errorf("sigsum configuration entry doesn't parse: %w", err)
+	}
+
+	got, ok := keys[key.Key]
+	if len(keys) != 1 || !ok || got.Name != key.Name || got.Tag != key.Tag || got.AppHash != key.AppHash ||
+		!got.Start.Equal(start) || !got.End.Equal(end) {
+		return "", errors.New("sigsum configuration entry doesn't parse to the same key")
+	}
+
+	return comment + entry, nil
+}
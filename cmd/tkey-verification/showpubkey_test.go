@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	"github.com/tillitis/tkey-verification/internal/appbins"
+)
+
+func TestPubkeyEntry(t *testing.T) {
+	pub := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize)).Public().(ed25519.PublicKey)
+	appBin := appbins.MustAppBins().List()[0]
+
+	tests := []struct {
+		opts  PubkeyOpts
+		lines int
+	}{
+		{PubkeyOpts{Format: "vendorkey"}, 2},
+		{PubkeyOpts{Format: "vendorkey", ValidFrom: "2025-01-01", ValidTo: "2030-01-01T00:00:00Z"}, 2},
+		{PubkeyOpts{Format: "sigsum-conf", Name: "tillitis-sigsum2", ValidFrom: "2025-01-01", ValidTo: "2030-01-01"}, 7},
+	}
+
+	for _, test := range tests {
+		start, end, err := checkPubkeyOpts(test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entry, err := pubkeyEntry(test.opts, start, end, pub, appBin, "0x0133708200000001(BE)")
+		if err != nil {
+			t.Fatalf("%+v: %v", test.opts, err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(entry, "\n"), "\n")
+		if len(lines) != test.lines || !strings.HasPrefix(lines[0], "# TKey UDI 0x0133708200000001(BE)") {
+			t.Fatalf("%+v: unexpected entry:\n%s", test.opts, entry)
+		}
+	}
+}
+
+func TestPubkeyOpts(t *testing.T) {
+	for _, opts := range []PubkeyOpts{
+		{Format: "yaml"},
+		{Format: "sigsum-conf", ValidFrom: "2025-01-01", ValidTo: "2030-01-01"},
+		{Format: "sigsum-conf", Name: "tillitis-sigsum2"},
+		{Format: "vendorkey", ValidFrom: "2025-01-01"},
+		{Format: "vendorkey", ValidFrom: "2030-01-01", ValidTo: "2025-01-01"},
+	} {
+		if _, _, err := checkPubkeyOpts(opts); err == nil {
+			t.Fatalf("%+v: expected error", opts)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+
+	"github.com/tillitis/tkey-verification/internal/data"
+	"github.com/tillitis/tkey-verification/internal/firmware"
+	"github.com/tillitis/tkey-verification/internal/revocation"
+	"github.com/tillitis/tkey-verification/internal/tkey"
+)
+
+// signRevocations signs the unsigned revocation list in listPath with
+// the TKey running the device app in binPath and outputs the signed
+// list on stdout.
+func signRevocations(binPath string, listPath string, dev Device, verbose bool) {
+	body, err := os.ReadFile(listPath)
+	if err != nil {
+		le.Printf("ReadFile: %v\n", err)
+		os.Exit(1)
+	}
+
+	tk, trusted := connectListSigner(binPath, dev, verbose)
+
+	exit := func(code int) {
+		tk.Close()
+		os.Exit(code)
+	}
+
+	signed, err := revocation.Sign(string(body), tk)
+	if err != nil {
+		le.Printf("Couldn't sign revocation list: %v\n", err)
+		exit(1)
+	}
+
+	// Check that we can use what we just signed.
+	var list revocation.List
+	if err = list.FromString(signed, trusted); err != nil {
+		le.Printf("Signed revocation list not verified: %v\n", err)
+		exit(1)
+	}
+
+	le.Printf("Signed revocation list with %d revoked keys follows on stdout:\n", len(list.Revocations))
+	fmt.Print(signed)
+
+	exit(0)
+}
+
+// signFirmwares signs the firmware database in dbPath, in the format
+// of FirmwaresConf, with the TKey running the device app in binPath
+// and outputs the signed database on stdout. It is signed with a
+// revocation signing key.
+func signFirmwares(binPath string, dbPath string, dev Device, verbose bool) {
+	body, err := os.ReadFile(dbPath)
+	if err != nil {
+		le.Printf("ReadFile: %v\n", err)
+		os.Exit(1)
+	}
+
+	tk, trusted := connectListSigner(binPath, dev, verbose)
+
+	exit := func(code int) {
+		tk.Close()
+		os.Exit(code)
+	}
+
+	signed, err := firmware.Sign(string(body), tk.Sign)
+	if err != nil {
+		le.Printf("Couldn't sign firmware database: %v\n", err)
+		exit(1)
+	}
+
+	// Check that we can use what we just signed.
+	firmwares, err := firmware.NewFirmwares()
+	if err != nil {
+		le.Printf("Found no usable firmwares: %v\n", err)
+		exit(1)
+	}
+
+	added, err := firmwares.Update(signed, trusted)
+	if err != nil {
+		le.Printf("Signed firmware database not usable: %v\n", err)
+		exit(1)
+	}
+
+	le.Printf("Signed firmware database with %d firmwares not embedded follows on stdout:\n", len(added))
+	fmt.Print(signed)
+
+	exit(0)
+}
+
+// connectListSigner connects to the TKey, loads the device app in
+// binPath and checks that it has an embedded revocation signing key.
+// It returns the TKey and all the revocation signing keys.
+func connectListSigner(binPath string, dev Device, verbose bool) (*tkey.TKey, [][ed25519.PublicKeySize]byte) {
+	trusted, err := revocation.ParseTrusted(data.RevocationPubKeys)
+	if err != nil {
+		le.Printf("Found no usable revocation signing keys: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(trusted) == 0 {
+		le.Printf("No revocation signing keys embedded, a signed list couldn't be used\n")
+		os.Exit(1)
+	}
+
+	content, err := os.ReadFile(binPath)
+	if err != nil {
+		le.Printf("ReadFile: %v\n", err)
+		os.Exit(1)
+	}
+
+	tk, err := tkey.NewTKey(dev.Path, dev.Speed, verbose)
+	if err != nil {
+		le.Printf("Couldn't connect to TKey: %v\n", err)
+		os.Exit(1)
+	}
+
+	pubKey, err := tk.LoadSigner(content)
+	if err != nil {
+		tk.Close()
+		le.Printf("LoadSigner: %v\n", err)
+		os.Exit(1)
+	}
+
+	found := false
+	for _, key := range trusted {
+		if bytes.Equal(key[:], pubKey) {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		tk.Close()
+		le.Printf("TKey pubkey %x is not an embedded revocation signing key\n", pubKey)
+		os.Exit(1)
+	}
+
+	return tk, trusted
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+	"github.com/tillitis/tkey-verification/internal/ssh"
+)
+
+// defaultExpiryWarning is how long before the submit key expires
+// serve-signer starts warning, if not configured.
+const defaultExpiryWarning = 30 * 24 * time.Hour
+
+// defaultSubmitMargin is how long before the submit key expires
+// serve-signer stops signing with it, if not configured, leaving time
+// for tkey-sigsum-submit to log the submissions.
+const defaultSubmitMargin = 7 * 24 * time.Hour
+
+// SubmitKey is a Sigsum submit key and what signs with it.
+type SubmitKey struct {
+	Key    sigsum.PubKey
+	Signer Signer
+}
+
+// SubmitKeys are the submit keys of serve-signer: the active key and
+// possibly its successor, taking over at Handover.
+type SubmitKeys struct {
+	Active   SubmitKey
+	Next     *SubmitKey
+	Handover time.Time
+	Warning  time.Duration // Warn this long before signing stops
+	Margin   time.Duration // Stop signing this long before a key expires
+}
+
+// At returns the submit key to sign with at t. It is an error if the
+// key isn't valid at t, or expires within the margin, since the
+// witness cosignatures of the submission, made when it is logged
+// later, would then be outside of the key's lifetime.
+func (k *SubmitKeys) At(t time.Time) (SubmitKey, error) {
+	key := k.Active
+	if k.Next != nil && !t.Before(k.Handover) {
+		key = *k.Next
+	}
+
+	if key.Key.Revoked {
+		return key, fmt.Errorf("submit key %s is revoked: %s", key.Key.Name, key.Key.RevokeReason)
+	}
+
+	if t.Before(key.Key.Start) || !t.Before(key.Key.End) {
+		return key, fmt.Errorf("submit key %s is only valid %v - %v", key.Key.Name,
+			key.Key.Start.Format(time.RFC3339), key.Key.End.Format(time.RFC3339))
+	}
+
+	if !t.Before(k.last(key)) {
+		return key, fmt.Errorf("submit key %s expires %v, within the submission margin of %v", key.Key.Name,
+			key.Key.End.Format(time.RFC3339), k.Margin)
+	}
+
+	return key, nil
+}
+
+// last returns when to stop signing with key, the margin before it
+// expires.
+func (k *SubmitKeys) last(key SubmitKey) time.Time {
+	return key.Key.End.Add(-k.Margin)
+}
+
+// Expiring returns a warning if signing stops within the warning
+// period after t, because the last submit key expires, and an empty
+// string otherwise.
+func (k *SubmitKeys) Expiring(t time.Time) string {
+	key := k.Active
+	if k.Next != nil {
+		key = *k.Next
+	}
+
+	if left := k.last(key).Sub(t); left < k.Warning {
+		return fmt.Sprintf("submit key %s expires %v, signing stops in %v, with no successor",
+			key.Key.Name, key.Key.End.Format(time.RFC3339), left.Round(time.Minute))
+	}
+
+	return ""
+}
+
+// Check checks that the handover, if any, happens while both keys are
+// valid, outside of the submission margin, and that a key is valid at
+// t.
+func (k *SubmitKeys) Check(t time.Time) error {
+	if k.Margin < 0 {
+		return errors.New("negative submission margin")
+	}
+
+	if k.Next != nil {
+		if k.Next.Key.Key == k.Active.Key.Key {
+			return errors.New("nextkey is the same as activekey")
+		}
+
+		if k.Handover.Before(k.Next.Key.Start) || k.Handover.After(k.last(k.Active)) || !k.Handover.Before(k.last(*k.Next)) {
+			return fmt.Errorf("handover %v not when both %s (%v - %v) and %s (%v - %v) are valid, with a submission margin of %v",
+				k.Handover.Format(time.RFC3339),
+				k.Active.Key.Name, k.Active.Key.Start.Format(time.RFC3339), k.Active.Key.End.Format(time.RFC3339),
+				k.Next.Key.Name, k.Next.Key.Start.Format(time.RFC3339), k.Next.Key.End.Format(time.RFC3339),
+				k.Margin)
+		}
+	}
+
+	_, err := k.At(t)
+
+	return err
+}
+
+// submitKeysFromConfig returns the submit keys in log configured in
+// conf, without signers.
+func submitKeysFromConfig(conf ServerConfig, log sigsum.Log) (SubmitKeys, error) {
+	keys := SubmitKeys{
+		Warning: defaultExpiryWarning,
+		Margin:  defaultSubmitMargin,
+	}
+
+	authorities, err := certAuthorities(conf)
+	if err != nil {
+		return keys, err
+	}
+
+	active, err := embeddedSubmitKey(conf.ActiveKey, authorities, log)
+	if err != nil {
+		return keys, fmt.Errorf("activekey: %w", err)
+	}
+
+	keys.Active.Key = active
+
+	if conf.ExpiryWarning != "" {
+		if keys.Warning, err = time.ParseDuration(conf.ExpiryWarning); err != nil {
+			return keys, fmt.Errorf("expirywarning: %w", err)
+		}
+	}
+
+	if conf.SubmitMargin != "" {
+		if keys.Margin, err = time.ParseDuration(conf.SubmitMargin); err != nil {
+			return keys, fmt.Errorf("submitmargin: %w", err)
+		}
+	}
+
+	if conf.NextKey == "" {
+		if conf.Handover != "" || conf.NextPort != "" {
+			return keys, errors.New("handover and nextport need nextkey")
+		}
+
+		return keys, nil
+	}
+
+	// With two TKeys connected, the one found first might be either
+	if conf.NextPort == "" {
+		return keys, errors.New("nextkey needs nextport")
+	}
+
+	next, err := embeddedSubmitKey(conf.NextKey, authorities, log)
+	if err != nil {
+		return keys, fmt.Errorf("nextkey: %w", err)
+	}
+
+	keys.Next = &SubmitKey{Key: next}
+	keys.Handover = next.Start
+
+	if conf.Handover != "" {
+		if keys.Handover, err = parseTime(conf.Handover); err != nil {
+			return keys, fmt.Errorf("handover: %w", err)
+		}
+	}
+
+	return keys, nil
+}
+
+// certAuthorities returns the keys trusted to certify submit keys in
+// conf, if any.
+func certAuthorities(conf ServerConfig) ([]ssh.Key, error) {
+	authorities, err := ssh.ParseAuthorizedKeys([]byte(conf.CertAuthority))
+	if err != nil {
+		return nil, fmt.Errorf("certauthority: %w", err)
+	}
+
+	return authorities, nil
+}
+
+// embeddedSubmitKey returns the submit key in log with the public key
+// in line, in the OpenSSH format. It may be a certificate of the key,
+// by one of authorities and with the name of the key as principal.
+// The key is then only valid while the certificate is.
+func embeddedSubmitKey(line string, authorities []ssh.Key, log sigsum.Log) (sigsum.PubKey, error) {
+	configKey, err := ssh.ParseKey(line)
+	if err != nil {
+		return sigsum.PubKey{}, fmt.Errorf("%w", err)
+	}
+
+	pub, err := configKey.Ed25519()
+	if err != nil {
+		return sigsum.PubKey{}, fmt.Errorf("%s: %w", configKey.Fingerprint(), err)
+	}
+
+	key, ok := log.Keys[pub]
+	if !ok {
+		return sigsum.PubKey{}, fmt.Errorf("%s isn't an embedded submit key", configKey.Fingerprint())
+	}
+
+	if _, ok := configKey.Certificate(); !ok {
+		return key, nil
+	}
+
+	if len(authorities) == 0 {
+		return sigsum.PubKey{}, fmt.Errorf("certificate %s needs certauthority", configKey.Fingerprint())
+	}
+
+	if err = configKey.CheckCertificate(authorities, key.Name); err != nil {
+		return sigsum.PubKey{}, fmt.Errorf("%w", err)
+	}
+
+	from, to := configKey.Validity()
+	if from.After(key.Start) {
+		key.Start = from
+	}
+
+	if !to.IsZero() && to.Before(key.End) {
+		key.End = to
+	}
+
+	return key, nil
+}
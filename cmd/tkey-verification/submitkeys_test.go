@@ -0,0 +1,205 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+	"github.com/tillitis/tkey-verification/internal/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestSubmitKeys(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	active := sigsum.PubKey{Name: "tillitis-sigsum1", Key: [32]byte{1}, Start: date(2025, 1, 1), End: date(2027, 1, 1)}
+	next := sigsum.PubKey{Name: "tillitis-sigsum2", Key: [32]byte{2}, Start: date(2026, 6, 1), End: date(2028, 1, 1)}
+
+	keys := SubmitKeys{
+		Active:   SubmitKey{Key: active},
+		Next:     &SubmitKey{Key: next},
+		Handover: date(2026, 9, 1),
+		Warning:  defaultExpiryWarning,
+		Margin:   defaultSubmitMargin,
+	}
+
+	if err := keys.Check(date(2026, 1, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at   time.Time
+		name string // Key to sign with, empty if none
+	}{
+		{date(2024, 12, 31), ""},
+		{date(2026, 8, 31), "tillitis-sigsum1"},
+		{date(2026, 9, 1), "tillitis-sigsum2"},
+		{date(2027, 12, 24), "tillitis-sigsum2"},
+		{date(2027, 12, 25), ""}, // Within the submission margin
+		{date(2028, 1, 1), ""},
+	}
+
+	for _, test := range tests {
+		key, err := keys.At(test.at)
+		if test.name == "" {
+			if err == nil {
+				t.Fatalf("%v: expected error, got %s", test.at, key.Key.Name)
+			}
+
+			continue
+		}
+
+		if err != nil || key.Key.Name != test.name {
+			t.Fatalf("%v: expected %s, got %s: %v", test.at, test.name, key.Key.Name, err)
+		}
+	}
+
+	// Only the last key counts
+	if w := keys.Expiring(date(2026, 12, 15)); w != "" {
+		t.Fatalf("unexpected warning %q", w)
+	}
+
+	if w := keys.Expiring(date(2027, 12, 15)); !strings.Contains(w, "tillitis-sigsum2") {
+		t.Fatalf("expected warning for tillitis-sigsum2, got %q", w)
+	}
+
+	// Handover when only one of the keys is valid, or within the
+	// submission margin of activekey
+	for _, handover := range []time.Time{date(2026, 5, 31), date(2026, 12, 26), date(2027, 1, 2)} {
+		keys.Handover = handover
+		if err := keys.Check(date(2026, 1, 1)); err == nil {
+			t.Fatalf("handover %v: expected error", handover)
+		}
+	}
+
+	// Handover after nextkey is no longer used
+	keys.Active.Key.End = date(2029, 1, 1)
+	keys.Handover = date(2028, 1, 1)
+	if err := keys.Check(date(2026, 1, 1)); err == nil {
+		t.Fatal("handover after nextkey expires: expected error")
+	}
+
+	keys.Active.Key.End = date(2027, 1, 1)
+	keys.Handover = date(2026, 9, 1)
+	keys.Active.Key.Revoked = true
+	if _, err := keys.At(date(2026, 1, 1)); err == nil {
+		t.Fatal("expected error for revoked key")
+	}
+}
+
+func TestSubmitKeysFromConfigNextPort(t *testing.T) {
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIFDZoSX1HYX/ofsSARva4F054DzaKjXQ2vMHcHLaq7sQ sigsum key"
+
+	configKey, err := ssh.ParseKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := configKey.Ed25519()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := sigsum.Log{Keys: map[[32]byte]sigsum.PubKey{pub: {Name: "tillitis-sigsum-test", Key: pub}}}
+
+	_, err = submitKeysFromConfig(ServerConfig{ActiveKey: key, NextKey: key}, log)
+	if err == nil || !strings.Contains(err.Error(), "nextport") {
+		t.Fatalf("expected nextport error, got %v", err)
+	}
+}
+
+func TestSubmitKeyCertificate(t *testing.T) {
+	newKey := func(seed byte) (ed25519.PrivateKey, ssh.PublicKey) {
+		priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+
+		var pub ssh.PublicKey
+		copy(pub[:], priv.Public().(ed25519.PublicKey))
+
+		return priv, pub
+	}
+
+	caPriv, caPub := newKey(1)
+	_, otherCA := newKey(2)
+	_, pub := newKey(3)
+
+	ca, err := ssh.NewSigner(caPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certify := func(principals ...string) string {
+		cert := &gossh.Certificate{
+			Key:             ssh.NewKey(pub, "").Pub,
+			CertType:        gossh.UserCert,
+			KeyId:           "tillitis-sigsum1",
+			ValidPrincipals: principals,
+			ValidAfter:      uint64(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC).Unix()),
+			ValidBefore:     uint64(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC).Unix()),
+		}
+
+		if err := cert.SignCert(rand.Reader, ca); err != nil {
+			t.Fatal(err)
+		}
+
+		return ssh.Key{Pub: cert, Comment: "sigsum key"}.String()
+	}
+
+	log := sigsum.Log{Keys: map[[32]byte]sigsum.PubKey{pub: {
+		Name:  "tillitis-sigsum1",
+		Key:   pub,
+		Start: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+	}}}
+
+	authority := ssh.NewKey(caPub, "submit key CA").String()
+
+	keys, err := submitKeysFromConfig(ServerConfig{ActiveKey: certify("tillitis-sigsum1"), CertAuthority: authority}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only valid while the certificate is
+	if _, err = keys.At(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatal("expected error before the certificate is valid")
+	}
+
+	if _, err = keys.At(time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = keys.At(time.Date(2026, 5, 30, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatal("expected error when the certificate expires within the margin")
+	}
+
+	tests := []struct {
+		name string
+		conf ServerConfig
+	}{
+		{"no authority", ServerConfig{ActiveKey: certify("tillitis-sigsum1")}},
+		{"other authority", ServerConfig{ActiveKey: certify("tillitis-sigsum1"), CertAuthority: ssh.NewKey(otherCA, "").String()}},
+		{"other principal", ServerConfig{ActiveKey: certify("tillitis-sigsum2"), CertAuthority: authority}},
+		{"any principal", ServerConfig{ActiveKey: certify(), CertAuthority: authority}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := submitKeysFromConfig(test.conf, log); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	// A plain key needs no authority
+	if _, err = submitKeysFromConfig(ServerConfig{ActiveKey: ssh.NewKey(pub, "sigsum key").String()}, log); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -4,13 +4,16 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/spf13/pflag"
 	"github.com/tillitis/tkey-verification/internal/appbins"
+	"github.com/tillitis/tkey-verification/internal/data"
 	"github.com/tillitis/tkey-verification/internal/firmware"
+	"github.com/tillitis/tkey-verification/internal/revocation"
 	"github.com/tillitis/tkey-verification/internal/sigsum"
 	"github.com/tillitis/tkey-verification/internal/vendorkey"
 )
@@ -40,19 +43,40 @@ func builtWith() {
 		os.Exit(1)
 	}
 
+	trusted, err := revocation.ParseTrusted(data.RevocationPubKeys)
+	if err != nil {
+		le.Printf("Found no usable revocation signing keys: %v\n", err)
+		os.Exit(1)
+	}
+
+	revocationKeys := []string{}
+	for _, key := range trusted {
+		revocationKeys = append(revocationKeys, hex.EncodeToString(key[:]))
+	}
+
+	var apps string
+	for _, appBin := range appBins.List() {
+		hash, manifest := appBin.Hash(), appBin.Manifest.Hash()
+		apps += fmt.Sprintf("  - %s\n    Hash: %0x…\n    Manifest: %0x…\n%s",
+			appBin.Tag, hash[:16], manifest[:16], appBin.Manifest.String("    "))
+	}
+
 	fmt.Printf(`Built with:
-Supported verisigner-app tags:
-  %s
+Supported verisigner-apps:
+%s
 Known vendor signing keys:
   %s
+Known revocation signing keys:
+  %s
 
 Known Sigsum configuration:
 %s
 Known firmwares:
   %s
 `,
-		strings.Join(appBins.Tags(), " \n  "),
+		apps,
 		vendorKeys.String(),
+		strings.Join(revocationKeys, " \n  "),
 		log.String(),
 		strings.Join(firmwares.List(), " \n  "))
 
@@ -71,7 +95,46 @@ Commands:
 		This includes public key, app tag, and app hash in the right format.
 
 		Use the flag --app to specify the path o the desired app to use, i.e.,
-		tkey-verification show-pubkey --app /path/to/app`, progname)
+		tkey-verification show-pubkey --app /path/to/app
+		Use --format sigsum-conf or vendorkey to output an entry ready to
+		paste into SigsumConf or VendorPubKeys, i.e.,
+		tkey-verification show-pubkey --app /path/to/app \
+		  --format sigsum-conf --name NAME --valid-from 2026-01-01 \
+		  --valid-to 2028-01-01
+
+  key-ceremony	Introduce a new Sigsum submit key. Asks for the vendor TKey
+		for the new key, then the one with the active key, and writes
+		a transcript signed by both and the SigsumConf entry, i.e.,
+		tkey-verification key-ceremony --app /path/to/app \
+		  --name NAME --valid-from 2026-01-01 --valid-to 2028-01-01 \
+		  --config tkey-verification.yaml --out-dir ceremony
+
+  sign-revocations Sign a list of revoked keys with a revocation signing key.
+		The signed list is output on stdout, i.e.,
+		tkey-verification sign-revocations --app /path/to/app \
+		  --revocation-list revocations.txt
+
+  sign-firmwares Sign a firmware database update with a revocation
+		signing key. The signed database is output on stdout, i.e.,
+		tkey-verification sign-firmwares --app /path/to/app \
+		  --firmware-db firmwares.txt
+
+  convert-verifications Convert verification files to the current format
+		version without changing what is verified, i.e.,
+		tkey-verification convert-verifications --in-dir old --out-dir new
+
+  inventory import|query|export Keep an inventory of provisioned TKeys.
+		import rebuilds the inventory from the directories provisioning
+		leaves files in, query lists TKeys and export outputs them as
+		CSV or JSON, i.e.,
+		tkey-verification inventory import --submissions-dir signatures \
+		  --verifications-dir verifications
+		tkey-verification inventory query --state pending
+
+  verify-apps	Rebuild the embedded device apps from source, as described
+		in the configuration file, and report which are reproducible
+		from their source, i.e.,
+		tkey-verification verify-apps --config verify-apps.yaml`, progname)
 
 	le.Printf("%s\n\nFlags:\n%s\n", desc, pflag.CommandLine.FlagUsagesWrapped(86))
 }
@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tillitis/tkey-verification/internal/appbins"
+)
+
+// ErrNotReproduced means a device app was rebuilt, but not to the
+// embedded binary.
+var ErrNotReproduced = errors.New("rebuilt app differs from embedded app")
+
+// The build engine, as in the podman target of the Makefile.
+const defaultContainerEngine = "podman"
+
+// AppReport is the result of rebuilding one embedded device app.
+type AppReport struct {
+	Tag      string
+	Embedded [sha512.Size]byte
+	Built    [sha512.Size]byte
+	Err      error // nil if reproduced
+	Skipped  bool  // No build description for the app
+}
+
+// verifyApps rebuilds every embedded device app described in the
+// configuration and reports which are reproducible.
+func verifyApps(conf AppsConfig, verbose bool) {
+	appBins, err := appbins.NewAppBins()
+	if err != nil {
+		le.Printf("Failed to init embedded device apps: %v\n", err)
+		os.Exit(1)
+	}
+
+	for tag := range conf.Apps {
+		if !hasTag(appBins, tag) {
+			le.Printf("No embedded device app %s, have: %s\n", tag, strings.Join(appBins.Tags(), " "))
+			os.Exit(2)
+		}
+	}
+
+	failed := 0
+
+	for _, r := range rebuildApps(appBins, conf, verbose) {
+		switch {
+		case r.Skipped:
+			fmt.Printf("%-28s not checked, no build description\n", r.Tag)
+		case r.Err != nil:
+			fmt.Printf("%-28s NOT reproducible: %v\n", r.Tag, r.Err)
+			failed++
+		default:
+			fmt.Printf("%-28s reproducible %0x…\n", r.Tag, r.Built[:16])
+		}
+	}
+
+	if failed != 0 {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+func hasTag(appBins appbins.AppBins, tag string) bool {
+	for _, appBin := range appBins.Bins {
+		if appBin.Tag == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rebuildApps rebuilds the apps in appBins with a build description
+// in conf, in tag order.
+func rebuildApps(appBins appbins.AppBins, conf AppsConfig, verbose bool) []AppReport {
+	var reports []AppReport
+
+	for _, appBin := range appBins.Bins {
+		r := AppReport{
+			Tag:      appBin.Tag,
+			Embedded: appBin.Hash(),
+		}
+
+		build, ok := conf.Apps[appBin.Tag]
+		if !ok {
+			r.Skipped = true
+			reports = append(reports, r)
+
+			continue
+		}
+
+		r.Built, r.Err = rebuildApp(appBin, build, verbose)
+		if r.Err == nil && r.Built != r.Embedded {
+			r.Err = fmt.Errorf("%w: built %0x…, embedded %0x…", ErrNotReproduced, r.Built[:16], r.Embedded[:16])
+		}
+
+		reports = append(reports, r)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Tag < reports[j].Tag
+	})
+
+	return reports
+}
+
+// rebuildApp builds the source of appBin as described by build and
+// returns the digest of what was built.
+func rebuildApp(appBin appbins.AppBin, build AppBuild, verbose bool) ([sha512.Size]byte, error) {
+	var digest [sha512.Size]byte
+
+	if build.Source == "" || build.Output == "" {
+		return digest, errors.New("build description needs source and output")
+	}
+
+	if !filepath.IsLocal(build.Output) {
+		return digest, fmt.Errorf("output %s must be within the source", build.Output)
+	}
+
+	source, err := filepath.Abs(build.Source)
+	if err != nil {
+		return digest, fmt.Errorf("%w", err)
+	}
+
+	if err = checkSource(source, appBin.Manifest); err != nil {
+		return digest, err
+	}
+
+	// Remove any earlier build so a stale app can't pass for
+	// this one.
+	output := filepath.Join(source, build.Output)
+	if err = os.Remove(output); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return digest, fmt.Errorf("couldn't remove earlier build: %w", err)
+	}
+
+	cmd := buildCommand(source, build)
+
+	var buildLog bytes.Buffer
+	cmd.Stdout = &buildLog
+	cmd.Stderr = &buildLog
+
+	if verbose {
+		le.Printf("Building %s in %s: %s\n", appBin.Tag, source, strings.Join(cmd.Args, " "))
+	}
+
+	err = cmd.Run()
+	if verbose || err != nil {
+		le.Printf("%s", buildLog.String())
+	}
+	if err != nil {
+		return digest, fmt.Errorf("build failed: %w", err)
+	}
+
+	if _, err = os.Stat(output); errors.Is(err, os.ErrNotExist) {
+		return digest, fmt.Errorf("build didn't create %s", build.Output)
+	}
+
+	bin, err := os.ReadFile(output)
+	if err != nil {
+		return digest, fmt.Errorf("couldn't read built app: %w", err)
+	}
+
+	return sha512.Sum512(bin), nil
+}
+
+// buildCommand returns the command to run build in the source
+// directory, in a container if build has one, else with the
+// toolchain first in PATH.
+func buildCommand(source string, build AppBuild) *exec.Cmd {
+	script := build.Build
+	if script == "" {
+		script = "make"
+	}
+
+	if build.Container != "" {
+		engine := build.Engine
+		if engine == "" {
+			engine = defaultContainerEngine
+		}
+
+		return exec.Command(engine, "run", "--rm", // #nosec G204
+			"--mount", fmt.Sprintf("type=bind,source=%s,target=/src", source),
+			"-w", "/src", build.Container, "sh", "-c", script)
+	}
+
+	cmd := exec.Command("sh", "-c", script) // #nosec G204
+	cmd.Dir = source
+
+	if build.Toolchain != "" {
+		cmd.Env = append(os.Environ(), "PATH="+build.Toolchain+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+
+	return cmd
+}
+
+// checkSource checks that source is a clean git checkout of the tag
+// in the manifest of the embedded app, and of its commit, if known.
+// Files not tracked by git, like earlier builds, are allowed.
+func checkSource(source string, m appbins.Manifest) error {
+	head, err := gitOutput(source, "rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("source isn't a git checkout of %s: %w", m.Tag, err)
+	}
+
+	tagged, err := gitOutput(source, "rev-parse", "--verify", "--quiet", "refs/tags/"+m.Tag+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("source has no tag %s", m.Tag)
+	}
+
+	if head != tagged {
+		return fmt.Errorf("source is at %s, but the app was built from %s at %s", head, m.Tag, tagged)
+	}
+
+	if m.Commit != "" && head != m.Commit {
+		return fmt.Errorf("source is at %s, but the app was built from commit %s", head, m.Commit)
+	}
+
+	status, err := gitOutput(source, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return err
+	}
+
+	if status != "" {
+		return fmt.Errorf("source has changes not committed in %s", m.Tag)
+	}
+
+	return nil
+}
+
+// gitOutput runs git with args in dir and returns its trimmed
+// output.
+func gitOutput(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output() // #nosec G204
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tillitis/tkey-verification/internal/appbins"
+)
+
+func TestRebuildApps(t *testing.T) {
+	appBins := appbins.MustAppBins()
+
+	// A "source" that builds to the embedded signer, and one
+	// that builds to something else.
+	var signer appbins.AppBin
+	for _, appBin := range appBins.Bins {
+		if appBin.Tag == "signer-v1.0.1" {
+			signer = appBin
+		}
+	}
+
+	// Checkouts of the tags in the manifests.
+	good := t.TempDir()
+	if err := os.WriteFile(filepath.Join(good, "src"), signer.Bin, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	gitRepo(t, good, "v1.0.1")
+
+	bad := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bad, "src"), []byte("other"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	gitRepo(t, bad, "tkey-verification1")
+
+	conf := AppsConfig{
+		Apps: map[string]AppBuild{
+			"signer-v1.0.1":              {Source: good, Build: "cp src app.bin", Output: "app.bin"},
+			"signer-tkey-verification-1": {Source: bad, Build: "cp src app.bin", Output: "app.bin"},
+			// Built from another tag.
+			"verisigner-v0.0.3": {Source: good, Build: "cp src app.bin", Output: "app.bin"},
+		},
+	}
+
+	reports := rebuildApps(appBins, conf, false)
+	if len(reports) != 3 {
+		t.Fatalf("expected 3 reports, got %d", len(reports))
+	}
+
+	for _, r := range reports {
+		switch r.Tag {
+		case "signer-v1.0.1":
+			if r.Err != nil || r.Built != r.Embedded {
+				t.Fatalf("%s: expected reproducible, got %v", r.Tag, r.Err)
+			}
+		case "signer-tkey-verification-1":
+			if !errors.Is(r.Err, ErrNotReproduced) {
+				t.Fatalf("%s: expected not reproduced, got %v", r.Tag, r.Err)
+			}
+		case "verisigner-v0.0.3":
+			assertErrorMsgStartsWith(t, r.Err, "source has no tag verisigner-v0.0.3")
+		}
+	}
+
+	// A build that doesn't create the output must not pass off an
+	// earlier build as its own.
+	if err := os.WriteFile(filepath.Join(good, "app.bin"), signer.Bin, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := AppsConfig{
+		Apps: map[string]AppBuild{
+			"signer-v1.0.1": {Source: good, Build: "true", Output: "app.bin"},
+		},
+	}
+
+	for _, r := range rebuildApps(appBins, stale, false) {
+		if r.Tag == "signer-v1.0.1" {
+			assertErrorMsgStartsWith(t, r.Err, "build didn't create app.bin")
+		}
+	}
+
+	stale.Apps["signer-v1.0.1"] = AppBuild{Source: good, Build: "cp src app.bin", Output: "../app.bin"}
+
+	for _, r := range rebuildApps(appBins, stale, false) {
+		if r.Tag == "signer-v1.0.1" {
+			assertErrorMsgStartsWith(t, r.Err, "output ../app.bin must be within the source")
+		}
+	}
+
+	delete(conf.Apps, "signer-tkey-verification-1")
+
+	for _, r := range rebuildApps(appBins, conf, false) {
+		if r.Tag == "signer-tkey-verification-1" && !r.Skipped {
+			t.Fatalf("%s: expected skipped", r.Tag)
+		}
+	}
+}
+
+func TestCheckSource(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "src"), []byte("source"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkSource(dir, appbins.Manifest{Tag: "v1.0.0"}); err == nil {
+		t.Fatal("expected error for a directory that isn't a git checkout")
+	}
+
+	head := gitRepo(t, dir, "v1.0.0")
+
+	if err := checkSource(dir, appbins.Manifest{Tag: "v1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkSource(dir, appbins.Manifest{Tag: "v1.0.0", Commit: head}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertErrorMsgStartsWith(t, checkSource(dir, appbins.Manifest{Tag: "v1.0.0", Commit: strings.Repeat("0", 40)}),
+		"source is at "+head+", but the app was built from commit 0000")
+	assertErrorMsgStartsWith(t, checkSource(dir, appbins.Manifest{Tag: "v2.0.0"}), "source has no tag v2.0.0")
+
+	// Untracked files, like builds, are fine, but not changes.
+	if err := os.WriteFile(filepath.Join(dir, "app.bin"), []byte("app"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkSource(dir, appbins.Manifest{Tag: "v1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "src"), []byte("changed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	assertErrorMsgStartsWith(t, checkSource(dir, appbins.Manifest{Tag: "v1.0.0"}), "source has changes not committed in v1.0.0")
+
+	// A commit after the tag.
+	git(t, dir, "commit", "-q", "-a", "-m", "later")
+
+	assertErrorMsgStartsWith(t, checkSource(dir, appbins.Manifest{Tag: "v1.0.0"}), "source is at ")
+}
+
+// gitRepo commits the files in dir to a new git repository, tags the
+// commit with tag and returns the commit.
+func gitRepo(t *testing.T, dir string, tag string) string {
+	t.Helper()
+
+	git(t, dir, "init", "-q")
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "test")
+	git(t, dir, "tag", tag)
+
+	head, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return head
+}
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com",
+		"-c", "commit.gpgsign=false", "-c", "tag.gpgsign=false"}, args...)
+
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+func assertErrorMsgStartsWith(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if err == nil {
+		t.Log("Expected error")
+		t.Fail()
+		return
+	}
+
+	if !strings.HasPrefix(err.Error(), want) {
+		t.Logf("Unexpected error '%v', should start with '%v'", err, want)
+		t.Fail()
+	}
+}
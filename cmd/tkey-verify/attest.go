@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/util"
+	tkeyverify "github.com/tillitis/tkey-verification/pkg/verify"
+)
+
+// writeAttestation writes an attestation of the verification in res
+// to fn, signed with sign, the signer device app of the verified
+// TKey.
+func writeAttestation(fn string, res tkeyverify.Result, sign func([]byte) ([]byte, error)) error {
+	a := tkeyverify.NewAttestation(res, fmt.Sprintf("%s %s", progname, util.Version(version)), time.Now())
+
+	if err := a.Sign(sign); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if err := a.ToFile(fn); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// checkAttestation checks the attestation in fn, written by
+// --attest, against the embedded trust store and the revocation list
+// from src.
+func checkAttestation(fn string, src Source, useSigsum bool, verbose bool) {
+	var a tkeyverify.Attestation
+
+	if err := a.FromFile(fn); err != nil {
+		parseFailure(err.Error())
+		os.Exit(1)
+	}
+
+	trust, err := tkeyverify.EmbeddedTrustStore()
+	if err != nil {
+		report(err)
+		os.Exit(1)
+	}
+
+	revocations, err := loadRevocations(src, verbose)
+	applyRevocations(&trust, revocations, err, verbose)
+
+	verifier := tkeyverify.New(trust, nil)
+	verifier.RequireSigsum = useSigsum
+
+	res, err := verifier.CheckAttestation(a)
+	if err != nil {
+		report(err)
+		os.Exit(1)
+	}
+
+	le.Printf("TKey UDI: %s\n", res.UDI.String())
+	le.Printf("Verified by %s at %s with %d challenges\n", a.Tool, a.Timestamp, len(res.Transcript))
+
+	if verbose {
+		le.Printf("Verification data was created %s\n", res.Created)
+	}
+
+	fmt.Printf("Attestation is valid, verified with %s\n", res.Method)
+	os.Exit(0)
+}
@@ -0,0 +1,290 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/appbins"
+	"github.com/tillitis/tkey-verification/internal/bundle"
+	"github.com/tillitis/tkey-verification/internal/fetch"
+	"github.com/tillitis/tkey-verification/internal/firmware"
+	"github.com/tillitis/tkey-verification/internal/revocation"
+	"github.com/tillitis/tkey-verification/internal/tkey"
+	"github.com/tillitis/tkey-verification/internal/verification"
+	tkeyverify "github.com/tillitis/tkey-verification/pkg/verify"
+)
+
+// firmwaresName is the name of the signed firmware database on the
+// verification server. It is signed by a revocation signing key.
+const firmwaresName = "firmwares"
+
+// exportRequest writes a request for a verification bundle for the
+// connected TKey to file fn.
+func exportRequest(dev Device, verbose bool, fn string) {
+	tk, err := tkey.NewTKey(dev.Path, dev.Speed, verbose)
+	if err != nil {
+		commFailed(err.Error())
+		os.Exit(1)
+	}
+
+	exit := func(code int) {
+		tk.Close()
+		os.Exit(code)
+	}
+
+	le.Printf("TKey UDI: %s\n", tk.Udi.String())
+
+	req := bundle.Request{
+		UDI: tk.Udi.Bytes,
+	}
+
+	if err = req.ToFile(fn); err != nil {
+		commFailed(err.Error())
+		exit(1)
+	}
+
+	le.Printf("Wrote bundle request to %s. Use \"%s fetch-bundle %s BUNDLE\" on a networked computer.\n", fn, progname, fn)
+
+	exit(0)
+}
+
+// fetchBundle reads the bundle request in reqFn, fetches all
+// verification data for the requested TKey from the mirrors in src,
+// and writes a bundle to bundleFn.
+func fetchBundle(reqFn string, bundleFn string, src Source, verbose bool) {
+	var req bundle.Request
+
+	if err := req.FromFile(reqFn); err != nil {
+		parseFailure(err.Error())
+		os.Exit(1)
+	}
+
+	b := bundle.Bundle{
+		UDI:     req.UDI,
+		Created: time.Now().UTC(),
+	}
+
+	var err error
+
+	b.Verification, b.BaseURL, err = src.Mirrors.Get(context.Background(), hex.EncodeToString(req.UDI))
+	if err != nil {
+		commFailed(err.Error())
+		os.Exit(1)
+	}
+
+	le.Printf("Verification data served by %s\n", b.BaseURL)
+
+	// Don't bundle something we can't use later.
+	var v verification.Verification
+	if err = v.FromJSON(b.Verification); err != nil {
+		parseFailure(err.Error())
+		os.Exit(1)
+	}
+
+	// Bind the provenance of the device app, as we know it, to
+	// the bundle.
+	appBins, err := appbins.NewAppBins()
+	if err != nil {
+		missing(fmt.Sprintf("no embedded device apps: %v", err))
+		os.Exit(1)
+	}
+
+	if appBin, ok := appBins.Bins[v.AppHash]; ok {
+		manifest := appBin.Manifest.Hash()
+		b.AppManifest = manifest[:]
+	}
+
+	trusted, err := trustedRevocationKeys()
+	if err == nil {
+		b.Revocations, err = fetchRevocations(src, verbose)
+	}
+
+	switch {
+	case errors.Is(err, errNoRevocations):
+		b.Revocations = nil
+		le.Printf("No revocation list in the bundle: %v\n", err)
+	case err != nil:
+		commFailed(err.Error())
+		os.Exit(1)
+	default:
+		var list revocation.List
+		if err = list.FromString(string(b.Revocations), trusted); err != nil {
+			parseFailure(err.Error())
+			os.Exit(1)
+		}
+
+		if err = checkRevocationAge(list, src.RevocationMaxAge); err != nil {
+			commFailed(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if len(trusted) != 0 {
+		b.Firmwares = fetchFirmwares(src, trusted, verbose)
+	}
+
+	if err = b.ToFile(bundleFn); err != nil {
+		commFailed(err.Error())
+		os.Exit(1)
+	}
+
+	le.Printf("Wrote verification bundle for UDI %s to %s\n", hex.EncodeToString(req.UDI), bundleFn)
+	os.Exit(0)
+}
+
+// fetchFirmwares fetches the signed firmware database from the
+// mirrors in src and checks that it can update the embedded one. It
+// returns nil if there is none.
+func fetchFirmwares(src Source, trusted [][ed25519.PublicKeySize]byte, verbose bool) []byte {
+	signed, mirror, err := src.Mirrors.Get(context.Background(), firmwaresName)
+	if errors.Is(err, fetch.ErrNotFound) {
+		le.Printf("No firmware database update available\n")
+		return nil
+	} else if err != nil {
+		commFailed(err.Error())
+		os.Exit(1)
+	}
+
+	// Don't bundle something we can't use later.
+	firmwares, err := firmware.NewFirmwares()
+	if err != nil {
+		missing(fmt.Sprintf("no firmware database: %v", err))
+		os.Exit(1)
+	}
+
+	added, err := firmwares.Update(string(signed), trusted)
+	if err != nil {
+		parseFailure(err.Error())
+		os.Exit(1)
+	}
+
+	if verbose {
+		le.Printf("Firmware database served by %s, with %d firmwares not embedded\n", mirror, len(added))
+	}
+
+	return signed
+}
+
+// updateFirmwares updates the firmwares in trust with the firmware
+// database in bundle b, if any.
+func updateFirmwares(b bundle.Bundle, trust *tkeyverify.TrustStore, verbose bool) {
+	if len(b.Firmwares) == 0 {
+		return
+	}
+
+	trusted, err := trustedRevocationKeys()
+	if errors.Is(err, errNoRevocationKeys) {
+		err = errors.New("no embedded keys to verify it")
+	}
+
+	if err != nil {
+		parseFailure(fmt.Sprintf("bundle has a firmware database update, but %v", err))
+		os.Exit(1)
+	}
+
+	added, err := trust.Firmwares.Update(string(b.Firmwares), trusted)
+	if err != nil {
+		parseFailure(err.Error())
+		os.Exit(1)
+	}
+
+	if verbose {
+		for _, hw := range added {
+			le.Printf("Firmware from the bundle: %s\n", hw)
+		}
+	}
+}
+
+// bundleRevocations returns the revocation list in bundle b, or
+// errNoRevocations if there is none. A list signed more than maxAge
+// ago is an error, see checkRevocationAge.
+func bundleRevocations(b bundle.Bundle, maxAge time.Duration) (revocation.List, error) {
+	var list revocation.List
+
+	if len(b.Revocations) == 0 {
+		return list, errNoRevocations
+	}
+
+	trusted, err := trustedRevocationKeys()
+	if err != nil {
+		return list, err
+	}
+
+	if err = list.FromString(string(b.Revocations), trusted); err != nil {
+		return list, fmt.Errorf("%w", err)
+	}
+
+	return list, checkRevocationAge(list, maxAge)
+}
+
+// checkBundleManifest checks that the device app in bundle b has the
+// same manifest in appBins as it had when the bundle was created.
+func checkBundleManifest(b bundle.Bundle, appBins appbins.AppBins) error {
+	if len(b.AppManifest) == 0 {
+		return nil
+	}
+
+	var v verification.Verification
+	if err := v.FromJSON(b.Verification); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	appBin, ok := appBins.Bins[v.AppHash]
+	if !ok {
+		// Reported by the verification.
+		return nil
+	}
+
+	if manifest := appBin.Manifest.Hash(); !bytes.Equal(manifest[:], b.AppManifest) {
+		return fmt.Errorf("device app %s has manifest %0x… here, but %0x… when the bundle was fetched",
+			appBin.Tag, manifest[:16], b.AppManifest[:min(16, len(b.AppManifest))])
+	}
+
+	return nil
+}
+
+// bundleFetcher gets verification data from a bundle.
+type bundleFetcher struct {
+	b  bundle.Bundle
+	fn string
+}
+
+func (f bundleFetcher) Fetch(_ context.Context, udiBE []byte) ([]byte, string, error) {
+	if !bytes.Equal(f.b.UDI, udiBE) {
+		return nil, "", fmt.Errorf("%w: bundle is for UDI %s, not this TKey", tkeyverify.ErrWrongUDI, hex.EncodeToString(f.b.UDI))
+	}
+
+	return f.b.Verification, f.fn, nil
+}
+
+// printLostFreshness describes what we can't know when verifying
+// from a bundle instead of fetching the data now.
+func printLostFreshness(b bundle.Bundle, revocations revocation.List, haveRevocations bool) {
+	age := time.Since(b.Created).Round(time.Hour)
+
+	le.Printf("Verifying offline from bundle fetched from %s at %s (%v ago). Not known:\n",
+		b.BaseURL, b.Created.Format(time.RFC3339), age)
+	le.Printf("  - Changes to the verification data after the bundle was fetched.\n")
+
+	if haveRevocations {
+		le.Printf("  - Keys revoked after %s, the time of the revocation list.\n",
+			revocations.Timestamp.Format(time.RFC3339))
+	} else {
+		le.Printf("  - Any revoked keys. The bundle contains no revocation list.\n")
+	}
+
+	if len(b.Firmwares) != 0 {
+		le.Printf("  - Firmwares added to the database after the bundle was fetched.\n")
+	} else {
+		le.Printf("  - Firmwares added to the database after this %s was built. The bundle contains no firmware database.\n", progname)
+	}
+}
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CacheMode decides how we use the cache of data fetched from the
+// verification server.
+type CacheMode int
+
+const (
+	// CacheAuto fetches and caches, falling back to the cache if
+	// fetching fails.
+	CacheAuto CacheMode = iota
+	// CachePrefer uses the cache if possible, otherwise fetches.
+	CachePrefer
+	// CacheRefresh always fetches and caches, never falls back
+	// to the cache.
+	CacheRefresh
+	// CacheOff never uses the cache.
+	CacheOff
+)
+
+func parseCacheMode(s string) (CacheMode, error) {
+	switch s {
+	case "auto":
+		return CacheAuto, nil
+	case "prefer":
+		return CachePrefer, nil
+	case "refresh":
+		return CacheRefresh, nil
+	case "off":
+		return CacheOff, nil
+	}
+
+	return CacheAuto, fmt.Errorf("unknown cache mode %v, use auto, prefer, refresh, or off", s)
+}
+
+// fallback returns true if the mode allows using the cache when
+// fetching fails.
+func (m CacheMode) fallback() bool {
+	return m == CacheAuto || m == CachePrefer
+}
+
+// cachePath returns the path to name in our directory in the
+// user's cache directory, typically $XDG_CACHE_HOME/tkey-verify.
+func cachePath(name string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	return filepath.Join(dir, progname, name), nil
+}
+
+// verificationCacheName returns the name of the cached verification
+// file for the TKey with udiHex.
+func verificationCacheName(udiHex string) string {
+	return filepath.Join("verifications", udiHex)
+}
+
+func readCache(name string) ([]byte, error) {
+	fn, err := cachePath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return content, nil
+}
+
+func writeCache(name string, content []byte) error {
+	fn, err := cachePath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fn), 0o700); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if err := os.WriteFile(fn, content, 0o600); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// cachingFetcher gets verification data from the mirrors in src,
+// using the cache as decided by src.Cache.
+//
+// Only verification data that has been used in a successful
+// verification is cached, so the cache never contains anything we
+// haven't already trusted once. See save.
+type cachingFetcher struct {
+	src     Source
+	verbose bool
+	fetched []byte // Data fetched from a mirror, not the cache
+}
+
+func (c *cachingFetcher) Fetch(ctx context.Context, udiBE []byte) ([]byte, string, error) {
+	name := verificationCacheName(hex.EncodeToString(udiBE))
+
+	var cached []byte
+	cacheErr := os.ErrNotExist
+	if c.src.Cache == CacheAuto || c.src.Cache == CachePrefer {
+		cached, cacheErr = readCache(name)
+	}
+
+	if c.src.Cache == CachePrefer && cacheErr == nil {
+		if c.verbose {
+			le.Printf("Using cached verification data\n")
+		}
+
+		return cached, "cache", nil
+	}
+
+	fetched, mirror, err := c.src.Mirrors.Get(ctx, hex.EncodeToString(udiBE))
+	if err != nil {
+		if cacheErr != nil || !c.src.Cache.fallback() {
+			return nil, "", err
+		}
+
+		le.Printf("Couldn't fetch verification data, using cached data: %v\n", err)
+
+		return cached, "cache", nil
+	}
+
+	le.Printf("Verification data served by %s\n", mirror)
+
+	c.fetched = fetched
+
+	return fetched, mirror, nil
+}
+
+// save caches the verification data of the TKey with udiBE, if it
+// was fetched from a mirror. Only call it after a successful
+// verification.
+func (c *cachingFetcher) save(udiBE []byte) {
+	if c.fetched == nil || c.src.Cache == CacheOff {
+		return
+	}
+
+	if err := writeCache(verificationCacheName(hex.EncodeToString(udiBE)), c.fetched); err != nil && c.verbose {
+		le.Printf("Couldn't cache verification data: %v\n", err)
+	}
+}
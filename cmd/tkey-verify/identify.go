@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tillitis/tkey-verification/internal/appbins"
+	"github.com/tillitis/tkey-verification/internal/firmware"
+	"github.com/tillitis/tkey-verification/internal/tkey"
+)
+
+// defaultIdentifyApp is the embedded device app used to ask the TKey
+// for firmware digests unless another is asked for.
+const defaultIdentifyApp = "verisigner-v0.0.3"
+
+// identifyFirmware is a diagnostic for TKeys where we don't know the
+// firmware. It:
+//
+//   - Loads an embedded device app on the TKey.
+//
+//   - Asks for the firmware digest for every size in the firmware
+//     database and for every size in sizeMin - sizeMax, if given.
+//
+//   - Reports which known firmwares, if any, match the digests, and
+//     otherwise the raw digests of the known sizes as candidate
+//     firmware database entries.
+//
+//   - Always reports the raw digests of the sizes in the range not
+//     already known, separately from the known sizes.
+func identifyFirmware(dev Device, verbose bool, appTag string, sizeMin int, sizeMax int) {
+	firmwares, err := firmware.NewFirmwares()
+	if err != nil {
+		missing(fmt.Sprintf("no usable firmwares: %v", err))
+		os.Exit(1)
+	}
+
+	appBins, err := appbins.NewAppBins()
+	if err != nil {
+		missing(fmt.Sprintf("no embedded device apps: %v", err))
+		os.Exit(1)
+	}
+
+	var appBin appbins.AppBin
+	var found bool
+
+	for _, bin := range appBins.Bins {
+		if bin.Tag == appTag {
+			appBin = bin
+			found = true
+
+			break
+		}
+	}
+
+	if !found {
+		notFound(fmt.Sprintf("embedded device app %v", appTag))
+		os.Exit(1)
+	}
+
+	if sizeMin != 0 || sizeMax != 0 {
+		if sizeMin < firmware.SizeMin || sizeMax > firmware.SizeMax || sizeMin > sizeMax {
+			le.Printf("Firmware size range must be within %d - %d\n", firmware.SizeMin, firmware.SizeMax)
+			os.Exit(2)
+		}
+	}
+
+	tk, err := tkey.NewTKey(dev.Path, dev.Speed, verbose)
+	if err != nil {
+		commFailed(err.Error())
+		os.Exit(1)
+	}
+
+	exit := func(code int) {
+		tk.Close()
+		os.Exit(code)
+	}
+
+	le.Printf("TKey UDI: %s\n", tk.Udi.String())
+
+	if expectedFW, err := firmwares.GetFirmware(tk.Udi); err == nil {
+		le.Printf("Expected firmware for this UDI: size:%d hash:%0x…\n", expectedFW.Size, expectedFW.Hash[:16])
+	} else {
+		le.Printf("No firmware known for this UDI\n")
+	}
+
+	if verbose {
+		le.Printf("Loading device app %s ...\n", appBin.String())
+	}
+
+	if _, err = tk.LoadSigner(appBin.Bin); err != nil {
+		commFailed(err.Error())
+		exit(1)
+	}
+
+	// Known sizes first, then the requested range.
+	sizes := firmwares.Sizes()
+	known := map[int]bool{}
+	for _, size := range sizes {
+		known[size] = true
+	}
+
+	if sizeMax != 0 {
+		for size := sizeMin; size <= sizeMax; size++ {
+			if !known[size] {
+				sizes = append(sizes, size)
+			}
+		}
+	}
+
+	var knownCandidates, rangeCandidates []firmware.Hardware
+	matches := 0
+
+	for _, size := range sizes {
+		fwHash, err := tk.GetFirmwareHash(size)
+		if err != nil {
+			commFailed(fmt.Sprintf("couldn't get firmware digest of size %d from TKey: %v", size, err))
+			exit(1)
+		}
+
+		for _, hw := range firmwares.Lookup(size, fwHash) {
+			matches++
+			fmt.Printf("MATCH: size:%d hash:%0x… known for VendorID:0x%04x ProductID:%d ProductRev:%d [0x%s]\n",
+				size, fwHash[:16], hw.VendorID, hw.ProductID, hw.ProductRev, hw.Udi)
+		}
+
+		hw, err := firmware.NewHardware(tk.Udi, size, fwHash)
+		if err != nil {
+			parseFailure(err.Error())
+			exit(1)
+		}
+
+		if known[size] {
+			knownCandidates = append(knownCandidates, hw)
+		} else {
+			rangeCandidates = append(rangeCandidates, hw)
+		}
+	}
+
+	if matches == 0 {
+		fmt.Printf("No known firmware matched.\n")
+	}
+
+	// The headers are comments so the output can be used in a
+	// firmware database as is.
+	if matches == 0 || verbose {
+		fmt.Printf("# Firmware digests of known sizes, as candidate firmware database entries:\n")
+		for _, hw := range knownCandidates {
+			fmt.Printf("%s\n", hw.String())
+		}
+	}
+
+	if len(rangeCandidates) > 0 {
+		fmt.Printf("# Firmware digests of sizes %d - %d not known, as candidate firmware database entries:\n", sizeMin, sizeMax)
+		for _, hw := range rangeCandidates {
+			fmt.Printf("%s\n", hw.String())
+		}
+	}
+
+	exit(0)
+}
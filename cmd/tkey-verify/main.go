@@ -7,16 +7,17 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
+	"github.com/tillitis/tkey-verification/internal/fetch"
 	"github.com/tillitis/tkey-verification/internal/util"
+	tkeyverify "github.com/tillitis/tkey-verification/pkg/verify"
 	"github.com/tillitis/tkeyclient"
 )
 
-const (
-	progname       = "tkey-verify"
-	defaultBaseURL = "https://tkey.tillitis.se/verify"
-)
+const progname = "tkey-verify"
 
 var version string
 
@@ -28,10 +29,38 @@ type Device struct {
 	Speed int
 }
 
+// Source describes where to get verification data from.
+type Source struct {
+	BaseDir        string
+	Mirrors        *tkeyverify.Mirrors // Verification server and mirrors
+	RevocationFile string
+	BundleFile     string
+	ProofFile      string // Sigsum proof to use instead of the one in the verification file
+	AppDir         string // Device apps to use if not embedded
+	Cache          CacheMode
+
+	// RevocationMaxAge is the maximum age of the signed timestamp
+	// of a revocation list. Zero means no limit.
+	RevocationMaxAge time.Duration
+}
+
+// Exports describes what to write after a successful verification.
+type Exports struct {
+	ProofDir      string // Sigsum proof, see exportProof
+	AttestFile    string // Attestation, see writeAttestation
+	PubkeyFile    string // Verified public key, see exportPubkey
+	StatementFile string // Signed public key statement, see exportPubkey
+}
+
 func main() {
 	var dev Device
-	var baseURL, baseDir string
-	var sigsum, verbose, showURLOnly, versionOnly, helpOnly bool
+	var src Source
+	var exports Exports
+	var identifyApp, requestFile, cacheMode string
+	var baseURLs []string
+	var fetchConf fetch.Config
+	var fwSizeMin, fwSizeMax, challenges int
+	var useSigsum, verbose, showURLOnly, identifyFW, versionOnly, helpOnly bool
 
 	pflag.CommandLine.SetOutput(os.Stderr)
 	pflag.CommandLine.SortFlags = false
@@ -43,12 +72,50 @@ func main() {
 		"Enable verbose output.")
 	pflag.BoolVarP(&showURLOnly, "show-url", "u", false,
 		"Only output the URL to the verification data that should be downloaded.")
-	pflag.StringVarP(&baseDir, "base-dir", "d", "",
+	pflag.StringVarP(&src.BaseDir, "base-dir", "d", "",
 		"Read verification data from a file located in `DIRECTORY` and named after the TKey UDI in hex, instead of from a URL. You can for example first use \"verify --show-url\" and download the verification file manually on some other computer, then transfer the file back and use \"verify --base-dir .\".")
-	pflag.StringVar(&baseURL, "base-url", defaultBaseURL,
-		"Set the base `URL` of verification server for fetching verification data.")
-	pflag.BoolVar(&sigsum, "sigsum", false,
+	pflag.StringArrayVar(&baseURLs, "base-url", nil,
+		"Set the base `URL` of verification server for fetching verification data. Repeat to give several mirrors, tried in order. Default is the embedded list of mirrors.")
+	pflag.BoolVar(&useSigsum, "sigsum", false,
 		"Demand a Sigsum proof in the verification file.")
+	pflag.IntVar(&challenges, "challenges", 1,
+		"Do `NUM` challenge/responses with the TKey to prove its identity.")
+	pflag.StringVar(&src.RevocationFile, "revocation-list", "",
+		"Read a signed list of revoked keys from `FILE`.")
+	pflag.StringVar(&cacheMode, "cache", "auto",
+		"Set how to use the local cache of fetched verification data with `MODE`: auto (fetch, fall back to cache if fetching fails), prefer (use cache if present, otherwise fetch), refresh (always fetch), or off.")
+	pflag.DurationVar(&src.RevocationMaxAge, "revocation-max-age", defaultRevocationMaxAge,
+		"Refuse a revocation list signed more than `DURATION` ago, wherever it came from. 0 means no limit.")
+	pflag.StringVar(&fetchConf.CAFile, "ca-file", "",
+		"Also trust the PEM CA certificates in `FILE` when fetching, for instance for a TLS intercepting proxy. Proxies are set with the HTTPS_PROXY and NO_PROXY environment variables.")
+	pflag.DurationVar(&fetchConf.Timeout, "timeout", fetch.DefaultTimeout,
+		"Set the timeout of each fetch attempt to `DURATION`.")
+	pflag.IntVar(&fetchConf.Retries, "retries", fetch.DefaultRetries,
+		"Retry failing fetches `NUM` times, with backoff.")
+	pflag.StringVar(&src.ProofFile, "proof", "",
+		"Use the Sigsum proof in `FILE`, in the standard Sigsum proof format, instead of the one in the verification data.")
+	pflag.StringVar(&src.AppDir, "app-dir", "",
+		"Also use the device apps in `DIRECTORY`, as .bin, .bin.sha512 and .bin.manifest files, if the verification data selects an app that isn't embedded.")
+	pflag.StringVar(&exports.ProofDir, "export-proof", "",
+		"After verifying a Sigsum proof, write the proof, the message, the leaf checksum, the submit key and the policy to `DIRECTORY`, for verifying with other Sigsum tools.")
+	pflag.StringVar(&exports.AttestFile, "attest", "",
+		"After a successful verification, write an attestation report signed by the TKey to `FILE`. Check it later with the check-attestation command.")
+	pflag.StringVar(&exports.PubkeyFile, "export-pubkey", "",
+		"After a successful verification, write the verified public key of the TKey to `FILE` in hex and as an OpenSSH authorized_keys line, also usable as an age recipient.")
+	pflag.StringVar(&exports.StatementFile, "pubkey-statement", "",
+		"After a successful verification, write a statement binding the public key to the TKey UDI, signed by the TKey, to `FILE`.")
+	pflag.StringVar(&requestFile, "export-request", "",
+		"Only write a request for a verification bundle to `FILE`, then exit. Turn it into a bundle with the fetch-bundle command on a networked computer.")
+	pflag.StringVar(&src.BundleFile, "bundle", "",
+		"Read all verification data from bundle `FILE` and verify without network.")
+	pflag.BoolVar(&identifyFW, "identify-firmware", false,
+		"Only identify the firmware of the TKey by asking for firmware digests of all known sizes, then exit.")
+	pflag.StringVar(&identifyApp, "identify-app", defaultIdentifyApp,
+		"Use embedded device app with `TAG` to get firmware digests (with --identify-firmware).")
+	pflag.IntVar(&fwSizeMin, "fw-size-min", 0,
+		"Also get firmware digests for all sizes from `SIZE` (with --identify-firmware).")
+	pflag.IntVar(&fwSizeMax, "fw-size-max", 0,
+		"Also get firmware digests for all sizes up to `SIZE` (with --identify-firmware).")
 	pflag.BoolVar(&versionOnly, "version", false, "Output version information.")
 	pflag.BoolVar(&helpOnly, "help", false, "Output this help.")
 	pflag.Usage = usage
@@ -64,20 +131,71 @@ func main() {
 		os.Exit(0)
 	}
 
-	if baseDir != "" && (showURLOnly || pflag.CommandLine.Lookup("base-url").Changed) {
+	var err error
+	if src.Cache, err = parseCacheMode(cacheMode); err != nil {
+		le.Printf("%v\n", err)
+		os.Exit(2)
+	}
+
+	// Zero means default to fetch.Config.
+	if fetchConf.Retries == 0 {
+		fetchConf.Retries = -1
+	}
+
+	// Defaults to the embedded list of mirrors.
+	if src.Mirrors, err = tkeyverify.NewMirrors(baseURLs, fetchConf); err != nil {
+		le.Printf("%v\n", err)
+		os.Exit(2)
+	}
+
+	src.Mirrors.Logf = le.Printf
+	src.Mirrors.Verbose = verbose
+
+	if pflag.NArg() > 0 {
+		switch {
+		case pflag.Arg(0) == "fetch-bundle" && pflag.NArg() == 3:
+			fetchBundle(pflag.Arg(1), pflag.Arg(2), src, verbose)
+		case pflag.Arg(0) == "check-attestation" && pflag.NArg() == 2:
+			checkAttestation(pflag.Arg(1), src, useSigsum, verbose)
+		case pflag.Arg(0) == "check-statement" && pflag.NArg() == 2:
+			checkStatement(pflag.Arg(1))
+		default:
+			le.Printf("Unexpected argument: %s\n\n", strings.Join(pflag.Args(), " "))
+			pflag.Usage()
+			os.Exit(2)
+		}
+	}
+
+	if src.BaseDir != "" && (showURLOnly || pflag.CommandLine.Lookup("base-url").Changed) {
 		le.Printf("Cannot combine --base-dir and --show-url/--base-url\n")
 		os.Exit(2)
 	}
 
+	if src.BundleFile != "" && (src.BaseDir != "" || src.RevocationFile != "" || showURLOnly || pflag.CommandLine.Lookup("base-url").Changed) {
+		le.Printf("Cannot combine --bundle and --base-dir/--base-url/--revocation-list/--show-url\n")
+		os.Exit(2)
+	}
+
+	if requestFile != "" {
+		exportRequest(dev, verbose, requestFile)
+	}
+
+	if identifyFW {
+		identifyFirmware(dev, verbose, identifyApp, fwSizeMin, fwSizeMax)
+	}
+
 	if showURLOnly {
-		verifyShowURL(dev, baseURL)
+		verifyShowURL(dev, src.Mirrors.BaseURLs)
 	}
 
-	verify(dev, verbose, baseDir, baseURL, sigsum)
+	verify(dev, verbose, src, useSigsum, challenges, exports)
 }
 
 func usage() {
 	desc := fmt.Sprintf(`Usage: %s [flags...]
+       %s fetch-bundle REQUEST BUNDLE [--base-url URL]
+       %s check-attestation ATTESTATION
+       %s check-statement STATEMENT
 
 Verify that a TKey is genuine by extracting the TKey UDI and using it
 to fetch the verification data, including tag and signature from the
@@ -87,7 +205,28 @@ the public key and verifying it using the vendor's signing public key.
 The flags --show-url and --base-dir can be used to show the URL for
 downloading the verification data on one machine, and verifying the
 TKey on another machine that lacks network, see more below.
-`, progname)
+
+For a complete verification without network, including the list of
+revoked keys, first use --export-request on the machine without
+network. On a networked machine, use the fetch-bundle command to turn
+the request into a bundle. Then transfer the bundle back and use
+--bundle.
+
+The flag --identify-firmware can be used to find out which firmware an
+unknown TKey is running. The digests of the firmware are reported,
+together with any known firmwares they match.
+
+The check-attestation command checks an attestation written by
+--attest, without the TKey. It is checked that the attestation is
+signed by the TKey, and the TKey identity is verified again from the
+verification data in the attestation.
+
+After a successful verification, --export-pubkey writes the verified
+public key of the TKey for use in other tools, like ssh and age.
+--pubkey-statement writes a statement binding the public key to the
+UDI, signed by the TKey. The check-statement command checks its
+signature.
+`, progname, progname, progname, progname)
 
 	le.Printf("%s\n\nFlags:\n%s\n", desc, pflag.CommandLine.FlagUsagesWrapped(86))
 }
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tillitis/tkey-verification/internal/data"
+	"github.com/tillitis/tkey-verification/internal/ssh"
+	sumcrypto "sigsum.org/sigsum-go/pkg/crypto"
+	"sigsum.org/sigsum-go/pkg/proof"
+)
+
+// Names of the files written by exportProof, apart from the ones
+// named after the UDI.
+const (
+	submitKeyName = "submit-key.pub"
+	policyName    = "policy"
+)
+
+// readProof reads a Sigsum proof in the standard sigsum-go ASCII
+// format from fn.
+func readProof(fn string) (proof.SigsumProof, error) {
+	var p proof.SigsumProof
+
+	content, err := os.ReadFile(fn)
+	if err != nil {
+		return p, fmt.Errorf("%w", err)
+	}
+
+	if err = p.FromASCII(bytes.NewBuffer(content)); err != nil {
+		return p, fmt.Errorf("couldn't parse proof: %w", err)
+	}
+
+	return p, nil
+}
+
+// exportProof writes the Sigsum proof p over the identity message
+// msg of the TKey with udiHex to dir, in the formats used by the
+// standard Sigsum tools:
+//
+//   - UDI: the message, the TKey identity.
+//
+//   - UDI.proof: the proof.
+//
+//   - UDI.checksum: the leaf checksum in hex, as logged.
+//
+//   - submit-key.pub: the submit key in OpenSSH format.
+//
+//   - policy: the Sigsum trust policy.
+//
+// It returns the command to verify the proof with sigsum-verify.
+func exportProof(dir string, udiHex string, msg []byte, p proof.SigsumProof, submitKey [ed25519.PublicKeySize]byte) (string, error) {
+	var proofASCII bytes.Buffer
+	if err := p.ToASCII(&proofASCII); err != nil {
+		return "", fmt.Errorf("couldn't convert proof to ASCII: %w", err)
+	}
+
+	// The Sigsum message is the digest of our message and the
+	// leaf checksum is the digest of the Sigsum message.
+	sigsumMsg := sumcrypto.HashBytes(msg)
+	checksum := sumcrypto.HashBytes(sigsumMsg[:])
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	msgPath := filepath.Join(dir, udiHex)
+	proofPath := msgPath + ".proof"
+	keyPath := filepath.Join(dir, submitKeyName)
+	policyPath := filepath.Join(dir, policyName)
+
+	files := []struct {
+		path    string
+		content []byte
+	}{
+		{msgPath, msg},
+		{proofPath, proofASCII.Bytes()},
+		{msgPath + ".checksum", []byte(hex.EncodeToString(checksum[:]) + "\n")},
+		{keyPath, []byte(ssh.FormatPublicEd25519(submitKey) + "\n")},
+		{policyPath, []byte(data.PolicyStr)},
+	}
+
+	for _, f := range files {
+		if err := os.WriteFile(f.path, f.content, 0o644); err != nil { // #nosec G306
+			return "", fmt.Errorf("%w", err)
+		}
+	}
+
+	return fmt.Sprintf("sigsum-verify -k %s -p %s %s < %s", keyPath, policyPath, proofPath, msgPath), nil
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/ssh"
+	"github.com/tillitis/tkey-verification/internal/util"
+	tkeyverify "github.com/tillitis/tkey-verification/pkg/verify"
+)
+
+// formatPubkey returns the verified public key in res as an
+// authorized_keys file: comments with the UDI and the key in hex,
+// then the key in OpenSSH format. age accepts the same file as a
+// recipients file.
+func formatPubkey(res tkeyverify.Result, now time.Time) (string, error) {
+	if len(res.PubKey) != ed25519.PublicKeySize {
+		return "", errors.New("no verified public key")
+	}
+
+	udi := hex.EncodeToString(res.UDI.Bytes)
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "# Signer device app %s on TKey UDI %s\n", res.AppTag, udi)
+	fmt.Fprintf(&buf, "# Verified genuine with %s by %s %s at %s\n",
+		res.Method, progname, util.Version(version), now.UTC().Format(time.RFC3339))
+	key := ssh.NewKey(ssh.PublicKey(res.PubKey), "tkey-"+udi)
+
+	fmt.Fprintf(&buf, "# Public key: %x\n", res.PubKey)
+	fmt.Fprintf(&buf, "# Fingerprint: %s\n", key.Fingerprint())
+	buf.WriteString(key.String() + "\n")
+
+	return buf.String(), nil
+}
+
+// exportPubkey writes the verified public key in res to fn, see
+// formatPubkey. If statementFn isn't empty, a statement binding the
+// key to the UDI, signed with sign, is written to it.
+func exportPubkey(fn string, statementFn string, res tkeyverify.Result, sign func([]byte) ([]byte, error)) error {
+	now := time.Now()
+
+	if fn != "" {
+		pub, err := formatPubkey(res, now)
+		if err != nil {
+			return err
+		}
+
+		if err = os.WriteFile(fn, []byte(pub), 0o644); err != nil { // #nosec G306
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	if statementFn != "" {
+		s := tkeyverify.NewStatement(res, fmt.Sprintf("%s %s", progname, util.Version(version)), now)
+
+		if err := s.Sign(sign); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		if err := s.ToFile(statementFn); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkStatement checks that the public key statement in fn is
+// signed by the key it states.
+func checkStatement(fn string) {
+	var s tkeyverify.Statement
+
+	if err := s.FromFile(fn); err != nil {
+		parseFailure(err.Error())
+		os.Exit(1)
+	}
+
+	if err := s.Verify(); err != nil {
+		verificationFailed(err.Error())
+		os.Exit(1)
+	}
+
+	le.Printf("TKey UDI: %s\n", s.UDI)
+	le.Printf("Verified with %s by %s at %s\n", s.Method, s.Tool, s.Timestamp)
+
+	fmt.Printf("Statement is signed by public key %s\n", s.PubKey)
+	os.Exit(0)
+}
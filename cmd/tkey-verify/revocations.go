@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/data"
+	"github.com/tillitis/tkey-verification/internal/fetch"
+	"github.com/tillitis/tkey-verification/internal/revocation"
+	tkeyverify "github.com/tillitis/tkey-verification/pkg/verify"
+)
+
+// revocationsName is the name of the revocation list, both on the
+// verification server and in a directory, next to the verification
+// files.
+const revocationsName = "revocations"
+
+// defaultRevocationMaxAge is the default of Source.RevocationMaxAge.
+// The vendor signs a new list more often than this.
+const defaultRevocationMaxAge = 30 * 24 * time.Hour
+
+var errNoRevocations = errors.New("no revocation list available")
+
+// errStaleRevocations means a revocation list was signed too long
+// ago. An old list might be replayed to hide later revocations.
+var errStaleRevocations = errors.New("revocation list too old")
+
+// errNoRevocationKeys means this build has no revocation signing
+// keys, see data.RevocationPubKeys.
+var errNoRevocationKeys = fmt.Errorf("%w: built without revocation signing keys", errNoRevocations)
+
+// loadRevocations gets the signed list of revoked keys. It is read
+// from, in order:
+//
+//   - revocationFile, if given.
+//
+//   - baseDir, if given.
+//
+//   - The verification server or its mirrors, next to the
+//     verification files. The list is cached for offline use.
+//
+//   - The cache, if the list couldn't be fetched.
+//
+// How the cache is used is decided by src.Cache, see CacheMode. A
+// cached list signed longer ago than src.RevocationMaxAge is never
+// used: with CachePrefer a new list is fetched, and falling back to
+// it is an error.
+//
+// It returns errNoRevocations if there is no list anywhere, or no
+// embedded keys to verify one with. Not reaching any mirror, with no
+// cached list to fall back on, also returns errNoRevocations, so
+// verification works offline. The caller must report it.
+//
+// A list signed longer ago than src.RevocationMaxAge is an error,
+// wherever it came from.
+func loadRevocations(src Source, verbose bool) (revocation.List, error) {
+	list, err := readRevocations(src, verbose)
+	if err != nil {
+		return list, err
+	}
+
+	return list, checkRevocationAge(list, src.RevocationMaxAge)
+}
+
+// checkRevocationAge returns errStaleRevocations if list was signed
+// longer ago than maxAge. Zero maxAge means no limit.
+func checkRevocationAge(list revocation.List, maxAge time.Duration) error {
+	if maxAge == 0 || time.Since(list.Timestamp) <= maxAge {
+		return nil
+	}
+
+	return fmt.Errorf("%w: signed %s, more than %v ago, see --revocation-max-age",
+		errStaleRevocations, list.Timestamp.Format(time.RFC3339), maxAge)
+}
+
+// readRevocations gets the revocation list for loadRevocations,
+// without checking its age.
+func readRevocations(src Source, verbose bool) (revocation.List, error) {
+	var list revocation.List
+
+	trusted, err := trustedRevocationKeys()
+	if errors.Is(err, errNoRevocationKeys) && src.RevocationFile != "" {
+		le.Printf("No revocation signing keys embedded, ignoring %s\n", src.RevocationFile)
+	}
+
+	if err != nil {
+		return list, err
+	}
+
+	if src.RevocationFile != "" {
+		return list, list.FromFile(src.RevocationFile, trusted)
+	}
+
+	if src.BaseDir != "" {
+		p := path.Join(src.BaseDir, revocationsName)
+		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+			return list, fmt.Errorf("%w in %s", errNoRevocations, src.BaseDir)
+		}
+
+		return list, list.FromFile(p, trusted)
+	}
+
+	// Even if we don't fall back to the cache, we use it to detect
+	// a rollback to an older list.
+	var cached revocation.List
+	cacheErr := errNoRevocations
+	if src.Cache != CacheOff {
+		var content []byte
+		if content, cacheErr = readCache(revocationsName); cacheErr == nil {
+			cacheErr = cached.FromString(string(content), trusted)
+		}
+	}
+
+	if src.Cache == CachePrefer && cacheErr == nil {
+		ageErr := checkRevocationAge(cached, src.RevocationMaxAge)
+		if ageErr == nil {
+			return cached, nil
+		}
+
+		if verbose {
+			le.Printf("Cached %v, fetching\n", ageErr)
+		}
+	}
+
+	fetched, err := fetchRevocations(src, verbose)
+	if err != nil {
+		if cacheErr != nil || !src.Cache.fallback() {
+			if errors.Is(err, errNoRevocations) {
+				return list, err
+			}
+
+			return list, fmt.Errorf("%w: couldn't fetch one, and no cached one to use: %v", errNoRevocations, err)
+		}
+
+		// The cached list is only as good as its signed timestamp.
+		if ageErr := checkRevocationAge(cached, src.RevocationMaxAge); ageErr != nil {
+			return cached, fmt.Errorf("couldn't fetch revocation list, and cached %w: %v", ageErr, err)
+		}
+
+		le.Printf("Couldn't fetch revocation list, using cached list from %s: %v\n",
+			cached.Timestamp.Format(time.RFC3339), err)
+
+		return cached, nil
+	}
+
+	if err = list.FromString(string(fetched), trusted); err != nil {
+		return list, err
+	}
+
+	// Never go back to an older list than we have already seen.
+	if cacheErr == nil && cached.Timestamp.After(list.Timestamp) {
+		le.Printf("Fetched revocation list from %s is older than cached list from %s, using cached list\n",
+			list.Timestamp.Format(time.RFC3339), cached.Timestamp.Format(time.RFC3339))
+
+		return cached, nil
+	}
+
+	if src.Cache != CacheOff {
+		if err = writeCache(revocationsName, fetched); err != nil && verbose {
+			le.Printf("Couldn't cache revocation list: %v\n", err)
+		}
+	}
+
+	return list, nil
+}
+
+// fetchRevocations gets the raw revocation list from the mirrors in
+// src.
+//
+// Only the verification server, the first embedded mirror, can tell
+// that there is no list: it returns errNoRevocations if that is
+// among the mirrors and none of them has one. Any mirror could hide
+// a list by answering that it doesn't have one, so otherwise that is
+// an error.
+func fetchRevocations(src Source, verbose bool) ([]byte, error) {
+	list, mirror, err := src.Mirrors.Get(context.Background(), revocationsName)
+	if errors.Is(err, fetch.ErrNotFound) {
+		// Get only says not found if every mirror said so.
+		server := tkeyverify.EmbeddedMirrors()
+		if len(server) > 0 && slices.Contains(src.Mirrors.BaseURLs, server[0]) {
+			return nil, fmt.Errorf("%w from %s", errNoRevocations, server[0])
+		}
+
+		return nil, fmt.Errorf("no mirror has a revocation list, but only the verification server can tell there is none: %w", err)
+	}
+
+	if err == nil && verbose {
+		le.Printf("Revocation list served by %s\n", mirror)
+	}
+
+	return list, err
+}
+
+// trustedRevocationKeys returns the embedded keys trusted to sign
+// revocation lists, or errNoRevocationKeys if there are none.
+func trustedRevocationKeys() ([][ed25519.PublicKeySize]byte, error) {
+	trusted, err := revocation.ParseTrusted(data.RevocationPubKeys)
+	if err != nil {
+		return nil, fmt.Errorf("no revocation signing keys: %w", err)
+	}
+
+	if len(trusted) == 0 {
+		return nil, errNoRevocationKeys
+	}
+
+	return trusted, nil
+}
@@ -4,28 +4,24 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
-	"path"
+	"time"
 
-	"github.com/tillitis/tkey-verification/internal/appbins"
-	"github.com/tillitis/tkey-verification/internal/data"
-	"github.com/tillitis/tkey-verification/internal/firmware"
-	"github.com/tillitis/tkey-verification/internal/sigsum"
+	"github.com/tillitis/tkey-verification/internal/bundle"
+	"github.com/tillitis/tkey-verification/internal/revocation"
 	"github.com/tillitis/tkey-verification/internal/ssh"
 	"github.com/tillitis/tkey-verification/internal/tkey"
-	"github.com/tillitis/tkey-verification/internal/util"
-	"github.com/tillitis/tkey-verification/internal/vendorkey"
-	"github.com/tillitis/tkey-verification/internal/verification"
-	"github.com/tillitis/tkeyclient"
+	tkeyverify "github.com/tillitis/tkey-verification/pkg/verify"
 )
 
 const verifyInfoURL = "https://www.tillitis.se/verify"
-const vendorID = 0x1337
 
-func verifyShowURL(dev Device, verifyBaseURL string) {
+func verifyShowURL(dev Device, verifyBaseURLs []string) {
 	// Connect to a TKey
 	tk, err := tkey.NewTKey(dev.Path, dev.Speed, false)
 	if err != nil {
@@ -40,51 +36,94 @@ func verifyShowURL(dev Device, verifyBaseURL string) {
 
 	le.Printf("TKey UDI: %s\n", tk.Udi.String())
 
+	verifyBaseURL := verifyBaseURLs[0]
 	verifyURL := fmt.Sprintf("%s/%s", verifyBaseURL, hex.EncodeToString(tk.Udi.Bytes))
 
+	le.Printf("Also download the revocation list from %s/%s and put it next to the verification file.\n",
+		verifyBaseURL, revocationsName)
+
+	for _, mirror := range verifyBaseURLs[1:] {
+		le.Printf("If unavailable, the same files are also at the mirror %s\n", mirror)
+	}
+
 	le.Printf("URL to verification data follows on stdout:\n")
 	fmt.Printf("%s\n", verifyURL)
 	exit(0)
 }
 
-// verify verifies a Tkey by:
-//
-//   - Connecting to the device, retrieving the UDI
-//
-//   - Fetching the verification file, indexed by the UDI.
-//
-//   - Load the signer indicated in the verification file, which
-//     returns the public key.
-//
-//   - Doing a challenge/response to prove the signer's identity
-//     against the public key we just got.
+// verify verifies a TKey with the tkey-verification library, see
+// package pkg/verify, and reports the result.
 //
-//   - Verify that the device has the expected firmware.
+// Verification data is read from the bundle or the directory in src,
+// or fetched from the mirrors. The revocation list is applied to the
+// trust store first.
 //
-//   - Recreates the vendor signed message.
+// The TKey has to answer the given number of challenges.
 //
-//   - Verify the vendor signature over the message.
-func verify(dev Device, verbose bool, baseDir string, verifyBaseURL string, useSigsum bool) {
-	var firmwares firmware.Firmwares
-
-	firmwares.MustDecodeString(data.FirmwaresConf)
-
-	appBins, err := appbins.NewAppBins()
+// What is set in exports is written after the verification: a
+// verified Sigsum proof, an attestation signed by the TKey, and the
+// verified public key.
+func verify(dev Device, verbose bool, src Source, useSigsum bool, challenges int, exports Exports) {
+	trust, err := tkeyverify.EmbeddedTrustStore()
 	if err != nil {
-		missing(fmt.Sprintf("no embedded device apps: %v", err))
+		report(err)
 		os.Exit(1)
 	}
 
-	var vendorKeys vendorkey.VendorKeys
-	if err = vendorKeys.FromEmbedded(appBins); err != nil {
-		missing(fmt.Sprintf("no vendor signing public key: %v", err))
-		os.Exit(1)
+	if src.AppDir != "" {
+		addAppDir(&trust, src.AppDir, verbose)
 	}
 
-	var log sigsum.Log
-	if err = log.FromEmbedded(); err != nil {
-		missing("Sigsum configuration missing")
-		os.Exit(1)
+	var fetcher tkeyverify.Fetcher
+	var cacher *cachingFetcher
+	var b bundle.Bundle
+	var revocations revocation.List
+
+	switch {
+	case src.BundleFile != "":
+		if err = b.FromFile(src.BundleFile); err != nil {
+			parseFailure(err.Error())
+			os.Exit(1)
+		}
+
+		if err = checkBundleManifest(b, trust.AppBins); err != nil {
+			missing(err.Error())
+			os.Exit(1)
+		}
+
+		updateFirmwares(b, &trust, verbose)
+
+		fetcher = bundleFetcher{b: b, fn: src.BundleFile}
+		revocations, err = bundleRevocations(b, src.RevocationMaxAge)
+
+	case src.BaseDir != "":
+		fetcher = tkeyverify.DirFetcher(src.BaseDir)
+		revocations, err = loadRevocations(src, verbose)
+
+	default:
+		cacher = &cachingFetcher{src: src, verbose: verbose}
+		fetcher = cacher
+		revocations, err = loadRevocations(src, verbose)
+	}
+
+	applyRevocations(&trust, revocations, err, verbose)
+
+	verifier := tkeyverify.New(trust, fetcher)
+	verifier.RequireSigsum = useSigsum
+	verifier.Challenges = challenges
+
+	if src.ProofFile != "" {
+		p, err := readProof(src.ProofFile)
+		if err != nil {
+			parseFailure(err.Error())
+			os.Exit(1)
+		}
+
+		verifier.Proof = &p
+
+		if verbose {
+			le.Printf("Using Sigsum proof from %s\n", src.ProofFile)
+		}
 	}
 
 	// Connect to a TKey
@@ -101,136 +140,152 @@ func verify(dev Device, verbose bool, baseDir string, verifyBaseURL string, useS
 
 	le.Printf("TKey UDI: %s\n", tk.Udi.String())
 
-	if tk.Udi.VendorID != vendorID {
-		le.Printf("Unknown Vendor ID")
+	if src.BundleFile != "" {
+		printLostFreshness(b, revocations, len(b.Revocations) != 0)
+	}
+
+	res, err := verifier.Verify(context.Background(), tk)
+	warnNotEmbedded(trust, res.AppHash)
+	if err != nil {
+		report(err)
 		exit(1)
 	}
 
-	// Castor means we demand a Sigsum proof. Bellatrix means
-	// vendor signature. Unless sigsum is forced.
-	if !useSigsum {
-		switch tk.Udi.ProductID {
-		case tkeyclient.UDIPIDBellatrix:
-			useSigsum = false
-		case tkeyclient.UDIPIDCastor:
-			useSigsum = true
-		default:
-			// Not sure!
-			le.Printf("Unknown Product ID: Don't know if we need signature or Sigsum proof.")
-			exit(1)
-		}
+	if verbose {
+		le.Printf("Verification data was created %s\n", res.Created)
+		le.Printf("TKey answered %d challenges\n", len(res.Transcript))
+		le.Printf("TKey firmware was verified, size:%d hash:%0x…\n", res.Firmware.Size, res.Firmware.Hash[:16])
+
+		manifest := res.AppManifest.Hash()
+		le.Printf("Device app %s, manifest %0x…:\n%s", res.AppTag, manifest[:16], res.AppManifest.String("  "))
 	}
 
-	var verification verification.Verification
+	switch res.Method {
+	case tkeyverify.MethodSigsum:
+		le.Printf("Verified Sigsum proof. Submit key: %s\n", ssh.FormatPublicEd25519(res.SubmitKey))
 
-	if baseDir != "" {
-		p := path.Join(baseDir, hex.EncodeToString(tk.Udi.Bytes))
-		if err = verification.FromFile(p); err != nil {
-			commFailed(err.Error())
-			exit(1)
+		if exports.ProofDir != "" {
+			cmd, err := exportProof(exports.ProofDir, hex.EncodeToString(tk.Udi.Bytes), res.Message, res.Proof, res.SubmitKey)
+			if err != nil {
+				commFailed(err.Error())
+				exit(1)
+			}
+
+			le.Printf("Exported Sigsum proof to %s. Verify it with:\n  %s\n", exports.ProofDir, cmd)
 		}
-	} else {
-		// Verify from an URL
-		verifyURL := fmt.Sprintf("%s/%s", verifyBaseURL, hex.EncodeToString(tk.Udi.Bytes))
 
-		if verbose {
-			le.Printf("Fetching verification data from %s ...\n", verifyURL)
+	case tkeyverify.MethodSignature:
+		le.Printf("Verified with vendor key %x\n", res.VendorKey)
+
+		if exports.ProofDir != "" {
+			le.Printf("No Sigsum proof to export, the TKey was verified with a vendor signature\n")
 		}
+	}
 
-		if err = verification.FromURL(verifyURL); err != nil {
+	if exports.AttestFile != "" {
+		if err = writeAttestation(exports.AttestFile, res, tk.Sign); err != nil {
 			commFailed(err.Error())
 			exit(1)
 		}
-	}
 
-	if verbose {
-		le.Printf("Verification data was created %s\n", verification.Timestamp)
+		le.Printf("Wrote attestation signed by the TKey to %s\n", exports.AttestFile)
 	}
 
-	// Find the right app to run
-	appBin, ok := appBins.Bins[verification.AppHash]
-	if !ok {
-		notFound("app digest")
-		exit(1)
-	}
+	if exports.PubkeyFile != "" || exports.StatementFile != "" {
+		if err = exportPubkey(exports.PubkeyFile, exports.StatementFile, res, tk.Sign); err != nil {
+			commFailed(err.Error())
+			exit(1)
+		}
 
-	pubKey, err := tk.LoadSigner(appBin.Bin)
-	if err != nil {
-		commFailed(err.Error())
-		exit(1)
-	}
+		if exports.PubkeyFile != "" {
+			le.Printf("Wrote verified public key to %s\n", exports.PubkeyFile)
+		}
 
-	// Check device identity
-	if err = tk.Challenge(pubKey); err != nil {
-		verificationFailed("challenge/response failed")
-		exit(1)
+		if exports.StatementFile != "" {
+			le.Printf("Wrote public key statement signed by the TKey to %s\n", exports.StatementFile)
+		}
 	}
 
-	// Check we have the right firmware.
-	expectedFW, err := firmwares.GetFirmware(tk.Udi)
-	if err != nil {
-		verificationFailed("unexpected firmware")
-		exit(1)
+	// Only cache what we know is good.
+	if cacher != nil {
+		cacher.save(tk.Udi.Bytes)
 	}
 
-	fwHash, err := tk.GetFirmwareHash(expectedFW.Size)
-	if err != nil {
-		commFailed("couldn't get firmware digest from TKey")
-		exit(1)
-	}
+	fmt.Printf("TKey is genuine!\n")
 
-	if !bytes.Equal(expectedFW.Hash[:], fwHash) {
-		le.Printf("TKey does not have expected firmware hash %0x…, but instead %0x…", expectedFW.Hash[:16], fwHash[:16])
-		verificationFailed("unexpected firmware")
-		exit(1)
+	exit(0)
+}
+
+// addAppDir adds the device apps in dir to trust, or exits.
+func addAppDir(trust *tkeyverify.TrustStore, dir string, verbose bool) {
+	added, err := trust.AddAppDir(dir)
+	if err != nil {
+		commFailed(fmt.Sprintf("device apps in %s: %v", dir, err))
+		os.Exit(1)
 	}
 
 	if verbose {
-		le.Printf("TKey firmware was verified, size:%d hash:%0x…\n", expectedFW.Size, expectedFW.Hash[:16])
+		for _, appBin := range added {
+			le.Printf("Not embedded device app %s from %s\n", appBin.String(), appBin.Path)
+		}
 	}
+}
 
-	// Recreate message the vendor signed
-	msg, err := util.BuildMessage(tk.Udi.Bytes, expectedFW.Hash[:], pubKey)
-	if err != nil {
-		parseFailure(err.Error())
-		exit(1)
+// warnNotEmbedded warns if the device app with appHash was not
+// embedded but read with --app-dir.
+func warnNotEmbedded(trust tkeyverify.TrustStore, appHash [sha512.Size]byte) {
+	appBin, ok := trust.AppBins.Bins[appHash]
+	if !ok || appBin.Path == "" {
+		return
 	}
 
-	// Verify the vendor signature or Sigsum proof over the
-	// recreated message.
-	if verification.IsProof() {
-		if useSigsum {
-			submitKey, err := verification.VerifyProof(msg, log)
-			if err != nil {
-				verificationFailed(err.Error())
-				exit(1)
-			}
+	le.Printf("WARNING: The device app %s is not embedded in %s, but read from %s.\n", appBin.Tag, progname, appBin.Path)
+	le.Printf("Its digest is still the one in the verification data, but it isn't vouched for by this %s.\n", progname)
+}
 
-			le.Printf("Verified Sigsum proof. Submit key: %s\n", ssh.FormatPublicEd25519(submitKey.Key))
-		} else {
-			// Strange. Exit.
-			verificationFailed("Expected vendor signature but got a Sigsum proof")
-			exit(1)
-		}
-	} else {
-		if useSigsum {
-			// Strange. Exit.
-			verificationFailed("Sigsum proof required but not available")
-			exit(1)
-		}
+// applyRevocations revokes the keys in revocations in trust. err is
+// the error from getting the revocation list, where errNoRevocations
+// is fine. Any other error exits.
+func applyRevocations(trust *tkeyverify.TrustStore, revocations revocation.List, err error, verbose bool) {
+	switch {
+	case errors.Is(err, errNoRevocationKeys):
+		le.Printf("WARNING: %s was built without revocation signing keys, so no keys can be revoked\n", progname)
+	case errors.Is(err, errNoRevocations):
+		le.Printf("WARNING: No keys are revoked, %v\n", err)
+	case err != nil:
+		commFailed(fmt.Sprintf("revocation list: %v", err))
+		os.Exit(1)
+	default:
+		trust.Revoke(revocations)
 
-		verifiedWith, err := verification.VerifySig(msg, vendorKeys)
-		if err != nil {
-			verificationFailed(err.Error())
-			exit(1)
+		if verbose {
+			le.Printf("Using revocation list from %s with %d revoked keys\n",
+				revocations.Timestamp.Format(time.RFC3339), len(revocations.Revocations))
 		}
-
-		le.Printf("Verified with vendor key %x\n", verifiedWith.PubKey)
 	}
+}
 
-	fmt.Printf("TKey is genuine!\n")
+// report describes err from the verification library with the
+// print helper for its kind.
+func report(err error) {
+	var vErr *tkeyverify.Error
+	if !errors.As(err, &vErr) {
+		commFailed(err.Error())
+		return
+	}
 
-	exit(0)
+	switch vErr.Kind {
+	case tkeyverify.KindParse:
+		parseFailure(err.Error())
+	case tkeyverify.KindMissing:
+		missing(err.Error())
+	case tkeyverify.KindNotFound:
+		notFound(err.Error())
+	case tkeyverify.KindVerification:
+		verificationFailed(err.Error())
+	default:
+		commFailed(err.Error())
+	}
 }
 
 // commFailed describes an I/O failure of some kind, perhaps between
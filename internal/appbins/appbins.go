@@ -8,7 +8,9 @@ import (
 	"embed"
 	"fmt"
 	"io/fs"
+	"os"
 	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -16,8 +18,10 @@ import (
 )
 
 type AppBin struct {
-	Tag string // Name and tag of device app
-	Bin []byte // Actual binary of device app
+	Tag      string   // Name and tag of device app
+	Bin      []byte   // Actual binary of device app
+	Manifest Manifest // Where the binary comes from
+	Path     string   // File the binary was read from, empty if embedded
 }
 
 func (a *AppBin) String() string {
@@ -32,7 +36,7 @@ type AppBins struct {
 	Bins map[[sha512.Size]byte]AppBin
 }
 
-//go:embed bins/*.bin bins/*.bin.sha512
+//go:embed bins/*.bin bins/*.bin.sha512 bins/*.bin.manifest bins/*.bin.deps
 var binsFS embed.FS
 
 const binsDir = "bins"
@@ -40,24 +44,64 @@ const binsDir = "bins"
 func (a AppBins) Tags() []string {
 	tags := []string{}
 
-	for _, appBin := range a.Bins {
+	for _, appBin := range a.List() {
 		tags = append(tags, appBin.Tag)
 	}
 
-	sort.Strings(tags)
-
 	return tags
 }
 
+// List returns all device apps in tag order.
+func (a AppBins) List() []AppBin {
+	list := make([]AppBin, 0, len(a.Bins))
+
+	for _, appBin := range a.Bins {
+		list = append(list, appBin)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Tag < list[j].Tag
+	})
+
+	return list
+}
+
 // NewAppBins initializes the embedded device apps.
 func NewAppBins() (AppBins, error) {
+	return readAppBins(binsFS, binsDir, "")
+}
+
+// legacyApps are the embedded apps from before manifests told how to
+// reproduce the build, with the manifest fields they may leave out.
+// Their commits and build dates weren't recorded when they were
+// embedded. A tag can be moved, so the commit it points to now
+// doesn't tell what was built, and neither does anything else in this
+// repo. Never add to this.
+var legacyApps = map[string][]string{
+	"signer-tkey-verification-1": {"commit", "build_date"},
+	"signer-v1.0.1":              {"commit", "build_date"},
+	"verisigner-v0.0.3":          {"commit", "build_date"},
+}
+
+// FromDir reads device apps from the directory dir, in the same
+// layout as the embedded apps: a name-tag.bin file with the binary,
+// a name-tag.bin.sha512 file with its digest and a complete
+// name-tag.bin.manifest for each app. The apps have Path set, since
+// they are not embedded.
+func FromDir(dir string) (AppBins, error) {
+	return readAppBins(os.DirFS(dir), ".", dir)
+}
+
+func readAppBins(fsys fs.FS, dir string, osDir string) (AppBins, error) {
 	var appBins = AppBins{
 		Bins: map[[sha512.Size]byte]AppBin{},
 	}
 
-	entries, err := binsFS.ReadDir(binsDir)
+	embedded := osDir == ""
+
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
-		return appBins, fmt.Errorf("error when reading %v: %w", binsDir, err)
+		return appBins, fmt.Errorf("error when reading %v: %w", path.Join(osDir, dir), err)
 	}
 
 	for _, entry := range entries {
@@ -81,15 +125,19 @@ func NewAppBins() (AppBins, error) {
 		}
 
 		var bin []byte
-		if bin, err = binsFS.ReadFile(path.Join(binsDir, binFn)); err != nil {
+		if bin, err = fs.ReadFile(fsys, path.Join(dir, binFn)); err != nil {
 			return appBins, fmt.Errorf("couldn't read %v: %w", binFn, err)
 		}
 
 		// Require accompanying sha512 file with matching hash
 		hashFn := binFn + ".sha512"
 		var hashHex []byte
-		if hashHex, err = binsFS.ReadFile(path.Join(binsDir, hashFn)); err != nil {
-			return appBins, fmt.Errorf("couldn't read %v: %w", path.Join(binsDir, hashFn), err)
+		if hashHex, err = fs.ReadFile(fsys, path.Join(dir, hashFn)); err != nil {
+			return appBins, fmt.Errorf("couldn't read %v: %w", path.Join(osDir, dir, hashFn), err)
+		}
+
+		if len(hashHex) < sha512.Size*2 {
+			return appBins, fmt.Errorf("too short digest in %v", hashFn)
 		}
 
 		var hash [sha512.Size]byte
@@ -103,16 +151,63 @@ func NewAppBins() (AppBins, error) {
 			Bin: bin,
 		}
 
+		if !embedded {
+			appBin.Path = filepath.Join(osDir, binFn)
+		}
+
 		if appBin.Hash() != hash {
 			return appBins, fmt.Errorf("digests of %v != %v", binFn, hashFn)
 		}
 
+		// Require a manifest telling where it comes from and
+		// how to reproduce it
+		manifestFn := binFn + ".manifest"
+		manifest, err := fs.ReadFile(fsys, path.Join(dir, manifestFn))
+		if err != nil {
+			return appBins, fmt.Errorf("couldn't read %v: %w", path.Join(osDir, dir, manifestFn), err)
+		}
+
+		if err = appBin.Manifest.FromJSON(manifest); err != nil {
+			return appBins, fmt.Errorf("%v: %w", manifestFn, err)
+		}
+
+		var exempt []string
+		if embedded {
+			exempt = legacyApps[tag]
+		}
+
+		if err = appBin.Manifest.CompleteExcept(exempt...); err != nil {
+			return appBins, fmt.Errorf("%v: %w", manifestFn, err)
+		}
+
+		// The optional deps file tells what it was built from
+		depsFn := binFn + ".deps"
+		if deps, err := fs.ReadFile(fsys, path.Join(dir, depsFn)); err == nil {
+			appBin.Manifest.Deps = parseDeps(string(deps))
+		}
+
 		appBins.Bins[hash] = appBin
 	}
 
 	return appBins, nil
 }
 
+// parseDeps parses key=value lines, like "appsrepotag=v0.0.6".
+func parseDeps(s string) map[string]string {
+	deps := map[string]string{}
+
+	for _, line := range strings.Split(s, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+
+		deps[key] = value
+	}
+
+	return deps
+}
+
 func MustAppBins() AppBins {
 	bins, err := NewAppBins()
 	if err != nil {
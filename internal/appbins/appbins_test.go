@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package appbins
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifests(t *testing.T) {
+	appBins, err := NewAppBins()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[[64]byte]string{}
+
+	for _, appBin := range appBins.List() {
+		m := appBin.Manifest
+		if m.Source == "" || m.Tag == "" || m.License == "" {
+			t.Fatalf("%s: incomplete manifest %+v", appBin.Tag, m)
+		}
+
+		if err = m.CompleteExcept(legacyApps[appBin.Tag]...); err != nil {
+			t.Fatalf("%s: %v", appBin.Tag, err)
+		}
+
+		if other, ok := seen[m.Hash()]; ok {
+			t.Fatalf("%s: same manifest as %s", appBin.Tag, other)
+		}
+
+		seen[m.Hash()] = appBin.Tag
+	}
+
+	for _, appBin := range appBins.Bins {
+		if appBin.Tag == "verisigner-v0.0.3" && appBin.Manifest.Deps["appsrepotag"] != "v0.0.6" {
+			t.Fatalf("%s: deps not in manifest: %v", appBin.Tag, appBin.Manifest.Deps)
+		}
+	}
+}
+
+func TestManifestFromJSON(t *testing.T) {
+	var m Manifest
+
+	if err := m.FromJSON([]byte(`{"source":"https://example.com/app","license":"BSD-2-Clause"}`)); err == nil {
+		t.Fatal("expected error for manifest without tag")
+	}
+
+	j := []byte(`{"source":"https://example.com/app","tag":"v1","license":"BSD-2-Clause","deps":{"b":"2","a":"1"}}`)
+	if err := m.FromJSON(j); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Complete(); err == nil {
+		t.Fatal("expected manifest without commit to be incomplete")
+	}
+
+	complete := []byte(`{"source":"https://example.com/app","tag":"v1","license":"BSD-2-Clause",` +
+		`"commit":"0123456789abcdef0123456789abcdef01234567","toolchain":"ghcr.io/tillitis/tkey-builder:4",` +
+		`"build_date":"2025-01-01"}`)
+	if err := m.FromJSON(complete); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Complete(); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Toolchain = ""
+	if err := m.CompleteExcept("commit", "build_date"); err == nil {
+		t.Fatal("expected manifest without toolchain to be incomplete")
+	}
+
+	for _, bad := range []string{`"commit":"v1"`, `"commit":"0123456789abcdef0123456789abcdef0123456x"`, `"build_date":"yesterday"`} {
+		var m3 Manifest
+		if err := m3.FromJSON([]byte(`{"source":"https://example.com/app","tag":"v1","license":"BSD-2-Clause",` + bad + `}`)); err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+
+	// The digest doesn't depend on the order in the file.
+	m = Manifest{}
+	if err := m.FromJSON(j); err != nil {
+		t.Fatal(err)
+	}
+
+	var m2 Manifest
+	if err := m2.FromJSON([]byte(`{"deps":{"a":"1","b":"2"},"license":"BSD-2-Clause","tag":"v1","source":"https://example.com/app"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Hash() != m2.Hash() {
+		t.Fatal("different digests of the same manifest")
+	}
+}
+
+func TestFromDir(t *testing.T) {
+	bin := []byte("not really a device app")
+	digest := sha512.Sum512(bin)
+
+	write := func(t *testing.T, dir string, name string, content []byte) {
+		t.Helper()
+
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	write(t, dir, "signer-v9.9.9.bin", bin)
+	write(t, dir, "signer-v9.9.9.bin.sha512", []byte(hex.EncodeToString(digest[:])+"  signer-v9.9.9.bin\n"))
+
+	// No manifest
+	if _, err := FromDir(dir); err == nil {
+		t.Fatal("expected error for missing manifest")
+	}
+
+	// A manifest without how it was built
+	write(t, dir, "signer-v9.9.9.bin.manifest",
+		[]byte(`{"source":"https://example.com/signer","tag":"v9.9.9","license":"BSD-2-Clause"}`))
+	if _, err := FromDir(dir); err == nil {
+		t.Fatal("expected error for incomplete manifest")
+	}
+
+	write(t, dir, "signer-v9.9.9.bin.manifest",
+		[]byte(`{"source":"https://example.com/signer","tag":"v9.9.9","license":"BSD-2-Clause",`+
+			`"commit":"0123456789abcdef0123456789abcdef01234567","toolchain":"ghcr.io/tillitis/tkey-builder:4",`+
+			`"build_date":"2025-01-01T00:00:00Z"}`))
+
+	appBins, err := FromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appBin, ok := appBins.Bins[digest]
+	if !ok {
+		t.Fatalf("app not found, have %v", appBins.Tags())
+	}
+
+	if appBin.Tag != "signer-v9.9.9" || appBin.Path != filepath.Join(dir, "signer-v9.9.9.bin") {
+		t.Fatalf("unexpected app %s from %q", appBin.Tag, appBin.Path)
+	}
+
+	// A digest that doesn't match the binary
+	write(t, dir, "signer-v9.9.9.bin.sha512", []byte(hex.EncodeToString(make([]byte, sha512.Size))))
+	if _, err = FromDir(dir); err == nil {
+		t.Fatal("expected error for wrong digest")
+	}
+
+	// No digest at all
+	if err = os.Remove(filepath.Join(dir, "signer-v9.9.9.bin.sha512")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = FromDir(dir); err == nil {
+		t.Fatal("expected error for missing digest")
+	}
+
+	// Embedded apps have no path
+	embedded, err := NewAppBins()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, appBin := range embedded.Bins {
+		if appBin.Path != "" {
+			t.Fatalf("%s: embedded app with path %q", appBin.Tag, appBin.Path)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package appbins
+
+import (
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/util"
+)
+
+// Manifest describes where an embedded device app comes from. Empty
+// fields are unknown, see Complete.
+type Manifest struct {
+	Source    string            `json:"source"`               // Source repository
+	Tag       string            `json:"tag"`                  // Git tag in Source
+	Commit    string            `json:"commit,omitempty"`     // Git commit of Tag
+	Toolchain string            `json:"toolchain,omitempty"`  // What it was built with
+	BuildDate string            `json:"build_date,omitempty"` // RFC3339 or date
+	License   string            `json:"license"`              // SPDX license identifier
+	Deps      map[string]string `json:"deps,omitempty"`       // From the .deps file
+}
+
+func (m *Manifest) FromJSON(b []byte) error {
+	if err := json.Unmarshal(b, m); err != nil {
+		return fmt.Errorf("couldn't unmarshal JSON: %w", err)
+	}
+
+	if m.Source == "" || m.Tag == "" || m.License == "" {
+		return errors.New("manifest needs source, tag, and license")
+	}
+
+	if m.Commit != "" {
+		if len(m.Commit) != 40 && len(m.Commit) != 64 {
+			return fmt.Errorf("commit %q isn't a full git commit", m.Commit)
+		}
+
+		commit := make([]byte, len(m.Commit)/2)
+		if err := util.DecodeHex(commit, m.Commit); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+	}
+
+	if m.BuildDate != "" {
+		if _, err := parseBuildDate(m.BuildDate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Complete returns an error unless the manifest tells everything
+// needed to reproduce the build: the commit, the toolchain and the
+// build date.
+func (m *Manifest) Complete() error {
+	return m.CompleteExcept()
+}
+
+// CompleteExcept is Complete, but allows the named fields ("commit",
+// "toolchain" or "build_date") to be missing.
+func (m *Manifest) CompleteExcept(exempt ...string) error {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"commit", m.Commit},
+		{"toolchain", m.Toolchain},
+		{"build_date", m.BuildDate},
+	}
+
+	var missing []string
+	for _, f := range fields {
+		if f.value == "" && !slices.Contains(exempt, f.name) {
+			missing = append(missing, f.name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("manifest needs %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// parseBuildDate parses a build date in RFC3339 or as a date only.
+func parseBuildDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return t, fmt.Errorf("build_date %q is neither RFC3339 nor a date", s)
+	}
+
+	return t, nil
+}
+
+func (m *Manifest) ToJSON() ([]byte, error) {
+	json, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal JSON: %w", err)
+	}
+
+	return json, nil
+}
+
+// Hash returns the SHA-512 digest of the manifest as JSON, with the
+// deps in key order, to bind the manifest to other data.
+func (m *Manifest) Hash() [sha512.Size]byte {
+	b, err := m.ToJSON()
+	if err != nil {
+		// Can't happen, only strings.
+		panic(err)
+	}
+
+	return sha512.Sum512(b)
+}
+
+// String describes the manifest on several lines, indented by
+// indent.
+func (m *Manifest) String(indent string) string {
+	unknown := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+
+		return s
+	}
+
+	lines := []string{
+		"Source: " + m.Source,
+		"Tag: " + m.Tag,
+		"Commit: " + unknown(m.Commit),
+		"Toolchain: " + unknown(m.Toolchain),
+		"Build date: " + unknown(m.BuildDate),
+		"License: " + m.License,
+	}
+
+	keys := make([]string, 0, len(m.Deps))
+	for k := range m.Deps {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("Depends on: %s=%s", k, m.Deps[k]))
+	}
+
+	return indent + strings.Join(lines, "\n"+indent) + "\n"
+}
@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package bundle handles files for verifying a TKey on a machine
+// without network.
+//
+// A Request is written on the offline machine and names the TKey. A
+// Bundle is created from the Request on a networked machine and
+// contains everything fetched from the verification server.
+package bundle
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/tkey"
+)
+
+type requestJSON struct {
+	UDI string `json:"udi"`
+}
+
+// Request asks for a bundle for the TKey with UDI.
+type Request struct {
+	UDI []byte // Big Endian
+}
+
+func (r *Request) FromJSON(b []byte) error {
+	var rJ requestJSON
+
+	if err := json.Unmarshal(b, &rJ); err != nil {
+		return fmt.Errorf("couldn't unmarshal JSON: %w", err)
+	}
+
+	udi, err := decodeUDI(rJ.UDI)
+	if err != nil {
+		return err
+	}
+
+	r.UDI = udi
+
+	return nil
+}
+
+func (r *Request) ToJSON() ([]byte, error) {
+	rJ := requestJSON{
+		UDI: hex.EncodeToString(r.UDI),
+	}
+
+	json, err := json.Marshal(rJ)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal JSON: %w", err)
+	}
+
+	return json, nil
+}
+
+func (r *Request) FromFile(fn string) error {
+	requestJSON, err := os.ReadFile(fn)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return r.FromJSON(requestJSON)
+}
+
+func (r *Request) ToFile(fn string) error {
+	rJ, err := r.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	return writeFile(fn, rJ)
+}
+
+type bundleJSON struct {
+	UDI          string `json:"udi"`
+	Created      string `json:"created"`
+	BaseURL      string `json:"baseurl"`
+	Verification string `json:"verification"`
+	Revocations  string `json:"revocations,omitempty"`
+	Firmwares    string `json:"firmwares,omitempty"`
+	AppManifest  string `json:"app_manifest,omitempty"`
+}
+
+// Bundle contains the verification data for one TKey, as fetched
+// from BaseURL at the time Created.
+type Bundle struct {
+	UDI          []byte // Big Endian
+	Created      time.Time
+	BaseURL      string
+	Verification []byte // Verification file
+	Revocations  []byte // Signed revocation list, if any
+	Firmwares    []byte // Signed firmware database update, if any
+
+	// SHA-512 digest of the manifest of the device app in the
+	// verification data, as known when the bundle was created, if
+	// known.
+	AppManifest []byte
+}
+
+func (b *Bundle) FromJSON(j []byte) error {
+	var bJ bundleJSON
+
+	if err := json.Unmarshal(j, &bJ); err != nil {
+		return fmt.Errorf("couldn't unmarshal JSON: %w", err)
+	}
+
+	udi, err := decodeUDI(bJ.UDI)
+	if err != nil {
+		return err
+	}
+
+	b.UDI = udi
+
+	b.Created, err = time.Parse(time.RFC3339, bJ.Created)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if bJ.Verification == "" {
+		return errors.New("bundle contains no verification data")
+	}
+
+	b.BaseURL = bJ.BaseURL
+	b.Verification = []byte(bJ.Verification)
+	b.Revocations = []byte(bJ.Revocations)
+	b.Firmwares = []byte(bJ.Firmwares)
+
+	b.AppManifest = nil
+	if bJ.AppManifest != "" {
+		b.AppManifest, err = hex.DecodeString(bJ.AppManifest)
+		if err != nil {
+			return fmt.Errorf("couldn't decode app manifest digest: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *Bundle) ToJSON() ([]byte, error) {
+	bJ := bundleJSON{
+		UDI:          hex.EncodeToString(b.UDI),
+		Created:      b.Created.UTC().Format(time.RFC3339),
+		BaseURL:      b.BaseURL,
+		Verification: string(b.Verification),
+		Revocations:  string(b.Revocations),
+		Firmwares:    string(b.Firmwares),
+		AppManifest:  hex.EncodeToString(b.AppManifest),
+	}
+
+	json, err := json.Marshal(bJ)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal JSON: %w", err)
+	}
+
+	return json, nil
+}
+
+func (b *Bundle) FromFile(fn string) error {
+	bundleJSON, err := os.ReadFile(fn)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return b.FromJSON(bundleJSON)
+}
+
+func (b *Bundle) ToFile(fn string) error {
+	bJ, err := b.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	return writeFile(fn, bJ)
+}
+
+func decodeUDI(s string) ([]byte, error) {
+	udi, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode UDI: %w", err)
+	}
+
+	if l := len(udi); l != tkey.UDISize {
+		return nil, errors.New("wrong length of UDI")
+	}
+
+	return udi, nil
+}
+
+func writeFile(fn string, b []byte) error {
+	if err := os.WriteFile(fn, append(b, '\n'), 0o600); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bundle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	req := Request{
+		UDI: []byte{0x01, 0x33, 0x70, 0x82, 0, 0, 0, 2},
+	}
+
+	j, err := req.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(j) != `{"udi":"0133708200000002"}` {
+		t.Fatalf("unexpected request %s", j)
+	}
+
+	var got Request
+	if err = got.FromJSON(j); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got.UDI, req.UDI) {
+		t.Fatalf("UDI: got %x, want %x", got.UDI, req.UDI)
+	}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	b := Bundle{
+		UDI:          []byte{0x01, 0x33, 0x70, 0x82, 0, 0, 0, 2},
+		Created:      time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC),
+		BaseURL:      "https://tkey.tillitis.se/verify",
+		Verification: []byte(`{"timestamp":"2025-09-02T10:56:48Z"}` + "\n"),
+		Firmwares:    []byte("01337082 1337 2 2 4160 06d0aafc...\nsignature 00\n"),
+		AppManifest:  bytes.Repeat([]byte{0x42}, 64),
+	}
+
+	j, err := b.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Bundle
+	if err = got.FromJSON(j); err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.Created.Equal(b.Created) || got.BaseURL != b.BaseURL ||
+		!bytes.Equal(got.Verification, b.Verification) || len(got.Revocations) != 0 ||
+		!bytes.Equal(got.Firmwares, b.Firmwares) ||
+		!bytes.Equal(got.AppManifest, b.AppManifest) {
+		t.Fatalf("got %+v, want %+v", got, b)
+	}
+}
+
+func TestInvalidBundle(t *testing.T) {
+	var b Bundle
+
+	err := b.FromJSON([]byte(`{"udi":"0133","created":"2025-10-01T12:00:00Z","verification":"{}"}`))
+	assertErrorMsgStartsWith(t, err, "wrong length of UDI")
+
+	err = b.FromJSON([]byte(`{"udi":"0133708200000002","created":"2025-10-01T12:00:00Z"}`))
+	assertErrorMsgStartsWith(t, err, "bundle contains no verification data")
+}
+
+func assertErrorMsgStartsWith(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if err == nil {
+		t.Log("Expected error")
+		t.Fail()
+		return
+	}
+
+	if !strings.HasPrefix(err.Error(), want) {
+		t.Logf("Unexpected error '%v', should start with '%v'", err, want)
+		t.Fail()
+	}
+}
@@ -12,6 +12,34 @@ const VendorPubKeys = `14274d3570097aea209af1c23b64aa439a4d0d32c62735c5f6d6a2960
 // Test vendor key.
 // const VendorPubKeys = `50d9a125f51d85ffa1fb12011bdae05d39e03cda2a35d0daf3077072daabbb10 verisigner-v0.0.3 f8ecdcda53a296636a0297c250b27fb649860645626cc8ad935eabb4c43ea3e1841c40300544fade4189aa4143c1ca8fe82361e3d874b42b0e2404793a170142`
 
+//////////////////////////////////////////////////////////////////////
+/// Verification servers
+//////////////////////////////////////////////////////////////////////
+
+// Base URLs of the verification server and its mirrors, one per line,
+// tried in order. Any mirror can be used since the data is verified
+// against the vendor keys and Sigsum configuration, not trusted
+// because of where it came from.
+const VerifyMirrors = `
+https://tkey.tillitis.se/verify
+`
+
+//////////////////////////////////////////////////////////////////////
+/// Revocation lists
+//////////////////////////////////////////////////////////////////////
+
+// Public keys, in hex, trusted to sign revocation lists and firmware
+// database updates, separated by white space or commas.
+//
+// The vendor's keys are set when building a release, with
+//
+//	make REVOCATION_PUBKEYS=<key in hex>[,<key in hex>...]
+//
+// which sets this with -ldflags -X. Without keys, revocation lists
+// and firmware database updates can't be verified and are ignored.
+// Never set a test key in a release: anyone can sign with those.
+var RevocationPubKeys = ""
+
 //////////////////////////////////////////////////////////////////////
 /// Sigsum
 //////////////////////////////////////////////////////////////////////
@@ -47,19 +75,22 @@ quorum demo-quorum-rule
 /// Firmwares
 //////////////////////////////////////////////////////////////////////
 
+// One firmware per line: UDI0 vendor product rev size hash [label]
+//
+// The optional label names the firmware in verification files.
 const FirmwaresConf = `
 # The default/qemu UDI0, with firmware from main at
 # TK1-24.03 (1c90b1aa3dbfb4e62039683ee6049ae8af608498)
 # UDI 00010203
-00010203 0010 8 3 4192 3769540390ee3d990ea3f9e4cc9a0d1af5bcaebb82218185a78c39c6bf01d9cdc305ba253a1fb9f3f9fcc63d97c8e5f34bbb1f7bec56a8f246f1d2239867b623
+00010203 0010 8 3 4192 3769540390ee3d990ea3f9e4cc9a0d1af5bcaebb82218185a78c39c6bf01d9cdc305ba253a1fb9f3f9fcc63d97c8e5f34bbb1f7bec56a8f246f1d2239867b623 qemu-1c90b1a
 
 # Firmware from main at
 # c126199a41149f6284aa9533e72395c978733b44
-01337080 1337 2 0 4192 3769540390ee3d990ea3f9e4cc9a0d1af5bcaebb82218185a78c39c6bf01d9cdc305ba253a1fb9f3f9fcc63d97c8e5f34bbb1f7bec56a8f246f1d2239867b623
+01337080 1337 2 0 4192 3769540390ee3d990ea3f9e4cc9a0d1af5bcaebb82218185a78c39c6bf01d9cdc305ba253a1fb9f3f9fcc63d97c8e5f34bbb1f7bec56a8f246f1d2239867b623 main-c126199
 
 # First Bellatrix release
-01337081 1337 2 1 4192 3769540390ee3d990ea3f9e4cc9a0d1af5bcaebb82218185a78c39c6bf01d9cdc305ba253a1fb9f3f9fcc63d97c8e5f34bbb1f7bec56a8f246f1d2239867b623
+01337081 1337 2 1 4192 3769540390ee3d990ea3f9e4cc9a0d1af5bcaebb82218185a78c39c6bf01d9cdc305ba253a1fb9f3f9fcc63d97c8e5f34bbb1f7bec56a8f246f1d2239867b623 bellatrix-first
 
 # TK1-24.03 (1c90b1aa3dbfb4e62039683ee6049ae8af608498)
-01337082 1337 2 2 4160 06d0aafcc763307420380a8c5a324f3fccfbba6af7ff6fe0facad684ebd69dd43234c8531a096c77c2dc3543f8b8b629c94136ca7e257ca560da882e4dbbb025
+01337082 1337 2 2 4160 06d0aafcc763307420380a8c5a324f3fccfbba6af7ff6fe0facad684ebd69dd43234c8531a096c77c2dc3543f8b8b629c94136ca7e257ca560da882e4dbbb025 TK1-24.03
 `
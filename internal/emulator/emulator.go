@@ -0,0 +1,461 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package emulator emulates a TKey running the firmware and, after an
+// app is loaded, the signer device app, speaking the framing protocol
+// of the real TKey. Use it with a PTY to test programs using
+// tkeyclient and tkeysign without hardware:
+//
+//	emu, err := emulator.New(emulator.Config{UDS: uds, UDI: udiBE, Firmware: fw})
+//	p, err := emu.OpenPTY()
+//	go p.Serve()
+//
+// and connect to p.Path() as the serial port of a TKey.
+//
+// Whatever app is loaded behaves like the signer. Its key is still
+// derived from the loaded binary as on a real TKey, so different apps
+// get different keys.
+package emulator
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/tillitis/tkey-verification/internal/tkey"
+	"golang.org/x/crypto/blake2s"
+)
+
+var le = log.New(os.Stderr, "", 0)
+
+// Endpoints in the framing protocol.
+const (
+	endpointFW  = 2
+	endpointApp = 3
+)
+
+// Firmware protocol.
+const (
+	cmdGetNameVersion   = 0x01
+	rspGetNameVersion   = 0x02
+	cmdLoadApp          = 0x03
+	rspLoadApp          = 0x04
+	cmdLoadAppData      = 0x05
+	rspLoadAppData      = 0x06
+	rspLoadAppDataReady = 0x07
+	cmdGetUDI           = 0x08
+	rspGetUDI           = 0x09
+)
+
+// Signer app protocol.
+const (
+	appCmdGetPubkey       = 0x01
+	appRspGetPubkey       = 0x02
+	appCmdSetSize         = 0x03
+	appRspSetSize         = 0x04
+	appCmdSignData        = 0x05
+	appRspSignData        = 0x06
+	appCmdGetSig          = 0x07
+	appRspGetSig          = 0x08
+	appCmdGetNameVersion  = 0x09
+	appRspGetNameVersion  = 0x0a
+	appCmdGetFirmwareHash = 0x0b
+	appRspGetFirmwareHash = 0x0c
+)
+
+const (
+	statusOK  = 0x00
+	statusBad = 0x01
+
+	// AppMaxSize is the size of the app RAM.
+	AppMaxSize = 0x20000
+	// MaxSignSize is the largest message the signer signs.
+	MaxSignSize = 4096
+)
+
+// Command and response lengths in the frame header.
+const (
+	len1   = 0
+	len4   = 1
+	len32  = 2
+	len128 = 3
+)
+
+func bytelen(l byte) int {
+	return []int{1, 4, 32, 128}[l&3]
+}
+
+// NameVersion is what the firmware or app identifies as.
+type NameVersion struct {
+	Name0   string // 4 characters
+	Name1   string // 4 characters
+	Version uint32
+}
+
+// Defaults for Config.
+var (
+	DefaultFirmwareName = NameVersion{"tk1 ", "mkdf", 5}
+	DefaultAppName      = NameVersion{"tk1 ", "sign", 1}
+)
+
+// Config is the hardware and firmware of an emulated TKey.
+type Config struct {
+	UDS      [32]byte // Unique Device Secret
+	UDI      []byte   // Unique Device Identifier, Big Endian
+	Firmware []byte   // Firmware image, for the firmware digest
+
+	// Zero values mean DefaultFirmwareName and DefaultAppName.
+	FirmwareName NameVersion
+	AppName      NameVersion
+
+	Verbose bool
+}
+
+// Emulator is an emulated TKey. It starts in firmware mode and
+// switches to app mode when an app has been loaded, like a TKey just
+// plugged in. Reset puts it back in firmware mode.
+type Emulator struct {
+	conf  Config
+	udiLE []byte
+
+	mu     sync.Mutex
+	rw     io.ReadWriter
+	frames int // Number of frames handled
+
+	// Firmware mode
+	appSize int
+	uss     []byte
+	app     []byte
+
+	// App mode
+	running  bool
+	priv     ed25519.PrivateKey
+	msgSize  int
+	msg      []byte
+	signDone bool
+}
+
+// New returns an emulator of the TKey in conf.
+func New(conf Config) (*Emulator, error) {
+	var udi tkey.UDI
+	if err := udi.FromBE(conf.UDI); err != nil {
+		return nil, fmt.Errorf("invalid UDI: %w", err)
+	}
+
+	if conf.FirmwareName == (NameVersion{}) {
+		conf.FirmwareName = DefaultFirmwareName
+	}
+
+	if conf.AppName == (NameVersion{}) {
+		conf.AppName = DefaultAppName
+	}
+
+	for _, nv := range []NameVersion{conf.FirmwareName, conf.AppName} {
+		if len(nv.Name0) != 4 || len(nv.Name1) != 4 {
+			return nil, errors.New("names must be 4 characters")
+		}
+	}
+
+	b := conf.UDI
+
+	return &Emulator{
+		conf:  conf,
+		udiLE: []byte{b[3], b[2], b[1], b[0], b[7], b[6], b[5], b[4]},
+	}, nil
+}
+
+// Reset puts the TKey back in firmware mode, as when plugged in
+// again.
+func (e *Emulator) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.appSize = 0
+	e.uss = nil
+	e.app = nil
+	e.running = false
+	e.priv = nil
+	e.msg = nil
+	e.msgSize = 0
+	e.signDone = false
+}
+
+// CDI returns the Compound Device Identifier the firmware gives an
+// app with digest appDigest and the User Supplied Secret uss, which
+// may be nil:
+//
+//	BLAKE2s(UDS || appDigest || uss)
+func (e *Emulator) CDI(appDigest [32]byte, uss []byte) [32]byte {
+	h, _ := blake2s.New256(nil)
+	h.Write(e.conf.UDS[:])
+	h.Write(appDigest[:])
+	h.Write(uss)
+
+	var cdi [32]byte
+	copy(cdi[:], h.Sum(nil))
+
+	return cdi
+}
+
+// PublicKey returns the public key the signer gets when app is loaded
+// without a USS.
+func (e *Emulator) PublicKey(app []byte) ed25519.PublicKey {
+	cdi := e.CDI(blake2s.Sum256(app), nil)
+
+	pub, _ := ed25519.NewKeyFromSeed(cdi[:]).Public().(ed25519.PublicKey)
+
+	return pub
+}
+
+// ServeConn answers commands read from rw until it is closed.
+func (e *Emulator) ServeConn(rw io.ReadWriter) error {
+	e.mu.Lock()
+	e.rw = rw
+	e.mu.Unlock()
+
+	for {
+		hdr := make([]byte, 1)
+		if _, err := io.ReadFull(rw, hdr); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return fmt.Errorf("%w", err)
+		}
+
+		if hdr[0]&0x80 != 0 {
+			e.logf("Reserved bit set in frame header 0x%02x, ignoring\n", hdr[0])
+			continue
+		}
+
+		id := (hdr[0] >> 5) & 3
+		endpoint := (hdr[0] >> 3) & 3
+		cmd := make([]byte, bytelen(hdr[0]&3))
+
+		if _, err := io.ReadFull(rw, cmd); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		if err := e.handle(id, endpoint, cmd); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *Emulator) handle(id byte, endpoint byte, cmd []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.frames++
+	e.logf("Got command 0x%02x for endpoint %d\n", cmd[0], endpoint)
+
+	switch {
+	case endpoint == endpointFW && !e.running:
+		return e.firmware(id, cmd)
+	case endpoint == endpointApp && e.running:
+		return e.signer(id, cmd)
+	}
+
+	// Nothing listening to the endpoint, as on a real TKey.
+	e.logf("No one listening to endpoint %d, ignoring\n", endpoint)
+
+	return nil
+}
+
+func (e *Emulator) firmware(id byte, cmd []byte) error {
+	switch cmd[0] {
+	case cmdGetNameVersion:
+		return e.reply(id, endpointFW, len32, rspGetNameVersion, packNameVersion(e.conf.FirmwareName))
+
+	case cmdGetUDI:
+		return e.reply(id, endpointFW, len32, rspGetUDI, append([]byte{statusOK}, e.udiLE...))
+
+	case cmdLoadApp:
+		// Size and USS
+		if e.short(cmd, 1+4+32) {
+			return e.reply(id, endpointFW, len4, rspLoadApp, []byte{statusBad})
+		}
+
+		size := int(binary.LittleEndian.Uint32(cmd[1:5]))
+		if size == 0 || size > AppMaxSize {
+			return e.reply(id, endpointFW, len4, rspLoadApp, []byte{statusBad})
+		}
+
+		e.appSize = size
+		e.app = nil
+		e.uss = nil
+
+		// As tkeyclient sends it: a non-zero first byte means
+		// the USS follows, including that byte.
+		if cmd[5] != 0 {
+			e.uss = append([]byte{}, cmd[5:5+32]...)
+		}
+
+		return e.reply(id, endpointFW, len4, rspLoadApp, []byte{statusOK})
+
+	case cmdLoadAppData:
+		if e.appSize == 0 {
+			return e.reply(id, endpointFW, len4, rspLoadAppData, []byte{statusBad})
+		}
+
+		n := min(len(cmd)-1, e.appSize-len(e.app))
+		e.app = append(e.app, cmd[1:1+n]...)
+
+		if len(e.app) < e.appSize {
+			return e.reply(id, endpointFW, len4, rspLoadAppData, []byte{statusOK})
+		}
+
+		digest := blake2s.Sum256(e.app)
+		if err := e.reply(id, endpointFW, len128, rspLoadAppDataReady, append([]byte{statusOK}, digest[:]...)); err != nil {
+			return err
+		}
+
+		e.start(digest)
+
+		return nil
+	}
+
+	e.logf("Unknown firmware command 0x%02x\n", cmd[0])
+
+	return e.replyNOK(id, endpointFW)
+}
+
+// start starts the loaded app, with a key derived from the CDI like
+// the signer does.
+func (e *Emulator) start(digest [32]byte) {
+	cdi := e.CDI(digest, e.uss)
+
+	e.priv = ed25519.NewKeyFromSeed(cdi[:])
+	e.running = true
+
+	e.logf("Started app with digest %x\n", digest)
+}
+
+func (e *Emulator) signer(id byte, cmd []byte) error {
+	switch cmd[0] {
+	case appCmdGetNameVersion:
+		return e.reply(id, endpointApp, len32, appRspGetNameVersion, packNameVersion(e.conf.AppName))
+
+	case appCmdGetPubkey:
+		pub, _ := e.priv.Public().(ed25519.PublicKey)
+
+		return e.reply(id, endpointApp, len128, appRspGetPubkey, pub)
+
+	case appCmdSetSize:
+		if e.short(cmd, 1+4) {
+			return e.reply(id, endpointApp, len4, appRspSetSize, []byte{statusBad})
+		}
+
+		size := int(binary.LittleEndian.Uint32(cmd[1:5]))
+		if size == 0 || size > MaxSignSize {
+			return e.reply(id, endpointApp, len4, appRspSetSize, []byte{statusBad})
+		}
+
+		e.msgSize = size
+		e.msg = nil
+		e.signDone = false
+
+		return e.reply(id, endpointApp, len4, appRspSetSize, []byte{statusOK})
+
+	case appCmdSignData:
+		if e.msgSize == 0 || len(e.msg) >= e.msgSize {
+			return e.reply(id, endpointApp, len4, appRspSignData, []byte{statusBad})
+		}
+
+		n := min(len(cmd)-1, e.msgSize-len(e.msg))
+		e.msg = append(e.msg, cmd[1:1+n]...)
+		e.signDone = len(e.msg) == e.msgSize
+
+		return e.reply(id, endpointApp, len4, appRspSignData, []byte{statusOK})
+
+	case appCmdGetSig:
+		if !e.signDone {
+			return e.reply(id, endpointApp, len128, appRspGetSig, []byte{statusBad})
+		}
+
+		sig := ed25519.Sign(e.priv, e.msg)
+		e.msgSize = 0
+		e.msg = nil
+		e.signDone = false
+
+		return e.reply(id, endpointApp, len128, appRspGetSig, append([]byte{statusOK}, sig...))
+
+	case appCmdGetFirmwareHash:
+		if e.short(cmd, 1+4) {
+			return e.reply(id, endpointApp, len128, appRspGetFirmwareHash, []byte{statusBad})
+		}
+
+		size := int(binary.LittleEndian.Uint32(cmd[1:5]))
+		if size == 0 || size > len(e.conf.Firmware) {
+			return e.reply(id, endpointApp, len128, appRspGetFirmwareHash, []byte{statusBad})
+		}
+
+		digest := sha512.Sum512(e.conf.Firmware[:size])
+
+		return e.reply(id, endpointApp, len128, appRspGetFirmwareHash, append([]byte{statusOK}, digest[:]...))
+	}
+
+	e.logf("Unknown app command 0x%02x\n", cmd[0])
+
+	return e.replyNOK(id, endpointApp)
+}
+
+// short returns true if cmd is shorter than n bytes, the least the
+// command needs, as in a frame with a too short length from a broken
+// client.
+func (e *Emulator) short(cmd []byte, n int) bool {
+	if len(cmd) >= n {
+		return false
+	}
+
+	e.logf("Command 0x%02x needs %d bytes, got %d\n", cmd[0], n, len(cmd))
+
+	return true
+}
+
+// reply sends a response frame with code and data, padded to the
+// response length.
+func (e *Emulator) reply(id byte, endpoint byte, rspLen byte, code byte, data []byte) error {
+	rsp := make([]byte, 1+bytelen(rspLen))
+	rsp[0] = id<<5 | endpoint<<3 | rspLen
+	rsp[1] = code
+	copy(rsp[2:], data)
+
+	if _, err := e.rw.Write(rsp); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// replyNOK sends a response frame with the Not OK bit set.
+func (e *Emulator) replyNOK(id byte, endpoint byte) error {
+	rsp := []byte{id<<5 | endpoint<<3 | 1<<2 | len1, 0}
+
+	if _, err := e.rw.Write(rsp); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func (e *Emulator) logf(format string, a ...any) {
+	if e.conf.Verbose {
+		le.Printf(format, a...)
+	}
+}
+
+func packNameVersion(nv NameVersion) []byte {
+	b := make([]byte, 12)
+	copy(b[0:4], nv.Name0)
+	copy(b[4:8], nv.Name1)
+	binary.LittleEndian.PutUint32(b[8:12], nv.Version)
+
+	return b
+}
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package emulator
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/tillitis/tkey-verification/internal/tkey"
+	"github.com/tillitis/tkeyclient"
+)
+
+func TestEmulator(t *testing.T) {
+	udiBE, _ := hex.DecodeString("0133708200000001")
+	firmware := bytes.Repeat([]byte{0x13}, 4000)
+	app := bytes.Repeat([]byte{0x37}, 1000)
+
+	emu, err := New(Config{
+		UDS:      [32]byte{1, 2, 3},
+		UDI:      udiBE,
+		Firmware: firmware,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := emu.OpenPTY()
+	if err != nil {
+		t.Skipf("no PTY: %v", err)
+	}
+	defer p.Close()
+
+	go func() {
+		_ = p.Serve()
+	}()
+
+	tk, err := tkey.NewTKey(p.Path(), tkeyclient.SerialSpeed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tk.Close()
+
+	if !bytes.Equal(tk.Udi.Bytes, udiBE) || tk.Udi.ProductID != 2 {
+		t.Fatalf("unexpected UDI %s", tk.Udi.String())
+	}
+
+	pubKey, err := tk.LoadSigner(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(pubKey, emu.PublicKey(app)) {
+		t.Fatalf("public key %x, expected %x", pubKey, emu.PublicKey(app))
+	}
+
+	// Longer than one frame of data.
+	msg := bytes.Repeat([]byte("message "), 40)
+	sig, err := tk.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ed25519.Verify(pubKey, msg, sig) {
+		t.Fatal("signature doesn't verify")
+	}
+
+	transcript, err := tk.Challenge(pubKey, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = transcript.Verify(pubKey); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := tk.GetFirmwareHash(3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := sha512.Sum512(firmware[:3000])
+	if !bytes.Equal(digest, want[:]) {
+		t.Fatalf("firmware digest %x, expected %x", digest, want)
+	}
+
+	if _, err = tk.GetFirmwareHash(len(firmware) + 1); err == nil {
+		t.Fatal("expected error for firmware digest beyond the image")
+	}
+}
+
+func TestCDI(t *testing.T) {
+	udiBE, _ := hex.DecodeString("0133708200000001")
+	app := []byte("app")
+
+	a, _ := New(Config{UDS: [32]byte{1}, UDI: udiBE})
+	b, _ := New(Config{UDS: [32]byte{2}, UDI: udiBE})
+
+	if bytes.Equal(a.PublicKey(app), b.PublicKey(app)) {
+		t.Fatal("same key with different UDS")
+	}
+
+	if bytes.Equal(a.PublicKey(app), a.PublicKey([]byte("other app"))) {
+		t.Fatal("same key for different apps")
+	}
+}
+
+// TestShortFrames sends commands in frames too short for them, as
+// from a broken client. They get an error response, not a panic.
+func TestShortFrames(t *testing.T) {
+	udiBE, _ := hex.DecodeString("0133708200000001")
+
+	emu, err := New(Config{UDI: udiBE, Firmware: []byte("firmware")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := func(endpoint byte, l byte, cmd byte) []byte {
+		f := make([]byte, 1+bytelen(l))
+		f[0] = endpoint<<3 | l
+		f[1] = cmd
+
+		return f
+	}
+
+	tests := []struct {
+		name    string
+		running bool
+		frame   []byte
+		code    byte
+	}{
+		{"load app", false, frame(endpointFW, len1, cmdLoadApp), rspLoadApp},
+		{"load app without USS", false, frame(endpointFW, len32, cmdLoadApp), rspLoadApp},
+		{"set size", true, frame(endpointApp, len1, appCmdSetSize), appRspSetSize},
+		{"firmware digest", true, frame(endpointApp, len1, appCmdGetFirmwareHash), appRspGetFirmwareHash},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			emu.Reset()
+			emu.running = test.running
+
+			var out bytes.Buffer
+			rw := struct {
+				io.Reader
+				io.Writer
+			}{bytes.NewReader(test.frame), &out}
+
+			if err := emu.ServeConn(rw); err != nil {
+				t.Fatal(err)
+			}
+
+			rsp := out.Bytes()
+			if len(rsp) < 3 || rsp[1] != test.code || rsp[2] != statusBad {
+				t.Fatalf("unexpected response %x", rsp)
+			}
+		})
+	}
+}
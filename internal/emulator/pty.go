@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// PTY is an emulated TKey on a pseudo terminal, used like the serial
+// port of a real TKey.
+type PTY struct {
+	*Emulator
+	ptmx *os.File
+	path string
+
+	// ResetOnClose puts the TKey back in firmware mode when the
+	// client closes the port, as if it was plugged in again.
+	// Otherwise the app keeps running, as on a real TKey.
+	ResetOnClose bool
+}
+
+// OpenPTY opens a new pseudo terminal for the emulator. Serve answers
+// commands on it.
+func (e *Emulator) OpenPTY() (*PTY, error) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open PTY: %w", err)
+	}
+	defer tty.Close()
+
+	// No echo or line editing, the framing protocol is binary.
+	if _, err = term.MakeRaw(int(tty.Fd())); err != nil {
+		ptmx.Close()
+		return nil, fmt.Errorf("couldn't set PTY in raw mode: %w", err)
+	}
+
+	return &PTY{
+		Emulator: e,
+		ptmx:     ptmx,
+		path:     tty.Name(),
+	}, nil
+}
+
+// Path returns the path of the port to connect to.
+func (p *PTY) Path() string {
+	return p.path
+}
+
+// Serve answers commands from one client after the other, until the
+// PTY is closed.
+func (p *PTY) Serve() error {
+	for {
+		frames := p.handled()
+
+		err := p.ServeConn(p.ptmx)
+		if !errors.Is(err, syscall.EIO) {
+			return err
+		}
+
+		// EIO means no client has the port open. If we have
+		// talked to one since last time, it has gone away.
+		if p.handled() != frames {
+			p.logf("Client closed the port\n")
+
+			if p.ResetOnClose {
+				p.Reset()
+			}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Close closes the PTY.
+func (p *PTY) Close() error {
+	if err := p.ptmx.Close(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func (p *PTY) handled() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.frames
+}
@@ -0,0 +1,295 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package fetch gets small files, like verification files, over
+// HTTP.
+//
+// Proxies are taken from the environment variables HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY. Requests are retried with backoff on
+// errors that might be temporary. Errors are reported with a Kind so
+// the user can be told what went wrong.
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+	DefaultRetries = 3
+	DefaultBackoff = time.Second
+	// DefaultMaxSize is much larger than any verification file or
+	// revocation list.
+	DefaultMaxSize = 1 << 20
+)
+
+// Kind is the category of a fetch error.
+type Kind int
+
+const (
+	KindNetwork Kind = iota
+	KindDNS
+	KindTLS
+	KindTimeout
+	KindStatus
+	KindTooLarge
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindDNS:
+		return "DNS lookup failed"
+	case KindTLS:
+		return "TLS failed"
+	case KindTimeout:
+		return "timeout"
+	case KindStatus:
+		return "HTTP error"
+	case KindTooLarge:
+		return "response too large"
+	}
+
+	return "network error"
+}
+
+// ErrNotFound is wrapped by an Error of KindStatus if the server
+// answered 404 Not Found.
+var ErrNotFound = errors.New("not found")
+
+// Error describes a failed fetch.
+type Error struct {
+	Kind       Kind
+	URL        string
+	StatusCode int // Only for KindStatus
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v accessing %v: %v", e.Kind, e.URL, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// temporary returns true if trying again might help.
+func (e *Error) temporary() bool {
+	switch e.Kind {
+	case KindNetwork, KindTimeout:
+		return true
+	case KindStatus:
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+	}
+
+	return false
+}
+
+// Config configures a Fetcher. Zero values mean defaults.
+type Config struct {
+	Timeout time.Duration // Per attempt
+	Retries int           // Retries after the first attempt, -1 for none
+	Backoff time.Duration // Wait before first retry, doubled for each retry
+	MaxSize int64         // Max size of body in bytes
+	CAFile  string        // Extra PEM CA certificates to trust
+}
+
+type Fetcher struct {
+	client  *http.Client
+	retries int
+	backoff time.Duration
+	maxSize int64
+}
+
+// New returns a Fetcher configured by conf.
+func New(conf Config) (*Fetcher, error) {
+	f := Fetcher{
+		retries: conf.Retries,
+		backoff: conf.Backoff,
+		maxSize: conf.MaxSize,
+	}
+
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	switch {
+	case f.retries == 0:
+		f.retries = DefaultRetries
+	case f.retries < 0:
+		f.retries = 0
+	}
+
+	if f.backoff == 0 {
+		f.backoff = DefaultBackoff
+	}
+
+	if f.maxSize == 0 {
+		f.maxSize = DefaultMaxSize
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("unexpected default HTTP transport")
+	}
+	transport = transport.Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if conf.CAFile != "" {
+		pool, err := certPool(conf.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	f.client = &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+
+	return &f, nil
+}
+
+// Default returns a Fetcher with the default configuration.
+func Default() *Fetcher {
+	f, err := New(Config{})
+	if err != nil {
+		// Only if the standard library changes under us.
+		panic(err)
+	}
+
+	return f
+}
+
+// certPool returns the system CA certificates with the ones in the
+// PEM file fn added.
+func certPool(fn string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %v", fn)
+	}
+
+	return pool, nil
+}
+
+// Get gets the body of url, retrying on temporary errors. Any error
+// returned is an *Error.
+func (f *Fetcher) Get(url string) ([]byte, error) {
+	return f.GetContext(context.Background(), url)
+}
+
+// GetContext is like Get but gives up when ctx is done.
+func (f *Fetcher) GetContext(ctx context.Context, url string) ([]byte, error) {
+	wait := f.backoff
+
+	for attempt := 0; ; attempt++ {
+		body, err := f.get(ctx, url)
+		if err == nil {
+			return body, nil
+		}
+
+		if attempt >= f.retries || !err.temporary() {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, &Error{Kind: kindOf(ctx.Err()), URL: url, Err: ctx.Err()}
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+	}
+}
+
+func (f *Fetcher) get(ctx context.Context, url string) ([]byte, *Error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, &Error{Kind: KindNetwork, URL: url, Err: err}
+	}
+
+	resp, err := f.client.Do(req) // #nosec G107
+	if err != nil {
+		return nil, &Error{Kind: kindOf(err), URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		e := &Error{
+			Kind:       KindStatus,
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			Err:        errors.New(resp.Status),
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			e.Err = fmt.Errorf("%v: %w", resp.Status, ErrNotFound)
+		}
+
+		return nil, e
+	}
+
+	// Read one byte more than allowed to know if it's too large.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxSize+1))
+	if err != nil {
+		return nil, &Error{Kind: kindOf(err), URL: url, Err: fmt.Errorf("couldn't read body: %w", err)}
+	}
+
+	if int64(len(body)) > f.maxSize {
+		return nil, &Error{Kind: KindTooLarge, URL: url, Err: fmt.Errorf("more than %d bytes", f.maxSize)}
+	}
+
+	return body, nil
+}
+
+func kindOf(err error) Kind {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout {
+			return KindTimeout
+		}
+
+		return KindDNS
+	case errors.As(err, &certErr), errors.As(err, &recordErr),
+		errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr),
+		errors.As(err, &invalidErr):
+		return KindTLS
+	case errors.Is(err, context.DeadlineExceeded):
+		return KindTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return KindTimeout
+	}
+
+	return KindNetwork
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFetcher(t *testing.T, conf Config) *Fetcher {
+	t.Helper()
+
+	conf.Backoff = time.Millisecond
+
+	f, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func TestGetRetries(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	body, err := testFetcher(t, Config{}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "hello" || attempts != 3 {
+		t.Fatalf("got %q after %d attempts", body, attempts)
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_, err := testFetcher(t, Config{}).Get(srv.URL)
+
+	var fErr *Error
+	if !errors.As(err, &fErr) || fErr.Kind != KindStatus || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if attempts != 1 {
+		t.Fatalf("retried a 404, %d attempts", attempts)
+	}
+}
+
+func TestGetTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("a", 11)))
+	}))
+	defer srv.Close()
+
+	_, err := testFetcher(t, Config{MaxSize: 10}).Get(srv.URL)
+
+	var fErr *Error
+	if !errors.As(err, &fErr) || fErr.Kind != KindTooLarge {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	body, err := testFetcher(t, Config{MaxSize: 11}).Get(srv.URL)
+	if err != nil || len(body) != 11 {
+		t.Fatalf("got %d bytes, %v", len(body), err)
+	}
+}
+
+func TestGetTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	_, err := testFetcher(t, Config{}).Get(srv.URL)
+
+	var fErr *Error
+	if !errors.As(err, &fErr) || fErr.Kind != KindTLS {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
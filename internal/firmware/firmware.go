@@ -4,11 +4,13 @@
 package firmware
 
 import (
+	"bytes"
 	"crypto/sha512"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -17,9 +19,11 @@ import (
 	"github.com/tillitis/tkey-verification/internal/util"
 )
 
+// Bounds on the size of a firmware we accept in the database and
+// ask a TKey to hash.
 const (
-	fwSizeMin int = 2000
-	fwSizeMax int = 8192
+	SizeMin int = 2000
+	SizeMax int = 8192
 )
 
 type Hardware struct {
@@ -29,11 +33,34 @@ type Hardware struct {
 	ProductRev uint8
 	FwSize     int
 	FwHash     [sha512.Size]byte
+	FwLabel    string
 }
 
 type Firmware struct {
-	Hash [sha512.Size]byte
-	Size int
+	Hash  [sha512.Size]byte
+	Size  int
+	Label string // Optional name, like "TK1-24.03"
+}
+
+var (
+	// ErrFirmwareNotFound means we don't know the firmware of
+	// the hardware.
+	ErrFirmwareNotFound = errors.New("firmware not found")
+
+	// ErrFirmwareMismatch means a TKey doesn't have the expected
+	// firmware.
+	ErrFirmwareMismatch = errors.New("unexpected firmware")
+)
+
+// Check returns an error wrapping ErrFirmwareMismatch if digest
+// isn't the digest of f.
+func (f Firmware) Check(digest []byte) error {
+	if !bytes.Equal(f.Hash[:], digest) {
+		return fmt.Errorf("%w: TKey does not have expected firmware hash %0x…, but instead %0x…",
+			ErrFirmwareMismatch, f.Hash[:16], digest[:min(16, len(digest))])
+	}
+
+	return nil
 }
 
 // Firmwares is a dictionary of all known firmwares, index by the
@@ -56,7 +83,7 @@ func (f Firmwares) GetFirmware(udi tkey.UDI) (Firmware, error) {
 
 	fw, ok = f.firmwares[*hw]
 	if !ok {
-		return fw, errors.New("firmware not found")
+		return fw, ErrFirmwareNotFound
 	}
 
 	return fw, nil
@@ -72,6 +99,88 @@ func (f Firmwares) List() []string {
 	return list
 }
 
+// Sizes returns all distinct firmware sizes in the database in
+// ascending order.
+func (f Firmwares) Sizes() []int {
+	seen := map[int]bool{}
+	sizes := []int{}
+
+	for _, fw := range f.firmwares {
+		if !seen[fw.Size] {
+			seen[fw.Size] = true
+			sizes = append(sizes, fw.Size)
+		}
+	}
+
+	sort.Ints(sizes)
+
+	return sizes
+}
+
+// Lookup returns all known hardware that is expected to run a
+// firmware of size fwSize with digest fwHash. The returned list is
+// empty if the firmware is unknown.
+func (f Firmwares) Lookup(fwSize int, fwHash []byte) []Hardware {
+	hws := []Hardware{}
+
+	for hw, fw := range f.firmwares {
+		if fw.Size != fwSize || !bytes.Equal(fw.Hash[:], fwHash) {
+			continue
+		}
+
+		hws = append(hws, Hardware{
+			Udi:        hw.toUDI0BEhex(),
+			VendorID:   hw.VendorID,
+			ProductID:  hw.ProductID,
+			ProductRev: hw.ProductRev,
+			FwSize:     fw.Size,
+			FwHash:     fw.Hash,
+			FwLabel:    fw.Label,
+		})
+	}
+
+	sort.Slice(hws, func(i, j int) bool {
+		return hws[i].Udi < hws[j].Udi
+	})
+
+	return hws
+}
+
+// String returns the hardware as a line in the format used in
+// data.FirmwaresConf.
+func (h Hardware) String() string {
+	s := fmt.Sprintf("%s %04x %d %d %d %x", h.Udi, h.VendorID, h.ProductID, h.ProductRev, h.FwSize, h.FwHash)
+	if h.FwLabel != "" {
+		s += " " + h.FwLabel
+	}
+
+	return s
+}
+
+// NewHardware describes the hardware identified by udi running a
+// firmware of size fwSize with digest fwHash.
+func NewHardware(udi tkey.UDI, fwSize int, fwHash []byte) (Hardware, error) {
+	var h Hardware
+
+	hw, err := newHardware(udi.VendorID, udi.ProductID, udi.ProductRev)
+	if err != nil {
+		return h, err
+	}
+
+	if l := len(fwHash); l != sha512.Size {
+		return h, errors.New("wrong length of firmware digest")
+	}
+
+	h.Udi = hw.toUDI0BEhex()
+	h.VendorID = hw.VendorID
+	h.ProductID = hw.ProductID
+	h.ProductRev = hw.ProductRev
+	h.FwSize = fwSize
+	copy(h.FwHash[:], fwHash)
+
+	return h, nil
+}
+
 func (f *Firmwares) FromString(fwStr string) error {
 	lines := strings.Split(strings.Trim(strings.ReplaceAll(fwStr, "\r\n", "\n"), "\n"), "\n")
 
@@ -86,8 +195,8 @@ func (f *Firmwares) FromString(fwStr string) error {
 			continue
 		}
 
-		if len(fields) != 6 {
-			return errors.New("expected 6 fields: UDI0 vendor product rev size hash")
+		if len(fields) != 6 && len(fields) != 7 {
+			return errors.New("expected 6 or 7 fields: UDI0 vendor product rev size hash [label]")
 		}
 
 		udi0Str, vendorStr, productStr, revStr, sizeStr, hashStr := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
@@ -96,6 +205,10 @@ func (f *Firmwares) FromString(fwStr string) error {
 
 		hw.Udi = udi0Str
 
+		if len(fields) == 7 {
+			hw.FwLabel = fields[6]
+		}
+
 		var err error
 		var vid uint64
 
@@ -127,7 +240,7 @@ func (f *Firmwares) FromString(fwStr string) error {
 			return fmt.Errorf("%w", err)
 		}
 
-		if err := f.addFirmware(hw.Udi, hw.VendorID, hw.ProductID, hw.ProductRev, hw.FwSize, hashStr); err != nil {
+		if err := f.addFirmware(hw.Udi, hw.VendorID, hw.ProductID, hw.ProductRev, hw.FwSize, hashStr, hw.FwLabel); err != nil {
 			return err
 		}
 	}
@@ -164,8 +277,9 @@ func NewFirmwares() (Firmwares, error) {
 // the first UDI word (UDI0) which must then match the argument
 // udi0BEhex. For example, given the hardware triple argument (0x10,
 // 8, 3) the udi0BEhex argument must be "00010203" (this is the
-// default UDI0 in FPGA bitstream and QEMU machine).
-func (f *Firmwares) addFirmware(udi0BEhex string, vendorID uint16, productID uint8, productRev uint8, fwSize int, fwHashHex string) error {
+// default UDI0 in FPGA bitstream and QEMU machine). The fwLabel is
+// an optional name of the firmware.
+func (f *Firmwares) addFirmware(udi0BEhex string, vendorID uint16, productID uint8, productRev uint8, fwSize int, fwHashHex string, fwLabel string) error {
 	udi0BE, err := hex.DecodeString(udi0BEhex)
 	if err != nil {
 		return fmt.Errorf("couldn't decode UDI: %w", err)
@@ -179,10 +293,10 @@ func (f *Firmwares) addFirmware(udi0BEhex string, vendorID uint16, productID uin
 		return err
 	}
 
-	if fwSize < fwSizeMin {
+	if fwSize < SizeMin {
 		return errors.New("too small firmware size")
 	}
-	if fwSize > fwSizeMax {
+	if fwSize > SizeMax {
 		return errors.New("too large firmware size")
 	}
 
@@ -204,8 +318,9 @@ func (f *Firmwares) addFirmware(udi0BEhex string, vendorID uint16, productID uin
 	}
 
 	f.firmwares[*hw] = Firmware{
-		Hash: fwHash,
-		Size: fwSize,
+		Hash:  fwHash,
+		Size:  fwSize,
+		Label: fwLabel,
 	}
 
 	return nil
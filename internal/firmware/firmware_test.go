@@ -4,10 +4,16 @@
 package firmware
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
 	"strings"
 	"testing"
 
 	"github.com/tillitis/tkey-verification/internal/data"
+	"github.com/tillitis/tkey-verification/internal/revocation"
+	"github.com/tillitis/tkey-verification/internal/tkey"
 )
 
 func TestParseEmbeddedFirmwares(t *testing.T) {
@@ -26,40 +32,106 @@ func TestWrongFirmware(t *testing.T) {
 	}
 
 	// Not hex. Err should be filled
-	err := f.addFirmware("oo", 01, 02, 03, 4711, validFwHashHex)
+	err := f.addFirmware("oo", 01, 02, 03, 4711, validFwHashHex, "")
 	assertErrorMsgStartsWith(t, err, "couldn't decode UDI: ")
 
 	// Wrong UDI length
-	err = f.addFirmware("000102", 16, 8, 3, 4711, validFwHashHex)
+	err = f.addFirmware("000102", 16, 8, 3, 4711, validFwHashHex, "")
 	assertErrorMsgStartsWith(t, err, "wrong length of UDI0")
 
 	// firmware too small
-	err = f.addFirmware("00010203", 16, 8, 3, 1999, validFwHashHex)
+	err = f.addFirmware("00010203", 16, 8, 3, 1999, validFwHashHex, "")
 	assertErrorMsgStartsWith(t, err, "too small firmware size")
 
 	// firmware too big
-	err = f.addFirmware("00010203", 16, 8, 3, 8193, validFwHashHex)
+	err = f.addFirmware("00010203", 16, 8, 3, 8193, validFwHashHex, "")
 	assertErrorMsgStartsWith(t, err, "too large firmware size")
 
 	// Broken firmware digest hex
-	err = f.addFirmware("00010203", 16, 8, 3, 8192, "oo")
+	err = f.addFirmware("00010203", 16, 8, 3, 8192, "oo", "")
 	assertErrorMsgStartsWith(t, err, "encoding/hex: invalid byte: U+006F 'o'")
 
 	// Wrong length of firmware digest hex
-	err = f.addFirmware("00010203", 16, 8, 3, 8192, "ffff")
+	err = f.addFirmware("00010203", 16, 8, 3, 8192, "ffff", "")
 	assertErrorMsgStartsWith(t, err, "unexpected length of hex data, expected 64, got 2")
 
 	// Wrong UDI0 compared to calculated UDI0
-	err = f.addFirmware("00010203", 01, 02, 03, 8192, validFwHashHex)
+	err = f.addFirmware("00010203", 01, 02, 03, 8192, validFwHashHex, "")
 	assertErrorMsgStartsWith(t, err, "udi0BEhex arg != calculated")
 
 	// Add same hardware twice
-	err = f.addFirmware("00010203", 16, 8, 3, 4711, validFwHashHex)
+	err = f.addFirmware("00010203", 16, 8, 3, 4711, validFwHashHex, "")
 	assertNoError(t, err)
-	err = f.addFirmware("00010203", 16, 8, 3, 4711, validFwHashHex)
+	err = f.addFirmware("00010203", 16, 8, 3, 4711, validFwHashHex, "")
 	assertErrorMsgStartsWith(t, err, "hardware with same UDI")
 }
 
+func TestLookupFirmware(t *testing.T) {
+	var f Firmwares
+
+	if err := f.FromString(data.FirmwaresConf); err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := f.Sizes()
+	if len(sizes) != 2 || sizes[0] != 4160 || sizes[1] != 4192 {
+		t.Fatalf("unexpected firmware sizes %v", sizes)
+	}
+
+	fwHash, err := hex.DecodeString(validFwHashHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hws := f.Lookup(4160, fwHash)
+	if len(hws) != 1 || hws[0].Udi != "01337082" || hws[0].FwLabel != "TK1-24.03" {
+		t.Fatalf("unexpected hardware %v", hws)
+	}
+
+	if hws := f.Lookup(4192, fwHash); len(hws) != 0 {
+		t.Fatalf("expected no hardware, got %v", hws)
+	}
+
+	// The description of a hardware must be accepted by the
+	// database.
+	var g Firmwares
+	if err := g.FromString(hws[0].String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckFirmware(t *testing.T) {
+	var f Firmwares
+
+	if err := f.FromString(data.FirmwaresConf); err != nil {
+		t.Fatal(err)
+	}
+
+	var udi tkey.UDI
+	if err := udi.FromBE([]byte{0x01, 0x33, 0x70, 0x82, 0, 0, 0, 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	fw, err := f.GetFirmware(udi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = fw.Check(fw.Hash[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	err = fw.Check(make([]byte, 64))
+	if !errors.Is(err, ErrFirmwareMismatch) {
+		t.Fatalf("expected ErrFirmwareMismatch, got %v", err)
+	}
+
+	udi.ProductRev = 63
+	if _, err = f.GetFirmware(udi); !errors.Is(err, ErrFirmwareNotFound) {
+		t.Fatalf("expected ErrFirmwareNotFound, got %v", err)
+	}
+}
+
 func assertNoError(t *testing.T, err error) {
 	t.Helper()
 
@@ -83,3 +155,114 @@ func assertErrorMsgStartsWith(t *testing.T, err error, want string) {
 		t.Fail()
 	}
 }
+
+func TestUpdate(t *testing.T) {
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	sign := func(message []byte) ([]byte, error) {
+		return ed25519.Sign(priv, message), nil
+	}
+
+	var trusted [ed25519.PublicKeySize]byte
+	copy(trusted[:], priv.Public().(ed25519.PublicKey))
+
+	f, err := NewFirmwares()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newer := "01337083 1337 2 3 4160 " + validFwHashHex + " TK1-next\n"
+
+	signed, err := Sign(data.FirmwaresConf+newer, sign)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = f.Update(signed, nil); err == nil {
+		t.Fatal("expected error without trusted keys")
+	}
+
+	// Changed after signing
+	if _, err = f.Update(strings.Replace(signed, "TK1-next", "TK1-nope", 1), [][ed25519.PublicKeySize]byte{trusted}); err == nil {
+		t.Fatal("expected error for modified update")
+	}
+
+	added, err := f.Update(signed, [][ed25519.PublicKeySize]byte{trusted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(added) != 1 || added[0].String() != strings.TrimSuffix(newer, "\n") {
+		t.Fatalf("unexpected firmwares added: %v", added)
+	}
+
+	var udi tkey.UDI
+	udiBE, _ := hex.DecodeString("0133708300000001")
+	if err = udi.FromBE(udiBE); err != nil {
+		t.Fatal(err)
+	}
+
+	if fw, err := f.GetFirmware(udi); err != nil || fw.Label != "TK1-next" {
+		t.Fatalf("updated firmware not found: %v", err)
+	}
+
+	// Another firmware for known hardware
+	signed, err = Sign("01337082 1337 2 2 4160 "+strings.Repeat("00", 64)+"\n", sign)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = f.Update(signed, [][ed25519.PublicKeySize]byte{trusted}); err == nil {
+		t.Fatal("expected error for replaced firmware")
+	}
+
+	if _, err = Sign("not a firmware\n", sign); err == nil {
+		t.Fatal("expected error signing a broken database")
+	}
+}
+
+// TestUpdateEmbeddedKeys checks that an update signed by a key set at
+// build time, as by make REVOCATION_PUBKEYS, is accepted and one
+// signed by any other key isn't.
+func TestUpdateEmbeddedKeys(t *testing.T) {
+	vendor := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))
+
+	embedded := data.RevocationPubKeys
+	t.Cleanup(func() { data.RevocationPubKeys = embedded })
+
+	data.RevocationPubKeys = hex.EncodeToString(vendor.Public().(ed25519.PublicKey))
+
+	trusted, err := revocation.ParseTrusted(data.RevocationPubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newer := "01337083 1337 2 3 4160 " + validFwHashHex + " TK1-next\n"
+
+	for _, tc := range []struct {
+		key ed25519.PrivateKey
+		ok  bool
+	}{
+		{other, false},
+		{vendor, true},
+	} {
+		var signed string
+		var f Firmwares
+
+		signed, err = Sign(newer, func(message []byte) ([]byte, error) {
+			return ed25519.Sign(tc.key, message), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err = NewFirmwares()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = f.Update(signed, trusted); (err == nil) != tc.ok {
+			t.Fatalf("key %x: unexpected result %v", tc.key.Public(), err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package firmware
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tillitis/tkey-verification/internal/util"
+)
+
+// A firmware database update is a firmware database, in the format
+// of data.FirmwaresConf, with a last line
+//
+//	signature <signature in hex>
+//
+// It is an Ed25519 signature over SignaturePrefix followed by all
+// preceding lines, made with a revocation signing key.
+
+// SignaturePrefix separates signatures over firmware databases from
+// anything else made with the same key, like revocation lists.
+const SignaturePrefix = "tkey-verification firmware database v1\n"
+
+// Sign signs the firmware database in body with sign and returns the
+// signed database. The body is parsed before signing to avoid
+// signing something that can't be used.
+func Sign(body string, sign func(message []byte) ([]byte, error)) (string, error) {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+
+	var f Firmwares
+	if err := f.FromString(body); err != nil {
+		return "", err
+	}
+
+	signed, err := util.SignList(body, SignaturePrefix, sign)
+	if err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	return signed, nil
+}
+
+// Update adds the firmwares of hardware not already in f from the
+// signed firmware database s, verified against any of the trusted
+// public keys. A known firmware is never replaced: a different
+// firmware for hardware already in f is an error. It returns the
+// hardware added.
+func (f *Firmwares) Update(s string, trusted [][ed25519.PublicKeySize]byte) ([]Hardware, error) {
+	body, err := util.VerifyList(s, SignaturePrefix, "firmware database", trusted)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	var update Firmwares
+	if err = update.FromString(body); err != nil {
+		return nil, err
+	}
+
+	for hw, fw := range update.firmwares {
+		if known, ok := f.firmwares[hw]; ok && (known.Hash != fw.Hash || known.Size != fw.Size) {
+			return nil, fmt.Errorf("firmware database update has another firmware for known hardware 0x%s", hw.toUDI0BEhex())
+		}
+	}
+
+	if f.firmwares == nil {
+		f.firmwares = make(map[hardware]Firmware)
+	}
+
+	added := []Hardware{}
+
+	for hw, fw := range update.firmwares {
+		if _, ok := f.firmwares[hw]; ok {
+			continue
+		}
+
+		f.firmwares[hw] = fw
+		added = append(added, Hardware{
+			Udi:        hw.toUDI0BEhex(),
+			VendorID:   hw.VendorID,
+			ProductID:  hw.ProductID,
+			ProductRev: hw.ProductRev,
+			FwSize:     fw.Size,
+			FwHash:     fw.Hash,
+			FwLabel:    fw.Label,
+		})
+	}
+
+	sort.Slice(added, func(i, j int) bool {
+		return added[i].Udi < added[j].Udi
+	})
+
+	return added, nil
+}
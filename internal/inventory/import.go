@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package inventory
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+	"github.com/tillitis/tkey-verification/internal/submission"
+	"github.com/tillitis/tkey-verification/internal/tkey"
+	"github.com/tillitis/tkey-verification/internal/verification"
+)
+
+// Dirs are the directories provisioning leaves files in, all with
+// files named after the UDI in hex. Empty directories are skipped.
+type Dirs struct {
+	Submissions          string // Signed by serve-signer, not yet logged
+	ProcessedSubmissions string // Logged by tkey-sigsum-submit
+	Verifications        string // Written by tkey-sigsum-submit
+	Published            string // Verification files on the verification server
+}
+
+// Import adds what is known about each TKey in dirs to s. The submit
+// keys are named as in log.
+//
+// Files that can't be parsed are passed to skip, and otherwise
+// ignored. It returns the number of files imported.
+func Import(s Store, dirs Dirs, log sigsum.Log, skip func(fn string, err error)) (int, error) {
+	imported := 0
+
+	for _, d := range []struct {
+		dir   string
+		state State
+		fn    func(fn string, udi tkey.UDI, state State, log sigsum.Log) (Device, error)
+	}{
+		{dirs.Submissions, StatePending, fromSubmission},
+		{dirs.ProcessedSubmissions, StateLogged, fromSubmission},
+		{dirs.Verifications, StateLogged, fromVerification},
+		{dirs.Published, StatePublished, fromVerification},
+	} {
+		if d.dir == "" {
+			continue
+		}
+
+		entries, err := os.ReadDir(d.dir)
+		if err != nil {
+			return imported, fmt.Errorf("%w", err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+
+			fn := path.Join(d.dir, entry.Name())
+
+			udiBE, err := hex.DecodeString(entry.Name())
+			if err != nil || len(udiBE) != tkey.UDISize {
+				skip(fn, errors.New("not named after a UDI"))
+				continue
+			}
+
+			var udi tkey.UDI
+			if err = udi.FromBE(udiBE); err != nil {
+				skip(fn, err)
+				continue
+			}
+
+			dev, err := d.fn(fn, udi, d.state, log)
+			if err != nil {
+				skip(fn, err)
+				continue
+			}
+
+			if err = s.Put(dev); err != nil {
+				return imported, err
+			}
+
+			imported++
+		}
+	}
+
+	return imported, nil
+}
+
+func newDevice(udi tkey.UDI, state State) Device {
+	return Device{
+		UDI:        hex.EncodeToString(udi.Bytes),
+		ProductID:  udi.ProductID,
+		ProductRev: udi.ProductRev,
+		State:      state,
+	}
+}
+
+func fromSubmission(fn string, udi tkey.UDI, state State, log sigsum.Log) (Device, error) {
+	var subm submission.Submission
+	if err := subm.FromFile(fn); err != nil {
+		return Device{}, err
+	}
+
+	if len(subm.UDI) != 0 && !bytes.Equal(subm.UDI, udi.Bytes) {
+		return Device{}, fmt.Errorf("submission for UDI %s", hex.EncodeToString(subm.UDI))
+	}
+
+	d := newDevice(udi, state)
+	d.Provisioned = subm.Timestamp
+	d.Station = subm.Station
+	d.StationCert = subm.StationCert
+	d.AppTag = subm.AppTag
+
+	if key, ok := log.Keys[subm.Request.PublicKey]; ok {
+		d.SubmitKey = key.Name
+	} else {
+		d.SubmitKey = hex.EncodeToString(subm.Request.PublicKey[:])
+	}
+
+	return d, nil
+}
+
+func fromVerification(fn string, udi tkey.UDI, state State, log sigsum.Log) (Device, error) {
+	var ver verification.Verification
+	if err := ver.FromFile(fn, udi.Bytes); err != nil {
+		return Device{}, err
+	}
+
+	d := newDevice(udi, state)
+	d.Provisioned = ver.Timestamp
+	d.AppTag = ver.AppTag
+
+	if !ver.IsProof() {
+		if state == StateLogged {
+			d.State = StateSigned
+		}
+
+		return d, nil
+	}
+
+	if key, err := log.SubmitKey(ver.Proof.Leaf.KeyHash); err == nil {
+		d.SubmitKey = key.Name
+	} else {
+		d.SubmitKey = hex.EncodeToString(ver.Proof.Leaf.KeyHash[:])
+	}
+
+	logIndex := ver.Proof.Inclusion.LeafIndex
+	d.LogIndex = &logIndex
+
+	return d, nil
+}
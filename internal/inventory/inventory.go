@@ -0,0 +1,474 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package inventory keeps track of the TKeys a vendor has
+// provisioned, and how far each has come in the submission process.
+package inventory
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // SQLite driver, pure Go
+)
+
+// State is how far the verification data of a TKey has come.
+type State string
+
+const (
+	// StatePending is a signed submission not yet sent to the
+	// Sigsum log.
+	StatePending State = "pending"
+	// StateSigned is verification data with a vendor signature,
+	// from before we used Sigsum.
+	StateSigned State = "signed"
+	// StateLogged is a submission logged in the Sigsum log, with
+	// a verification file.
+	StateLogged State = "logged"
+	// StatePublished is verification data published on the
+	// verification server.
+	StatePublished State = "published"
+)
+
+func (s State) rank() int {
+	switch s {
+	case StatePending:
+		return 1
+	case StateSigned, StateLogged:
+		return 2
+	case StatePublished:
+		return 3
+	}
+
+	return 0
+}
+
+// ParseState parses a state name.
+func ParseState(s string) (State, error) {
+	state := State(s)
+	if state.rank() == 0 {
+		return "", fmt.Errorf("unknown state %q", s)
+	}
+
+	return state, nil
+}
+
+// ErrNotFound means the UDI isn't in the inventory.
+var ErrNotFound = errors.New("UDI not in inventory")
+
+// Device is a provisioned TKey.
+type Device struct {
+	UDI         string    `json:"udi"` // Big Endian, in hex
+	ProductID   uint8     `json:"product_id"`
+	ProductRev  uint8     `json:"product_rev"`
+	Provisioned time.Time `json:"provisioned"`
+	Station     string    `json:"station,omitempty"`      // Common name of the station client cert
+	StationCert string    `json:"station_cert,omitempty"` // SHA-256 of the station client cert
+	AppTag      string    `json:"apptag"`
+	SubmitKey   string    `json:"submit_key,omitempty"`
+	State       State     `json:"state"`
+	LogIndex    *uint64   `json:"log_index,omitempty"`
+}
+
+// Merge returns d updated with what is known in n about the same
+// TKey. The state never goes backwards.
+func (d Device) Merge(n Device) Device {
+	if d.Provisioned.IsZero() || (!n.Provisioned.IsZero() && n.Provisioned.Before(d.Provisioned)) {
+		d.Provisioned = n.Provisioned
+	}
+
+	if n.Station != "" {
+		d.Station = n.Station
+	}
+
+	if n.StationCert != "" {
+		d.StationCert = n.StationCert
+	}
+
+	if n.AppTag != "" {
+		d.AppTag = n.AppTag
+	}
+
+	if n.SubmitKey != "" {
+		d.SubmitKey = n.SubmitKey
+	}
+
+	if n.State.rank() > d.State.rank() {
+		d.State = n.State
+	}
+
+	if n.LogIndex != nil {
+		d.LogIndex = n.LogIndex
+	}
+
+	return d
+}
+
+// Store is where the inventory is kept.
+type Store interface {
+	// Put adds d, or merges it into what is already known about
+	// the same UDI.
+	Put(d Device) error
+	// Get returns the TKey with udi, or ErrNotFound.
+	Get(udi string) (Device, error)
+	// All returns all TKeys, ordered by UDI.
+	All() ([]Device, error)
+	// Close closes the inventory.
+	Close() error
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS devices (
+	udi          TEXT PRIMARY KEY,
+	product_id   INTEGER NOT NULL,
+	product_rev  INTEGER NOT NULL,
+	provisioned  TEXT NOT NULL,
+	station      TEXT NOT NULL,
+	station_cert TEXT NOT NULL,
+	apptag       TEXT NOT NULL,
+	submit_key   TEXT NOT NULL,
+	state        TEXT NOT NULL,
+	log_index    INTEGER
+)`
+
+const deviceColumns = `udi, product_id, product_rev, provisioned, station, station_cert, apptag, submit_key, state, log_index`
+
+// DB is a Store in an SQLite database file.
+//
+// Every Put is a transaction taking the write lock at once, so
+// several processes can add to the same inventory without losing
+// each other's records. A writer waits for the lock for up to
+// busyTimeout.
+type DB struct {
+	db *sql.DB
+}
+
+// busyTimeout is how long to wait for another writer, in
+// milliseconds.
+const busyTimeout = 10000
+
+// Open opens the inventory in the SQLite database fn, creating it if
+// missing.
+func Open(fn string) (*DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_txlock=immediate", fn, busyTimeout)
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if _, err = db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("couldn't create inventory: %w", err)
+	}
+
+	return &DB{db: db}, nil
+}
+
+// Rebuild removes all TKeys and lets fill add them again, in one
+// transaction. If fill fails the inventory is left as it was, and
+// other processes never see it half filled.
+func (s *DB) Rebuild(fill func(Store) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	// Undoes nothing after Commit
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.Exec(`DELETE FROM devices`); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if err = fill(txStore{tx: tx}); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func (s *DB) Put(d Device) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	// Undoes nothing after Commit
+	defer func() { _ = tx.Rollback() }()
+
+	if err = put(tx, d); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func (s *DB) Get(udi string) (Device, error) {
+	return get(s.db, udi)
+}
+
+func (s *DB) All() ([]Device, error) {
+	return all(s.db)
+}
+
+func (s *DB) Close() error {
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// txStore is a Store in a transaction, see Rebuild.
+type txStore struct {
+	tx *sql.Tx
+}
+
+func (t txStore) Put(d Device) error {
+	return put(t.tx, d)
+}
+
+func (t txStore) Get(udi string) (Device, error) {
+	return get(t.tx, udi)
+}
+
+func (t txStore) All() ([]Device, error) {
+	return all(t.tx)
+}
+
+// Close does nothing, the transaction ends with Rebuild.
+func (t txStore) Close() error {
+	return nil
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// put merges d into the inventory in tx.
+func put(tx *sql.Tx, d Device) error {
+	if d.UDI == "" {
+		return errors.New("no UDI")
+	}
+
+	old, err := scanDevice(tx.QueryRow(`SELECT `+deviceColumns+` FROM devices WHERE udi = ?`, d.UDI))
+	switch {
+	case err == nil:
+		d = old.Merge(d)
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+
+	var provisioned string
+	if !d.Provisioned.IsZero() {
+		provisioned = d.Provisioned.UTC().Format(time.RFC3339Nano)
+	}
+
+	var logIndex sql.NullInt64
+	if d.LogIndex != nil {
+		if *d.LogIndex > math.MaxInt64 {
+			return errors.New("log index out of range")
+		}
+
+		logIndex = sql.NullInt64{Int64: int64(*d.LogIndex), Valid: true}
+	}
+
+	if _, err = tx.Exec(`INSERT OR REPLACE INTO devices (`+deviceColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.UDI, d.ProductID, d.ProductRev, provisioned, d.Station, d.StationCert,
+		d.AppTag, d.SubmitKey, string(d.State), logIndex); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func get(q querier, udi string) (Device, error) {
+	return scanDevice(q.QueryRow(`SELECT `+deviceColumns+` FROM devices WHERE udi = ?`, udi))
+}
+
+func all(q querier) ([]Device, error) {
+	rows, err := q.Query(`SELECT ` + deviceColumns + ` FROM devices ORDER BY udi`)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	defer rows.Close()
+
+	var devices []Device
+
+	for rows.Next() {
+		var d Device
+		if d, err = scanDevice(rows); err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return devices, nil
+}
+
+// scanDevice reads a row with deviceColumns.
+func scanDevice(row interface{ Scan(dest ...any) error }) (Device, error) {
+	var d Device
+	var provisioned, state string
+	var logIndex sql.NullInt64
+
+	err := row.Scan(&d.UDI, &d.ProductID, &d.ProductRev, &provisioned, &d.Station, &d.StationCert,
+		&d.AppTag, &d.SubmitKey, &state, &logIndex)
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, ErrNotFound
+	} else if err != nil {
+		return d, fmt.Errorf("%w", err)
+	}
+
+	if provisioned != "" {
+		if d.Provisioned, err = time.Parse(time.RFC3339Nano, provisioned); err != nil {
+			return d, fmt.Errorf("TKey %s: %w", d.UDI, err)
+		}
+	}
+
+	d.State = State(state)
+
+	if logIndex.Valid {
+		i := uint64(logIndex.Int64) // nolint:gosec // never stored negative
+		d.LogIndex = &i
+	}
+
+	return d, nil
+}
+
+// Filter selects TKeys in a query. Zero fields match anything.
+type Filter struct {
+	UDI       string // Prefix of the UDI in hex
+	ProductID *uint8
+	State     State
+	Station   string
+	AppTag    string
+	Since     time.Time // Provisioned at or after
+	Until     time.Time // Provisioned before
+}
+
+func (f Filter) Match(d Device) bool {
+	switch {
+	case f.UDI != "" && !strings.HasPrefix(d.UDI, strings.ToLower(f.UDI)):
+		return false
+	case f.ProductID != nil && d.ProductID != *f.ProductID:
+		return false
+	case f.State != "" && d.State != f.State:
+		return false
+	case f.Station != "" && d.Station != f.Station:
+		return false
+	case f.AppTag != "" && d.AppTag != f.AppTag:
+		return false
+	case !f.Since.IsZero() && d.Provisioned.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !d.Provisioned.Before(f.Until):
+		return false
+	}
+
+	return true
+}
+
+// Query returns the TKeys in s matching f, ordered by UDI.
+func Query(s Store, f Filter) ([]Device, error) {
+	all, err := s.All()
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	for _, d := range all {
+		if f.Match(d) {
+			devices = append(devices, d)
+		}
+	}
+
+	return devices, nil
+}
+
+var csvHeader = []string{
+	"udi", "product_id", "product_rev", "provisioned", "station", "station_cert",
+	"apptag", "submit_key", "state", "log_index",
+}
+
+// WriteCSV writes devices as CSV with a header line.
+func WriteCSV(w io.Writer, devices []Device) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(csvHeader); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	for _, d := range devices {
+		var logIndex string
+		if d.LogIndex != nil {
+			logIndex = strconv.FormatUint(*d.LogIndex, 10)
+		}
+
+		var provisioned string
+		if !d.Provisioned.IsZero() {
+			provisioned = d.Provisioned.UTC().Format(time.RFC3339)
+		}
+
+		if err := cw.Write([]string{
+			d.UDI,
+			strconv.Itoa(int(d.ProductID)),
+			strconv.Itoa(int(d.ProductRev)),
+			provisioned,
+			d.Station,
+			d.StationCert,
+			d.AppTag,
+			d.SubmitKey,
+			string(d.State),
+			logIndex,
+		}); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// WriteJSON writes devices as a JSON array.
+func WriteJSON(w io.Writer, devices []Device) error {
+	if devices == nil {
+		devices = []Device{}
+	}
+
+	b, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal JSON: %w", err)
+	}
+
+	if _, err = w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
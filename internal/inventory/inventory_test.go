@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package inventory
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+)
+
+const submJSON = `
+{
+  "udi":"0133708200000001",
+  "timestamp":"2025-09-02T10:56:48Z",
+  "apptag":"signer-v1.0.1",
+  "apphash":"cd3c4f433f84648428113bd0a0cc407b2150e925a51b478006321e5a903c1638ce807138d1cc1f8f03cfb6236a87de0febde3ce0ddf177208e5483d1c169bac4",
+  "request":"message=f23e454ee9c9627dd1a80f6ab2e1565fa0cda3a7c91f853eb8099ff645674719\nsignature=b4f9eabdcb6b05d259e964ba6fa427c178b5586d30e6b4026287656c8a7ee2674af33d2c05701ea8f98458fe7c54b787c7a73c0fda6f09046bcf7604cea86c00\npublic_key=50d9a125f51d85ffa1fb12011bdae05d39e03cda2a35d0daf3077072daabbb10\n",
+  "station":"station-1"
+}
+`
+
+func TestMerge(t *testing.T) {
+	logIndex := uint64(4711)
+	provisioned := time.Date(2025, 9, 2, 10, 56, 48, 0, time.UTC)
+
+	d := Device{UDI: "0133708200000001", State: StatePublished, Station: "station-1"}
+	d = d.Merge(Device{UDI: d.UDI, State: StatePending, Provisioned: provisioned, LogIndex: &logIndex})
+
+	if d.State != StatePublished {
+		t.Fatalf("state went back to %s", d.State)
+	}
+
+	if d.Station != "station-1" || !d.Provisioned.Equal(provisioned) || d.LogIndex == nil || *d.LogIndex != logIndex {
+		t.Fatalf("unexpected merge %+v", d)
+	}
+}
+
+func TestDB(t *testing.T) {
+	fn := path.Join(t.TempDir(), "inventory.db")
+
+	s, err := Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logIndex := uint64(4711)
+	provisioned := time.Date(2025, 9, 2, 10, 56, 48, 0, time.UTC)
+
+	for _, d := range []Device{
+		{UDI: "0133708200000002", ProductID: 2, State: StateLogged, Station: "station-2", Provisioned: provisioned, LogIndex: &logIndex},
+		{UDI: "0133708200000001", ProductID: 2, State: StatePending, Station: "station-1"},
+		{UDI: "0133704100000001", ProductID: 1, State: StateSigned},
+		{UDI: "0133708200000002", State: StatePending, AppTag: "signer-v1.0.1"},
+	} {
+		if err = s.Put(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	all, err := s.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 3 || all[0].UDI != "0133704100000001" {
+		t.Fatalf("unexpected inventory %+v", all)
+	}
+
+	if _, err = s.Get("0133708200000003"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	d, err := s.Get("0133708200000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.State != StateLogged || d.AppTag != "signer-v1.0.1" || !d.Provisioned.Equal(provisioned) ||
+		d.LogIndex == nil || *d.LogIndex != logIndex {
+		t.Fatalf("not merged %+v", d)
+	}
+
+	productID := uint8(2)
+	devices, err := Query(s, Filter{ProductID: &productID, State: StateLogged})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(devices) != 1 || devices[0].Station != "station-2" {
+		t.Fatalf("unexpected query result %+v", devices)
+	}
+
+	var buf bytes.Buffer
+	if err = WriteCSV(&buf, devices); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "0133708200000002,2,0,2025-09-02T10:56:48Z,station-2,") {
+		t.Fatalf("unexpected CSV %q", buf.String())
+	}
+
+	errFill := errors.New("fill failed")
+	if err = s.Rebuild(func(tx Store) error {
+		if putErr := tx.Put(Device{UDI: "0133708200000003", State: StatePending}); putErr != nil {
+			return putErr
+		}
+
+		return errFill
+	}); !errors.Is(err, errFill) {
+		t.Fatalf("expected fill error, got %v", err)
+	}
+
+	if all, err = s.All(); err != nil || len(all) != 3 {
+		t.Fatalf("failed rebuild changed the inventory: %+v %v", all, err)
+	}
+
+	if err = s.Rebuild(func(Store) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if all, err = s.All(); err != nil || len(all) != 0 {
+		t.Fatalf("not rebuilt: %+v %v", all, err)
+	}
+}
+
+// TestDBConcurrent writes to the same inventory from several
+// connections at once, like several provisioning processes.
+func TestDBConcurrent(t *testing.T) {
+	fn := path.Join(t.TempDir(), "inventory.db")
+
+	const writers, devices = 4, 25
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			s, err := Open(fn)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer s.Close()
+
+			for i := 0; i < devices; i++ {
+				// Every writer adds its own TKeys and updates
+				// a shared one.
+				for _, d := range []Device{
+					{UDI: fmt.Sprintf("01337082%02x%06x", w, i), State: StatePending},
+					{UDI: "01337041ffffffff", State: StatePending, Station: fmt.Sprintf("station-%d", w)},
+				} {
+					if err = s.Put(d); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	s, err := Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	all, err := s.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != writers*devices+1 {
+		t.Fatalf("expected %d TKeys, got %d", writers*devices+1, len(all))
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(path.Join(dir, "0133708200000001"), []byte(submJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path.Join(dir, "README"), []byte("not a submission"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(path.Join(t.TempDir(), "inventory.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var skipped []string
+	n, err := Import(s, Dirs{Submissions: dir}, sigsum.Log{}, func(fn string, _ error) {
+		skipped = append(skipped, path.Base(fn))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 || len(skipped) != 1 || skipped[0] != "README" {
+		t.Fatalf("imported %d, skipped %v", n, skipped)
+	}
+
+	d, err := s.Get("0133708200000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.State != StatePending || d.ProductID != 2 || d.Station != "station-1" || d.AppTag != "signer-v1.0.1" {
+		t.Fatalf("unexpected device %+v", d)
+	}
+
+	if d.SubmitKey != "50d9a125f51d85ffa1fb12011bdae05d39e03cda2a35d0daf3077072daabbb10" {
+		t.Fatalf("unexpected submit key %s", d.SubmitKey)
+	}
+}
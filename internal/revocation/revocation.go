@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package revocation handles signed lists of revoked keys.
+//
+// A revocation list is a text file with one revocation per line:
+//
+//	# Comment
+//	timestamp 2025-10-01T12:00:00Z
+//	revoke <pubkey in hex> <compromise time, RFC3339> <reason...>
+//	signature <signature in hex>
+//
+// The signature line must be last. It is an Ed25519 signature over
+// SignaturePrefix followed by all preceding lines, including their
+// trailing newlines.
+package revocation
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/util"
+)
+
+// SignaturePrefix separates signatures over revocation lists from
+// anything else made with the same key.
+const SignaturePrefix = "tkey-verification revocation list v1\n"
+
+type Revocation struct {
+	Key    [ed25519.PublicKeySize]byte
+	Time   time.Time // When the key was compromised
+	Reason string
+}
+
+func (r Revocation) String() string {
+	return fmt.Sprintf("revoke %x %s %s", r.Key, r.Time.UTC().Format(time.RFC3339), r.Reason)
+}
+
+type List struct {
+	Timestamp   time.Time
+	Revocations map[[ed25519.PublicKeySize]byte]Revocation
+}
+
+// Revoked returns the revocation of key, if any.
+func (l List) Revoked(key [ed25519.PublicKeySize]byte) (Revocation, bool) {
+	r, ok := l.Revocations[key]
+
+	return r, ok
+}
+
+// FromString parses a signed revocation list and verifies its
+// signature against any of the trusted public keys.
+func (l *List) FromString(s string, trusted [][ed25519.PublicKeySize]byte) error {
+	body, err := util.VerifyList(s, SignaturePrefix, "revocation list", trusted)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return l.parse(body)
+}
+
+// FromFile reads and verifies a signed revocation list from file
+// fn. See FromString.
+func (l *List) FromFile(fn string, trusted [][ed25519.PublicKeySize]byte) error {
+	s, err := os.ReadFile(fn)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return l.FromString(string(s), trusted)
+}
+
+// Signer signs a message, typically with a TKey.
+type Signer interface {
+	Sign(message []byte) ([]byte, error)
+}
+
+// Sign signs an unsigned revocation list in body with signer and
+// returns the signed list. The body is parsed before signing to
+// avoid signing something that can't be used.
+func Sign(body string, signer Signer) (string, error) {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+
+	var l List
+	if err := l.parse(body); err != nil {
+		return "", err
+	}
+
+	signed, err := util.SignList(body, SignaturePrefix, signer.Sign)
+	if err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	return signed, nil
+}
+
+func (l *List) parse(body string) error {
+	l.Timestamp = time.Time{}
+	l.Revocations = make(map[[ed25519.PublicKeySize]byte]Revocation)
+
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			// ignoring empty/spaces-only lines and comments
+			continue
+		}
+
+		switch fields[0] {
+		case "timestamp":
+			if len(fields) != 2 {
+				return errors.New("expected timestamp line: timestamp time")
+			}
+
+			ts, err := time.Parse(time.RFC3339, fields[1])
+			if err != nil {
+				return fmt.Errorf("couldn't parse revocation list timestamp: %w", err)
+			}
+
+			l.Timestamp = ts
+
+		case "revoke":
+			if len(fields) < 4 {
+				return errors.New("expected revoke line: revoke pubkey time reason")
+			}
+
+			var r Revocation
+
+			if err := util.DecodeHex(r.Key[:], fields[1]); err != nil {
+				return fmt.Errorf("couldn't decode revoked public key: %w", err)
+			}
+
+			ts, err := time.Parse(time.RFC3339, fields[2])
+			if err != nil {
+				return fmt.Errorf("couldn't parse revocation time: %w", err)
+			}
+
+			r.Time = ts
+			r.Reason = strings.Join(fields[3:], " ")
+
+			if _, ok := l.Revocations[r.Key]; ok {
+				return errors.New("public key revoked twice")
+			}
+
+			l.Revocations[r.Key] = r
+
+		default:
+			return fmt.Errorf("unknown revocation list line: %v", fields[0])
+		}
+	}
+
+	if l.Timestamp.IsZero() {
+		return errors.New("revocation list timestamp missing")
+	}
+
+	return nil
+}
+
+// ParseTrusted parses public keys trusted to sign revocation lists,
+// in hex, one per line or separated by commas.
+func ParseTrusted(s string) ([][ed25519.PublicKeySize]byte, error) {
+	var keys [][ed25519.PublicKeySize]byte
+
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ',' }) {
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var key [ed25519.PublicKeySize]byte
+		if err := util.DecodeHex(key[:], fields[0]); err != nil {
+			return nil, fmt.Errorf("couldn't decode revocation signing key: %w", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package revocation
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tillitis/tkey-verification/internal/data"
+)
+
+const revocationList = `# Test revocations
+timestamp 2025-10-01T12:00:00Z
+revoke 14274d3570097aea209af1c23b64aa439a4d0d32c62735c5f6d6a29600c9a275 2025-09-01T00:00:00Z leaked during testing
+`
+
+type testSigner struct {
+	privKey ed25519.PrivateKey
+}
+
+func (s testSigner) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(s.privKey, message), nil
+}
+
+func newTestSigner() (testSigner, [ed25519.PublicKeySize]byte) {
+	seed := make([]byte, ed25519.SeedSize)
+	privKey := ed25519.NewKeyFromSeed(seed)
+
+	var pubKey [ed25519.PublicKeySize]byte
+	copy(pubKey[:], privKey[32:])
+
+	return testSigner{privKey: privKey}, pubKey
+}
+
+func TestParseEmbeddedTrusted(t *testing.T) {
+	if _, err := ParseTrusted(data.RevocationPubKeys); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTrusted(t *testing.T) {
+	_, pubKey := newTestSigner()
+
+	keys, err := ParseTrusted(fmt.Sprintf("# Test key\n%x\n", pubKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || keys[0] != pubKey {
+		t.Fatalf("unexpected keys %x", keys)
+	}
+
+	// As set by make REVOCATION_PUBKEYS.
+	keys, err = ParseTrusted(fmt.Sprintf("%x,%x", pubKey, pubKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys[1] != pubKey {
+		t.Fatalf("unexpected keys %x", keys)
+	}
+
+	if _, err = ParseTrusted("00\n"); err == nil {
+		t.Fatal("expected error for short key")
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer, pubKey := newTestSigner()
+
+	signed, err := Sign(revocationList, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var l List
+	if err = l.FromString(signed, [][ed25519.PublicKeySize]byte{pubKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l.Revocations) != 1 {
+		t.Fatalf("expected 1 revocation, got %d", len(l.Revocations))
+	}
+
+	for key, r := range l.Revocations {
+		if r.Reason != "leaked during testing" {
+			t.Fatalf("unexpected reason %q", r.Reason)
+		}
+
+		if _, ok := l.Revoked(key); !ok {
+			t.Fatal("key not revoked")
+		}
+	}
+
+	var notRevoked [ed25519.PublicKeySize]byte
+	if _, ok := l.Revoked(notRevoked); ok {
+		t.Fatal("unexpected key revoked")
+	}
+}
+
+func TestTamperedList(t *testing.T) {
+	signer, pubKey := newTestSigner()
+
+	signed, err := Sign(revocationList, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var l List
+
+	tampered := strings.Replace(signed, "leaked during testing", "lost", 1)
+	err = l.FromString(tampered, [][ed25519.PublicKeySize]byte{pubKey})
+	assertErrorMsgStartsWith(t, err, "revocation list signature not verified")
+
+	err = l.FromString(revocationList, [][ed25519.PublicKeySize]byte{pubKey})
+	assertErrorMsgStartsWith(t, err, "revocation list not signed")
+
+	var otherKey [ed25519.PublicKeySize]byte
+	err = l.FromString(signed, [][ed25519.PublicKeySize]byte{otherKey})
+	assertErrorMsgStartsWith(t, err, "revocation list signature not verified")
+}
+
+func TestSignInvalidList(t *testing.T) {
+	signer, _ := newTestSigner()
+
+	_, err := Sign("revoke 00 2025-09-01T00:00:00Z lost\n", signer)
+	assertErrorMsgStartsWith(t, err, "couldn't decode revoked public key")
+
+	_, err = Sign("# only a comment\n", signer)
+	assertErrorMsgStartsWith(t, err, "revocation list timestamp missing")
+}
+
+func assertErrorMsgStartsWith(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if err == nil {
+		t.Log("Expected error")
+		t.Fail()
+		return
+	}
+
+	if !strings.HasPrefix(err.Error(), want) {
+		t.Logf("Unexpected error '%v', should start with '%v'", err, want)
+		t.Fail()
+	}
+}
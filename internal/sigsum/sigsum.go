@@ -17,12 +17,18 @@ import (
 
 	"github.com/tillitis/tkey-verification/internal/appbins"
 	"github.com/tillitis/tkey-verification/internal/data"
+	"github.com/tillitis/tkey-verification/internal/revocation"
+	"github.com/tillitis/tkey-verification/internal/ssh"
 	"github.com/tillitis/tkey-verification/internal/util"
 	sumcrypto "sigsum.org/sigsum-go/pkg/crypto"
 	"sigsum.org/sigsum-go/pkg/key"
 	"sigsum.org/sigsum-go/pkg/policy"
 )
 
+// ErrUnknownSubmitKey means something was logged with a submit key
+// that isn't ours.
+var ErrUnknownSubmitKey = errors.New("couldn't find submit key")
+
 type PubKey struct {
 	Name    string
 	Key     [ed25519.PublicKeySize]byte // Vendor public key
@@ -31,10 +37,28 @@ type PubKey struct {
 	AppBin  appbins.AppBin              // The actual device app binary
 	Start   time.Time
 	End     time.Time
+
+	Revoked      bool
+	RevokedAt    time.Time // Time of compromise
+	RevokeReason string
 }
 
 func (p PubKey) String() string {
-	return fmt.Sprintf("%v using app %v: %x\n  Valid: %v - %v\n", p.Name, p.Tag, p.Key, p.Start.Format(time.RFC3339), p.End.Format(time.RFC3339))
+	s := fmt.Sprintf("%v using app %v: %x\n  Valid: %v - %v\n", p.Name, p.Tag, p.Key, p.Start.Format(time.RFC3339), p.End.Format(time.RFC3339))
+
+	if p.Revoked {
+		s += fmt.Sprintf("  REVOKED: compromised %v: %v\n", p.RevokedAt.Format(time.RFC3339), p.RevokeReason)
+	}
+
+	return s
+}
+
+// Entry formats p as an entry in the Sigsum configuration, as read
+// by ParseKeys.
+func (p PubKey) Entry() string {
+	return fmt.Sprintf("%s\n%s%s\n%x\n%s\n%s\n",
+		p.Name, ssh.FormatPublicEd25519(p.Key), p.Tag, p.AppHash,
+		p.Start.Format(time.RFC3339), p.End.Format(time.RFC3339))
 }
 
 type Log struct {
@@ -155,6 +179,31 @@ func ParseKeys(r io.Reader, appBins appbins.AppBins) (map[[ed25519.PublicKeySize
 	return pubKeys, nil
 }
 
+// Revoke marks all submit keys in the revocation list as revoked from
+// their time of compromise.
+func (s *Log) Revoke(list revocation.List) {
+	for k, key := range s.Keys {
+		if r, ok := list.Revoked(key.Key); ok {
+			key.Revoked = true
+			key.RevokedAt = r.Time
+			key.RevokeReason = r.Reason
+			s.Keys[k] = key
+		}
+	}
+}
+
+// SubmitKey returns our submit key with the digest keyHash, as in a
+// Sigsum leaf. It returns ErrUnknownSubmitKey if there is none.
+func (s *Log) SubmitKey(keyHash sumcrypto.Hash) (PubKey, error) {
+	for k, key := range s.Keys {
+		if sumcrypto.HashBytes(k[:]) == keyHash {
+			return key, nil
+		}
+	}
+
+	return PubKey{}, ErrUnknownSubmitKey
+}
+
 func (s *Log) FromEmbedded() error {
 	return s.FromString(data.SigsumConf, data.PolicyStr)
 }
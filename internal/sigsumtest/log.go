@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package sigsumtest is a Sigsum log with a cosigning witness, run
+// in memory, to test provisioning against without the real log.
+//
+// The log sequences every leaf as soon as it is added, and the
+// witness cosigns every tree head, at the time set with SetTime.
+package sigsumtest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sigsum.org/sigsum-go/pkg/crypto"
+	"sigsum.org/sigsum-go/pkg/merkle"
+	"sigsum.org/sigsum-go/pkg/requests"
+	"sigsum.org/sigsum-go/pkg/types"
+)
+
+// Log is a Sigsum log and witness served over HTTP.
+type Log struct {
+	LogKey     crypto.PublicKey
+	WitnessKey crypto.PublicKey
+
+	logSigner     crypto.Signer
+	witnessSigner crypto.Signer
+	server        *httptest.Server
+
+	mu     sync.Mutex
+	leaves []crypto.Hash // Leaf hashes, in order
+	now    time.Time     // Zero means the current time
+}
+
+// NewLog starts a log with a few leaves already logged. Close it
+// when done.
+func NewLog() (*Log, error) {
+	var l Log
+	var err error
+
+	if l.LogKey, l.logSigner, err = newKeyPair(); err != nil {
+		return nil, err
+	}
+
+	if l.WitnessKey, l.witnessSigner, err = newKeyPair(); err != nil {
+		return nil, err
+	}
+
+	// Someone else's leaves, so inclusion proofs aren't trivial.
+	for i := range 3 {
+		l.leaves = append(l.leaves, merkle.HashLeafNode([]byte(fmt.Sprintf("other leaf %d", i))))
+	}
+
+	l.server = httptest.NewServer(&l)
+
+	return &l, nil
+}
+
+func newKeyPair() (crypto.PublicKey, crypto.Signer, error) {
+	pub, signer, err := crypto.NewKeyPair()
+	if err != nil {
+		return pub, nil, fmt.Errorf("%w", err)
+	}
+
+	return pub, signer, nil
+}
+
+// URL returns the URL of the log.
+func (l *Log) URL() string {
+	return l.server.URL
+}
+
+// Close stops the log.
+func (l *Log) Close() {
+	l.server.Close()
+}
+
+// Policy returns a Sigsum policy trusting the log and demanding a
+// cosignature from the witness.
+func (l *Log) Policy() string {
+	return fmt.Sprintf("log %x %s\nwitness witness %x\ngroup witnesses all witness\nquorum witnesses\n",
+		l.LogKey[:], l.URL(), l.WitnessKey[:])
+}
+
+// SetTime sets the time the witness cosigns at. The zero time means
+// the current time.
+func (l *Log) SetTime(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.now = t
+}
+
+// Size returns the number of leaves in the log.
+func (l *Log) Size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.leaves)
+}
+
+func (l *Log) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := strings.TrimPrefix(r.URL.Path, "/")
+
+	var err error
+	status := http.StatusOK
+
+	switch {
+	case endpoint == "add-leaf" && r.Method == http.MethodPost:
+		status, err = l.addLeaf(r)
+	case endpoint == "get-tree-head" && r.Method == http.MethodGet:
+		status, err = l.getTreeHead(w)
+	case strings.HasPrefix(endpoint, "get-inclusion-proof/") && r.Method == http.MethodGet:
+		status, err = l.getInclusionProof(w, strings.TrimPrefix(endpoint, "get-inclusion-proof/"))
+	default:
+		status, err = http.StatusNotFound, errors.New("unknown endpoint")
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+	}
+}
+
+func (l *Log) addLeaf(r *http.Request) (int, error) {
+	var req requests.Leaf
+	if err := req.FromASCII(r.Body); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("%w", err)
+	}
+
+	leaf, err := req.Verify()
+	if err != nil {
+		return http.StatusForbidden, fmt.Errorf("%w", err)
+	}
+
+	leafHash := merkle.HashLeafNode(leaf.ToBinary())
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, h := range l.leaves {
+		if h == leafHash {
+			return http.StatusOK, nil
+		}
+	}
+
+	// Sequenced at once, so always persisted.
+	l.leaves = append(l.leaves, leafHash)
+
+	return http.StatusOK, nil
+}
+
+func (l *Log) getTreeHead(w http.ResponseWriter) (int, error) {
+	l.mu.Lock()
+	th := types.TreeHead{
+		Size:     uint64(len(l.leaves)),
+		RootHash: rootHash(l.leaves),
+	}
+	now := l.now
+	l.mu.Unlock()
+
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	sth, err := th.Sign(l.logSigner)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("%w", err)
+	}
+
+	logKeyHash := crypto.HashBytes(l.LogKey[:])
+	cosig, err := th.Cosign(l.witnessSigner, &logKeyHash, uint64(now.Unix()))
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("%w", err)
+	}
+
+	cth := types.CosignedTreeHead{
+		SignedTreeHead: sth,
+		Cosignatures:   []types.Cosignature{cosig},
+	}
+
+	if err = cth.ToASCII(w); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("%w", err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func (l *Log) getInclusionProof(w http.ResponseWriter, args string) (int, error) {
+	sizeStr, hashHex, ok := strings.Cut(args, "/")
+	if !ok {
+		return http.StatusBadRequest, errors.New("expected size and leaf hash")
+	}
+
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("%w", err)
+	}
+
+	leafHash, err := crypto.HashFromHex(hashHex)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("%w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if size < 2 || size > len(l.leaves) {
+		return http.StatusBadRequest, fmt.Errorf("no inclusion proof for tree size %d", size)
+	}
+
+	for i, h := range l.leaves[:size] {
+		if h == leafHash {
+			proof := types.InclusionProof{
+				LeafIndex: uint64(i),
+				Path:      inclusionPath(i, l.leaves[:size]),
+			}
+
+			if err = proof.ToASCII(w); err != nil {
+				return http.StatusInternalServerError, fmt.Errorf("%w", err)
+			}
+
+			return http.StatusOK, nil
+		}
+	}
+
+	return http.StatusNotFound, errors.New("leaf not found")
+}
+
+// split returns the largest power of two smaller than n, where the
+// tree of n leaves is split in two, as in RFC 6962.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+
+	return k
+}
+
+func rootHash(leaves []crypto.Hash) crypto.Hash {
+	switch len(leaves) {
+	case 0:
+		return crypto.HashBytes(nil)
+	case 1:
+		return leaves[0]
+	}
+
+	k := split(len(leaves))
+	left, right := rootHash(leaves[:k]), rootHash(leaves[k:])
+
+	return merkle.HashInteriorNode(&left, &right)
+}
+
+// inclusionPath returns the audit path of leaf m, as PATH in RFC
+// 6962.
+func inclusionPath(m int, leaves []crypto.Hash) []crypto.Hash {
+	if len(leaves) <= 1 {
+		return nil
+	}
+
+	k := split(len(leaves))
+	if m < k {
+		return append(inclusionPath(m, leaves[:k]), rootHash(leaves[k:]))
+	}
+
+	return append(inclusionPath(m-k, leaves[k:]), rootHash(leaves[:k]))
+}
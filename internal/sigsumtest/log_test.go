@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package sigsumtest
+
+import (
+	"fmt"
+	"testing"
+
+	"sigsum.org/sigsum-go/pkg/crypto"
+	"sigsum.org/sigsum-go/pkg/merkle"
+)
+
+func TestInclusionPath(t *testing.T) {
+	var leaves []crypto.Hash
+
+	for n := 1; n <= 9; n++ {
+		leaves = append(leaves, merkle.HashLeafNode([]byte(fmt.Sprintf("leaf %d", n))))
+		root := rootHash(leaves)
+
+		for m := range leaves {
+			path := inclusionPath(m, leaves)
+			if err := merkle.VerifyInclusion(&leaves[m], uint64(m), uint64(n), &root, path); err != nil {
+				t.Fatalf("leaf %d in tree of %d: %v", m, n, err)
+			}
+		}
+	}
+}
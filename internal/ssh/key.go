@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Key is an OpenSSH public key of any type, including certificates,
+// as found on a line in an authorized_keys file.
+type Key struct {
+	Pub     gossh.PublicKey
+	Comment string
+	Options []string // authorized_keys options, like "restrict"
+}
+
+// ParseKey parses a public key in the OpenSSH format, optionally
+// with authorized_keys options first and a comment last, like
+//
+//	restrict,from="10.0.0.0/8" ssh-ed25519 AAAA... comment
+//
+// Lines that are empty or comments are skipped. Anything after the
+// first key is an error.
+func ParseKey(s string) (Key, error) {
+	keys, err := ParseAuthorizedKeys([]byte(s))
+	if err != nil {
+		return Key{}, err
+	}
+
+	if len(keys) != 1 {
+		return Key{}, fmt.Errorf("expected one public key, got %d", len(keys))
+	}
+
+	return keys[0], nil
+}
+
+// ParseAuthorizedKeys parses all public keys in b, in the format of
+// an authorized_keys file. Empty lines and comments are skipped, but
+// unlike sshd any other line that isn't a valid key is an error.
+func ParseAuthorizedKeys(b []byte) ([]Key, error) {
+	var keys []Key
+
+	for i, line := range bytes.Split(b, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		var k Key
+		var err error
+
+		k.Pub, k.Comment, k.Options, _, err = gossh.ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// ReadAuthorizedKeys parses the authorized_keys file fn.
+func ReadAuthorizedKeys(fn string) ([]Key, error) {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return ParseAuthorizedKeys(b)
+}
+
+// NewKey returns an ssh-ed25519 key with comment.
+func NewKey(pub PublicKey, comment string) Key {
+	// Only fails on key types it doesn't know.
+	k, _ := gossh.NewPublicKey(ed25519.PublicKey(pub[:]))
+
+	return Key{
+		Pub:     k,
+		Comment: comment,
+	}
+}
+
+// Type returns the key type, like "ssh-ed25519" or
+// "ssh-ed25519-cert-v01@openssh.com".
+func (k Key) Type() string {
+	return k.Pub.Type()
+}
+
+// Certificate returns the OpenSSH certificate, if the key is one.
+func (k Key) Certificate() (*gossh.Certificate, bool) {
+	cert, ok := k.Pub.(*gossh.Certificate)
+
+	return cert, ok
+}
+
+// CheckCertificate checks that the certificate k is signed by one of
+// authorities and is for principal, which must be listed in it. It
+// doesn't check when the certificate is valid, see Validity.
+func (k Key) CheckCertificate(authorities []Key, principal string) error {
+	cert, ok := k.Certificate()
+	if !ok {
+		return fmt.Errorf("%s isn't a certificate", k.Fingerprint())
+	}
+
+	if !slices.ContainsFunc(authorities, func(ca Key) bool { return ca.Equal(Key{Pub: cert.SignatureKey}) }) {
+		return fmt.Errorf("certificate %s signed by unknown authority %s", k.Fingerprint(), gossh.FingerprintSHA256(cert.SignatureKey))
+	}
+
+	// An empty list means any principal to OpenSSH, but we want
+	// to know what the certificate is for
+	if !slices.Contains(cert.ValidPrincipals, principal) {
+		return fmt.Errorf("certificate %s not for %s, only %q", k.Fingerprint(), principal, cert.ValidPrincipals)
+	}
+
+	if cert.ValidAfter > math.MaxInt64 || (cert.ValidBefore > math.MaxInt64 && cert.ValidBefore != gossh.CertTimeInfinity) {
+		return fmt.Errorf("certificate %s valid out of range", k.Fingerprint())
+	}
+
+	// Checks the signature, but also the validity at the clock,
+	// so make it the start of it
+	checker := gossh.CertChecker{
+		Clock: func() time.Time {
+			return time.Unix(int64(cert.ValidAfter), 0)
+		},
+	}
+
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return fmt.Errorf("certificate %s: %w", k.Fingerprint(), err)
+	}
+
+	return nil
+}
+
+// Validity returns when the certificate k is valid, from and before
+// to. A zero to means forever. Both are zero if k isn't a
+// certificate.
+func (k Key) Validity() (time.Time, time.Time) {
+	var from, to time.Time
+
+	cert, ok := k.Certificate()
+	if !ok {
+		return from, to
+	}
+
+	from = time.Unix(int64(min(cert.ValidAfter, math.MaxInt64)), 0).UTC()
+
+	if cert.ValidBefore != gossh.CertTimeInfinity {
+		to = time.Unix(int64(min(cert.ValidBefore, math.MaxInt64)), 0).UTC()
+	}
+
+	return from, to
+}
+
+// plain returns the key of a certificate, or the key itself.
+func plain(pub gossh.PublicKey) gossh.PublicKey {
+	if cert, ok := pub.(*gossh.Certificate); ok {
+		return cert.Key
+	}
+
+	return pub
+}
+
+// Ed25519 returns the Ed25519 public key, also the one of an
+// Ed25519 certificate.
+func (k Key) Ed25519() (PublicKey, error) {
+	pub := plain(k.Pub)
+
+	if pub.Type() != gossh.KeyAlgoED25519 {
+		return PublicKey{}, fmt.Errorf("unsupported public key type: %v", k.Type())
+	}
+
+	return parsePublicEd25519(pub.Marshal())
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key, as output
+// by "ssh-keygen -l", like "SHA256:Ghb1...".
+func (k Key) Fingerprint() string {
+	return gossh.FingerprintSHA256(k.Pub)
+}
+
+// Equal reports whether k and other are the same key, regardless of
+// comment and options.
+func (k Key) Equal(other Key) bool {
+	return k.Pub != nil && other.Pub != nil && bytes.Equal(k.Pub.Marshal(), other.Pub.Marshal())
+}
+
+// String formats the key as a line in an authorized_keys file, with
+// options and comment, without a newline.
+func (k Key) String() string {
+	var fields []string
+
+	if len(k.Options) > 0 {
+		fields = append(fields, strings.Join(k.Options, ","))
+	}
+
+	fields = append(fields, strings.TrimSuffix(string(gossh.MarshalAuthorizedKey(k.Pub)), "\n"))
+
+	if k.Comment != "" {
+		fields = append(fields, k.Comment)
+	}
+
+	return strings.Join(fields, " ")
+}
@@ -90,7 +90,13 @@ func ParsePublicEd25519(asciiKey string) (PublicKey, error) {
 }
 
 func FormatPublicEd25519(pub [ed25519.PublicKeySize]byte) string {
+	return FormatPublicEd25519Comment(pub, "sigsum key")
+}
+
+// FormatPublicEd25519Comment formats pub as a line in the OpenSSH
+// public key format, as in authorized_keys, with comment.
+func FormatPublicEd25519Comment(pub [ed25519.PublicKeySize]byte, comment string) string {
 	return "ssh-ed25519 " +
 		base64.StdEncoding.EncodeToString(serializePublicEd25519(pub)) +
-		" sigsum key\n"
+		" " + comment + "\n"
 }
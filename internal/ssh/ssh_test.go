@@ -0,0 +1,327 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func testKey(t *testing.T, seed byte) (ed25519.PrivateKey, PublicKey) {
+	t.Helper()
+
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+
+	var pub PublicKey
+	copy(pub[:], priv.Public().(ed25519.PublicKey))
+
+	return priv, pub
+}
+
+func TestParseKey(t *testing.T) {
+	_, pub := testKey(t, 1)
+
+	line := `restrict,command="echo \"hi\"" ` + strings.TrimSuffix(FormatPublicEd25519Comment(pub, "tkey 1"), "\n")
+
+	k, err := ParseKey(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k.Type() != "ssh-ed25519" || k.Comment != "tkey 1" || len(k.Options) != 2 {
+		t.Fatalf("unexpected key %v %q %v", k.Type(), k.Comment, k.Options)
+	}
+
+	if k.String() != line {
+		t.Fatalf("formatted as %q, expected %q", k.String(), line)
+	}
+
+	got, err := k.Ed25519()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != pub {
+		t.Fatal("wrong Ed25519 key")
+	}
+
+	// The old parser agrees
+	old, err := ParsePublicEd25519(FormatPublicEd25519(pub))
+	if err != nil || old != pub {
+		t.Fatalf("ParsePublicEd25519: %v", err)
+	}
+
+	if !strings.HasPrefix(k.Fingerprint(), "SHA256:") {
+		t.Fatalf("unexpected fingerprint %s", k.Fingerprint())
+	}
+
+	if _, err = ParseKey(line + "\n" + line); err == nil {
+		t.Fatal("expected error for two keys")
+	}
+}
+
+func TestParseAuthorizedKeys(t *testing.T) {
+	_, pub1 := testKey(t, 1)
+	_, pub2 := testKey(t, 2)
+
+	file := "# TKeys\n\n" + FormatPublicEd25519Comment(pub1, "one") + "  \n" + FormatPublicEd25519Comment(pub2, "two")
+
+	keys, err := ParseAuthorizedKeys([]byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys[0].Comment != "one" || keys[1].Comment != "two" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	if keys[0].Equal(keys[1]) || !keys[0].Equal(NewKey(pub1, "")) {
+		t.Fatal("Equal doesn't compare keys")
+	}
+
+	_, err = ParseAuthorizedKeys([]byte(file + "\nssh-ed25519 AAAAnotakey\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 7:") {
+		t.Fatalf("expected error on line 7, got %v", err)
+	}
+}
+
+func TestCertificate(t *testing.T) {
+	caPriv, _ := testKey(t, 1)
+	_, pub := testKey(t, 2)
+
+	ca, err := NewSigner(caPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := &gossh.Certificate{
+		Key:             NewKey(pub, "").Pub,
+		CertType:        gossh.UserCert,
+		KeyId:           "tkey",
+		ValidPrincipals: []string{"tkey"},
+		ValidBefore:     gossh.CertTimeInfinity,
+	}
+
+	if err = cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := ParseKey(Key{Pub: cert, Comment: "cert"}.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := k.Certificate(); !ok || k.Type() != gossh.CertAlgoED25519v01 {
+		t.Fatalf("not parsed as certificate: %s", k.Type())
+	}
+
+	got, err := k.Ed25519()
+	if err != nil || got != pub {
+		t.Fatalf("wrong key of certificate: %v", err)
+	}
+}
+
+// TestSSHKeygenCertificate checks a certificate made by
+//
+//	ssh-keygen -s ca -I tillitis-sigsum-test -n tillitis-sigsum-test \
+//	  -V 20250101000000Z:20350101000000Z key.pub
+//
+// and the signature made with it by "ssh-keygen -Y sign -f
+// key-cert.pub -n file msg", all in testdata.
+func TestSSHKeygenCertificate(t *testing.T) {
+	read := func(t *testing.T, name string) []byte {
+		t.Helper()
+
+		b, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return b
+	}
+
+	cas, err := ParseAuthorizedKeys(read(t, "ca.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParseKey(string(read(t, "key.pub")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := ParseKey(string(read(t, "key-cert.pub")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cert.CheckCertificate(cas, "tillitis-sigsum-test"); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := cert.Validity()
+	if !from.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("wrong validity %v - %v", from, to)
+	}
+
+	_, other := testKey(t, 1)
+
+	if err = cert.CheckCertificate([]Key{NewKey(other, "")}, "tillitis-sigsum-test"); err == nil {
+		t.Fatal("expected error for unknown authority")
+	}
+
+	if err = cert.CheckCertificate(cas, "tillitis-sigsum1"); err == nil {
+		t.Fatal("expected error for other principal")
+	}
+
+	if err = key.CheckCertificate(cas, "tillitis-sigsum-test"); err == nil {
+		t.Fatal("expected error for plain key")
+	}
+
+	// A certificate with its signature broken
+	c, _ := cert.Certificate()
+	forged := *c
+	forged.Signature = &gossh.Signature{Format: c.Signature.Format, Blob: make([]byte, len(c.Signature.Blob))}
+
+	if err = (Key{Pub: &forged}).CheckCertificate(cas, "tillitis-sigsum-test"); err == nil {
+		t.Fatal("expected error for forged certificate")
+	}
+
+	// The signature has the certificate as signer, which is the
+	// same as the key
+	msg, sig := read(t, "msg"), read(t, "msg.sig")
+
+	for _, k := range []Key{key, cert} {
+		if _, err = Verify(k, "file", msg, sig); err != nil {
+			t.Fatalf("%s: %v", k.Type(), err)
+		}
+	}
+
+	if _, err = Verify(NewKey(other, ""), "file", msg, sig); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("expected %v, got %v", ErrSignatureInvalid, err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	priv, pub := testKey(t, 1)
+	_, other := testKey(t, 2)
+
+	signer, err := NewSigner(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("TKey is genuine!\n")
+
+	armored, err := Sign(signer, "file", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Verify(NewKey(pub, ""), "file", msg, armored); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		key       PublicKey
+		namespace string
+		msg       []byte
+	}{
+		{"other key", other, "file", msg},
+		{"other namespace", pub, "email", msg},
+		{"other message", pub, "file", []byte("TKey is not genuine!\n")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Verify(NewKey(test.key, ""), test.namespace, test.msg, armored); !errors.Is(err, ErrSignatureInvalid) {
+				t.Fatalf("expected %v, got %v", ErrSignatureInvalid, err)
+			}
+		})
+	}
+}
+
+// TestSSHKeygen checks that ssh-keygen -Y verifies our signatures
+// and that we verify the signatures of ssh-keygen -Y.
+func TestSSHKeygen(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("no ssh-keygen")
+	}
+
+	dir := t.TempDir()
+	keyFn := filepath.Join(dir, "key")
+	msgFn := filepath.Join(dir, "msg")
+	msg := []byte("TKey is genuine!\n")
+
+	run := func(t *testing.T, args ...string) {
+		t.Helper()
+
+		// #nosec G204
+		if out, err := exec.Command("ssh-keygen", args...).CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	run(t, "-q", "-t", "ed25519", "-N", "", "-C", "test", "-f", keyFn)
+
+	keys, err := ReadAuthorizedKeys(keyFn + ".pub")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("couldn't read key: %v", err)
+	}
+
+	if err = os.WriteFile(msgFn, msg, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Theirs
+	run(t, "-Y", "sign", "-f", keyFn, "-n", "file", msgFn)
+
+	armored, err := os.ReadFile(msgFn + ".sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Verify(keys[0], "file", msg, armored); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ours
+	priv, pub := testKey(t, 1)
+
+	signer, err := NewSigner(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if armored, err = Sign(signer, "file", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := filepath.Join(dir, "allowed_signers")
+	if err = os.WriteFile(allowed, []byte("tkey "+NewKey(pub, "").String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(msgFn+".sig", armored, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", allowed, "-I", "tkey", "-n", "file", "-s", msgFn+".sig")
+	cmd.Stdin = bytes.NewReader(msg)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen -Y verify: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package ssh
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// SSH signatures, as made by "ssh-keygen -Y sign" and checked by
+// "ssh-keygen -Y verify", see PROTOCOL.sshsig in OpenSSH.
+
+const (
+	sigMagic    = "SSHSIG"
+	sigVersion  = 1
+	sigPEMType  = "SSH SIGNATURE"
+	sigHashAlgo = "sha512"
+)
+
+// ErrSignatureInvalid means an SSH signature didn't verify.
+var ErrSignatureInvalid = errors.New("invalid SSH signature")
+
+// Signature is an SSH signature of a message.
+type Signature struct {
+	Key       Key    // Public key of the signer
+	Namespace string // Domain of the signature, like "file"
+	HashAlgo  string // "sha256" or "sha512"
+	Sig       *gossh.Signature
+}
+
+// The wire formats.
+type (
+	sigBlob struct {
+		Magic     [6]byte
+		Version   uint32
+		PublicKey []byte
+		Namespace string
+		Reserved  string
+		HashAlgo  string
+		Signature []byte
+	}
+
+	signedData struct {
+		Magic     [6]byte
+		Namespace string
+		Reserved  string
+		HashAlgo  string
+		Digest    []byte
+	}
+)
+
+// NewSigner returns an SSH signer for signer, for instance an
+// ed25519.PrivateKey or a TKey signer.
+func NewSigner(signer crypto.Signer) (gossh.Signer, error) {
+	s, err := gossh.NewSignerFromSigner(signer)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return s, nil
+}
+
+// Sign signs message with signer in namespace and returns the
+// signature armored as by "ssh-keygen -Y sign".
+func Sign(signer gossh.Signer, namespace string, message []byte) ([]byte, error) {
+	if namespace == "" {
+		return nil, errors.New("empty namespace")
+	}
+
+	data, err := signedMessage(namespace, sigHashAlgo, message)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig *gossh.Signature
+
+	// ssh-keygen doesn't accept SHA-1 RSA signatures.
+	if as, ok := signer.(gossh.AlgorithmSigner); ok && signer.PublicKey().Type() == gossh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand.Reader, data, gossh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't sign: %w", err)
+	}
+
+	blob := sigBlob{
+		Version:   sigVersion,
+		PublicKey: signer.PublicKey().Marshal(),
+		Namespace: namespace,
+		HashAlgo:  sigHashAlgo,
+		Signature: gossh.Marshal(sig),
+	}
+	copy(blob.Magic[:], sigMagic)
+
+	return armor(gossh.Marshal(blob)), nil
+}
+
+// ParseSignature parses an armored SSH signature.
+func ParseSignature(armored []byte) (Signature, error) {
+	var s Signature
+
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != sigPEMType {
+		return s, errors.New("no SSH signature found")
+	}
+
+	var blob sigBlob
+	if err := gossh.Unmarshal(block.Bytes, &blob); err != nil {
+		return s, fmt.Errorf("couldn't parse SSH signature: %w", err)
+	}
+
+	if string(blob.Magic[:]) != sigMagic {
+		return s, errors.New("not an SSH signature")
+	}
+
+	if blob.Version != sigVersion {
+		return s, fmt.Errorf("unsupported SSH signature version %d", blob.Version)
+	}
+
+	pub, err := gossh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return s, fmt.Errorf("%w", err)
+	}
+
+	var sig gossh.Signature
+	if err = gossh.Unmarshal(blob.Signature, &sig); err != nil {
+		return s, fmt.Errorf("couldn't parse signature: %w", err)
+	}
+
+	s.Key = Key{Pub: pub}
+	s.Namespace = blob.Namespace
+	s.HashAlgo = blob.HashAlgo
+	s.Sig = &sig
+
+	return s, nil
+}
+
+// Verify checks that the armored SSH signature is a signature of
+// message in namespace by key. If key or the signer in the signature
+// is a certificate, it is the key of it that must match. Any
+// certificate is up to the caller to check, see CheckCertificate. It
+// returns the signature.
+func Verify(key Key, namespace string, message []byte, armored []byte) (Signature, error) {
+	s, err := ParseSignature(armored)
+	if err != nil {
+		return s, err
+	}
+
+	if s.Namespace != namespace {
+		return s, fmt.Errorf("%w: namespace is %q, expected %q", ErrSignatureInvalid, s.Namespace, namespace)
+	}
+
+	signer := plain(s.Key.Pub)
+
+	if !bytes.Equal(signer.Marshal(), plain(key.Pub).Marshal()) {
+		return s, fmt.Errorf("%w: signed by %s, not %s", ErrSignatureInvalid, gossh.FingerprintSHA256(signer), gossh.FingerprintSHA256(plain(key.Pub)))
+	}
+
+	data, err := signedMessage(s.Namespace, s.HashAlgo, message)
+	if err != nil {
+		return s, err
+	}
+
+	if err = signer.Verify(data, s.Sig); err != nil {
+		return s, fmt.Errorf("%w: %w", ErrSignatureInvalid, err)
+	}
+
+	return s, nil
+}
+
+// signedMessage returns what is actually signed for message.
+func signedMessage(namespace string, hashAlgo string, message []byte) ([]byte, error) {
+	var h hash.Hash
+
+	switch hashAlgo {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %q", hashAlgo)
+	}
+
+	h.Write(message)
+
+	data := signedData{
+		Namespace: namespace,
+		HashAlgo:  hashAlgo,
+		Digest:    h.Sum(nil),
+	}
+	copy(data.Magic[:], sigMagic)
+
+	return gossh.Marshal(data), nil
+}
+
+// armor encodes blob as ssh-keygen does, with lines of 70
+// characters.
+func armor(blob []byte) []byte {
+	var buf bytes.Buffer
+
+	enc := base64.StdEncoding.EncodeToString(blob)
+
+	buf.WriteString("-----BEGIN " + sigPEMType + "-----\n")
+
+	for len(enc) > 70 {
+		buf.WriteString(enc[:70] + "\n")
+		enc = enc[70:]
+	}
+
+	buf.WriteString(enc + "\n")
+	buf.WriteString("-----END " + sigPEMType + "-----\n")
+
+	return buf.Bytes()
+}
@@ -14,22 +14,33 @@ import (
 	"strings"
 	"time"
 
+	"github.com/tillitis/tkey-verification/internal/tkey"
 	"github.com/tillitis/tkey-verification/internal/util"
 	"sigsum.org/sigsum-go/pkg/requests"
 )
 
 type submissionJSON struct {
+	UDI       string `json:"udi,omitempty"`
 	Timestamp string `json:"timestamp"`
 	AppTag    string `json:"apptag"`
 	AppHash   string `json:"apphash"`
 	Request   string `json:"request"`
+
+	Station     string `json:"station,omitempty"`
+	StationCert string `json:"station_cert,omitempty"`
 }
 
 type Submission struct {
+	UDI       []byte // Big Endian. Missing in older submissions.
 	Timestamp time.Time
 	AppTag    string
 	AppHash   [sha512.Size]byte
 	Request   requests.Leaf
+
+	// The provisioning station that asked for the signature, from
+	// its TLS client certificate. Missing in older submissions.
+	Station     string // Common name
+	StationCert string // SHA-256 of the certificate, in hex
 }
 
 func (s *Submission) FromJSON(b []byte) error {
@@ -41,6 +52,18 @@ func (s *Submission) FromJSON(b []byte) error {
 
 	var err error
 
+	s.UDI = nil
+	if sJ.UDI != "" {
+		s.UDI, err = hex.DecodeString(sJ.UDI)
+		if err != nil {
+			return errors.New("couldn't decode UDI")
+		}
+
+		if l := len(s.UDI); l != tkey.UDISize {
+			return errors.New("wrong length of UDI")
+		}
+	}
+
 	s.Timestamp, err = time.Parse(time.RFC3339, sJ.Timestamp)
 	if err != nil {
 		return fmt.Errorf("%w", err)
@@ -50,6 +73,8 @@ func (s *Submission) FromJSON(b []byte) error {
 		return errors.New("app-tag empty")
 	}
 	s.AppTag = sJ.AppTag
+	s.Station = sJ.Station
+	s.StationCert = sJ.StationCert
 
 	if err = util.DecodeHex(s.AppHash[:], sJ.AppHash); err != nil {
 		return errors.New("couldn't decode app digest")
@@ -71,9 +96,12 @@ func (s *Submission) FromJSON(b []byte) error {
 func (s *Submission) ToJSON() ([]byte, error) {
 	var sJ submissionJSON
 
+	sJ.UDI = hex.EncodeToString(s.UDI)
 	sJ.Timestamp = s.Timestamp.UTC().Format(time.RFC3339)
 	sJ.AppTag = s.AppTag
 	sJ.AppHash = hex.EncodeToString(s.AppHash[:])
+	sJ.Station = s.Station
+	sJ.StationCert = s.StationCert
 
 	reqTextBuilder := strings.Builder{}
 	err := s.Request.ToASCII(&reqTextBuilder)
@@ -96,6 +96,33 @@ func TestJSONEncodeSubmission(t *testing.T) {
 	}
 }
 
+func TestSubmissionUDI(t *testing.T) {
+	var s Submission
+
+	withUDI := strings.Replace(submJSON, "{", `{"udi":"0001020304050607",`, 1)
+	if err := s.FromJSON([]byte(withUDI)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(s.UDI, []byte{0, 1, 2, 3, 4, 5, 6, 7}) {
+		t.Fatalf("Incorrect UDI. Got: %x", s.UDI)
+	}
+
+	js, err := s.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(js, []byte(`{"udi":"0001020304050607",`)) {
+		t.Fatalf("Incorrect JSON. Got: %s", js)
+	}
+
+	withUDI = strings.Replace(submJSON, "{", `{"udi":"0001",`, 1)
+	if err := s.FromJSON([]byte(withUDI)); err == nil || err.Error() != "wrong length of UDI" {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
 func mustDecodeHexString(s string) []byte {
 	b, err := hex.DecodeString(s)
 	if err != nil {
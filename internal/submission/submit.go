@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package submission
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/tillitis/tkey-verification/internal/firmware"
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+	"github.com/tillitis/tkey-verification/internal/verification"
+	"sigsum.org/sigsum-go/pkg/proof"
+	"sigsum.org/sigsum-go/pkg/requests"
+	"sigsum.org/sigsum-go/pkg/submit"
+)
+
+// Submitter submits the Sigsum requests in submission files to the
+// log and writes a verification file with the proof for each.
+type Submitter struct {
+	SubmDir     string // Submissions to log
+	DoneSubmDir string // Where logged submissions are moved
+	VerDir      string // Where verification files are written
+	Log         sigsum.Log
+
+	// Firmwares to describe the TKeys with in verification files.
+	// If nil, the embedded firmware database is used.
+	Firmwares *firmware.Firmwares
+
+	// HTTPClient specifies the HTTP client to use when making requests to the
+	// log.  If nil, a default client is created.
+	HTTPClient *http.Client
+}
+
+// ProcessSubmissions submits all submission files, after checking
+// that they all parse. The verification and processed submission
+// directories must be empty.
+func (s Submitter) ProcessSubmissions() error {
+	verFileCount, err := os.ReadDir(s.VerDir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory '%s': %w", s.VerDir, err)
+	}
+	if len(verFileCount) != 0 {
+		return errors.New("verification directory must be empty")
+	}
+
+	doneSubmFileCount, err := os.ReadDir(s.DoneSubmDir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory '%s': %w", s.DoneSubmDir, err)
+	}
+	if len(doneSubmFileCount) != 0 {
+		return errors.New("processed submission directory must be empty")
+	}
+
+	entries, err := os.ReadDir(s.SubmDir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory '%s': %w", s.SubmDir, err)
+	}
+
+	for _, entry := range entries {
+		var submission Submission
+		err = submission.FromFile(path.Join(s.SubmDir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("invalid submission file: %w", err)
+		}
+
+		if err = CheckName(entry.Name(), submission); err != nil {
+			return fmt.Errorf("invalid submission file: %w", err)
+		}
+	}
+
+	for _, entry := range entries {
+		err = s.ProcessSubmissionFile(entry.Name())
+		if err != nil {
+			return fmt.Errorf("failed to process submission file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ProcessSubmissionFile submits the submission in file fn in the
+// submission directory, writes its verification file and moves the
+// submission to the processed submission directory.
+func (s Submitter) ProcessSubmissionFile(fn string) error {
+	submissionPath := path.Join(s.SubmDir, fn)
+	doneSubmissionPath := path.Join(s.DoneSubmDir, fn)
+	verificationPath := path.Join(s.VerDir, fn)
+
+	var submission Submission
+	err := submission.FromFile(submissionPath)
+	if err != nil {
+		return fmt.Errorf("failed to open submission file: %w", err)
+	}
+
+	// The verification file is named after the submission file,
+	// so they must agree on the UDI.
+	if err = CheckName(fn, submission); err != nil {
+		return err
+	}
+
+	submitConfig := submit.Config{
+		Policy:     s.Log.Policy,
+		HTTPClient: s.HTTPClient,
+	}
+
+	proof, err := logDevice(submission.Request, submitConfig)
+	if err != nil {
+		return fmt.Errorf("failed to log device: %w", err)
+	}
+
+	verification := verification.Verification{
+		Type:      verification.VerProof,
+		Timestamp: submission.Timestamp,
+		AppTag:    submission.AppTag,
+		AppHash:   submission.AppHash,
+		Proof:     proof,
+	}
+
+	// Older submissions don't have the UDI and get a version 1
+	// verification file.
+	if len(submission.UDI) != 0 {
+		firmwares := s.Firmwares
+		if firmwares == nil {
+			fws, err := firmware.NewFirmwares()
+			if err != nil {
+				return fmt.Errorf("%w", err)
+			}
+
+			firmwares = &fws
+		}
+
+		if err = verification.SetVersion2(submission.UDI, *firmwares); err != nil {
+			return fmt.Errorf("failed to create verification file: %w", err)
+		}
+	}
+
+	_, err = verification.VerifyProofDigest(submission.Request.Message, s.Log)
+	if err != nil {
+		return fmt.Errorf("got invalid proof: %w", err)
+	}
+
+	err = verification.ToFile(verificationPath)
+	if err != nil {
+		return fmt.Errorf("failed to store verification file: %w", err)
+	}
+
+	err = os.Rename(submissionPath, doneSubmissionPath)
+	if err != nil {
+		return fmt.Errorf("failed to move verification file: %w", err)
+	}
+
+	return nil
+}
+
+// CheckName returns an error if the submission in file fn is for
+// another UDI than the one fn is named after.
+func CheckName(fn string, subm Submission) error {
+	if len(subm.UDI) == 0 {
+		return nil
+	}
+
+	udi, err := hex.DecodeString(fn)
+	if err != nil || !bytes.Equal(udi, subm.UDI) {
+		return fmt.Errorf("submission for UDI %s is named %s", hex.EncodeToString(subm.UDI), fn)
+	}
+
+	return nil
+}
+
+func logDevice(req requests.Leaf, submitConfig submit.Config) (proof.SigsumProof, error) {
+	ctx := context.Background()
+	reqs := []requests.Leaf{req}
+
+	proofs, err := submit.SubmitLeafRequests(ctx, &submitConfig, reqs)
+	if err != nil {
+		return proof.SigsumProof{}, fmt.Errorf("failed to submit sigsum log request: %w", err)
+	}
+	if len(proofs) != 1 {
+		return proof.SigsumProof{}, fmt.Errorf("expected one proof from log, got %d", len(proofs))
+	}
+
+	return proofs[0], nil
+}
@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package tkey
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ChallengeContext is prefixed to every challenge the TKey signs, so
+// the signature can't be used as a signature over anything else.
+const ChallengeContext = "tkey-verification challenge v1\x00"
+
+// NonceSize is the size of the random part of a challenge.
+const NonceSize = 32
+
+// ChallengeRecord is one challenge/response with a TKey: the TKey
+// with PubKey signed a challenge made of ChallengeContext, Time and
+// Nonce.
+type ChallengeRecord struct {
+	Time      time.Time
+	Nonce     [NonceSize]byte
+	Signature []byte
+	PubKey    []byte
+}
+
+type challengeRecordJSON struct {
+	Time      string `json:"time"`
+	Nonce     string `json:"nonce"`
+	Signature string `json:"signature"`
+	PubKey    string `json:"pubkey"`
+}
+
+// Message returns the challenge the TKey signs:
+//
+//	ChallengeContext || Time as Unix nanoseconds, 8 bytes big endian || Nonce
+func (c ChallengeRecord) Message() []byte {
+	var msg bytes.Buffer
+
+	msg.WriteString(ChallengeContext)
+	_ = binary.Write(&msg, binary.BigEndian, c.Time.UnixNano())
+	msg.Write(c.Nonce[:])
+
+	return msg.Bytes()
+}
+
+// Verify returns ErrChallengeFailed if the signature doesn't verify.
+func (c ChallengeRecord) Verify() error {
+	if len(c.PubKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: public key has wrong length", ErrChallengeFailed)
+	}
+
+	if !ed25519.Verify(c.PubKey, c.Message(), c.Signature) {
+		return ErrChallengeFailed
+	}
+
+	return nil
+}
+
+func (c ChallengeRecord) MarshalJSON() ([]byte, error) {
+	cJ := challengeRecordJSON{
+		Time:      c.Time.UTC().Format(time.RFC3339Nano),
+		Nonce:     hex.EncodeToString(c.Nonce[:]),
+		Signature: hex.EncodeToString(c.Signature),
+		PubKey:    hex.EncodeToString(c.PubKey),
+	}
+
+	b, err := json.Marshal(cJ)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return b, nil
+}
+
+func (c *ChallengeRecord) UnmarshalJSON(b []byte) error {
+	var cJ challengeRecordJSON
+
+	if err := json.Unmarshal(b, &cJ); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	var err error
+
+	if c.Time, err = time.Parse(time.RFC3339Nano, cJ.Time); err != nil {
+		return fmt.Errorf("couldn't parse challenge time: %w", err)
+	}
+
+	nonce, err := hex.DecodeString(cJ.Nonce)
+	if err != nil || len(nonce) != NonceSize {
+		return errors.New("couldn't decode challenge nonce")
+	}
+	copy(c.Nonce[:], nonce)
+
+	if c.Signature, err = hex.DecodeString(cJ.Signature); err != nil {
+		return fmt.Errorf("couldn't decode challenge signature: %w", err)
+	}
+
+	if c.PubKey, err = hex.DecodeString(cJ.PubKey); err != nil {
+		return fmt.Errorf("couldn't decode challenge public key: %w", err)
+	}
+
+	return nil
+}
+
+// Transcript is a record of challenges a TKey has answered, to keep
+// as evidence of a verification.
+type Transcript []ChallengeRecord
+
+// Verify verifies all challenges in the transcript, and that they
+// were answered by the TKey with pubKey. An empty transcript doesn't
+// verify.
+func (t Transcript) Verify(pubKey []byte) error {
+	if len(t) == 0 {
+		return fmt.Errorf("%w: no challenges", ErrChallengeFailed)
+	}
+
+	for i, c := range t {
+		if !bytes.Equal(c.PubKey, pubKey) {
+			return fmt.Errorf("%w: challenge %d answered by another key", ErrChallengeFailed, i+1)
+		}
+
+		if err := c.Verify(); err != nil {
+			return fmt.Errorf("challenge %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// newChallenge returns a new challenge for the TKey with pubKey, made
+// at now.
+func newChallenge(pubKey []byte, now time.Time) (ChallengeRecord, error) {
+	c := ChallengeRecord{
+		Time:   now.UTC(),
+		PubKey: pubKey,
+	}
+
+	if _, err := rand.Read(c.Nonce[:]); err != nil {
+		return c, fmt.Errorf("rand.Read failed: %w", err)
+	}
+
+	return c, nil
+}
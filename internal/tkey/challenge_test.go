@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package tkey
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testTranscript(t *testing.T, n int) (Transcript, ed25519.PublicKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var transcript Transcript
+
+	for i := 0; i < n; i++ {
+		c, err := newChallenge(pub, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.Signature = ed25519.Sign(priv, c.Message())
+		transcript = append(transcript, c)
+	}
+
+	return transcript, pub
+}
+
+func TestChallengeMessage(t *testing.T) {
+	transcript, _ := testTranscript(t, 2)
+
+	msg := transcript[0].Message()
+	if !bytes.HasPrefix(msg, []byte(ChallengeContext)) {
+		t.Fatal("challenge without context")
+	}
+
+	if len(msg) != len(ChallengeContext)+8+NonceSize {
+		t.Fatalf("unexpected challenge length %d", len(msg))
+	}
+
+	if bytes.Equal(transcript[0].Nonce[:], transcript[1].Nonce[:]) {
+		t.Fatal("same nonce twice")
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	transcript, pub := testTranscript(t, 3)
+
+	if err := transcript.Verify(pub); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(transcript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed Transcript
+	if err = json.Unmarshal(b, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = parsed.Verify(pub); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another key
+	other, _ := testTranscript(t, 1)
+	if err = parsed.Verify(other[0].PubKey); !errors.Is(err, ErrChallengeFailed) {
+		t.Fatalf("expected ErrChallengeFailed, got %v", err)
+	}
+
+	// Another time than signed
+	parsed[1].Time = parsed[1].Time.Add(time.Second)
+	if err = parsed.Verify(pub); !errors.Is(err, ErrChallengeFailed) {
+		t.Fatalf("expected ErrChallengeFailed, got %v", err)
+	}
+
+	if err = (Transcript{}).Verify(pub); !errors.Is(err, ErrChallengeFailed) {
+		t.Fatalf("expected ErrChallengeFailed, got %v", err)
+	}
+}
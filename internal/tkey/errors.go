@@ -17,6 +17,10 @@ const (
 	ErrNotFirmware  = constError("not firmware")
 	ErrWrongUDILen  = constError("wrong UDI length")
 	ErrWrongUDIData = constError("reserved UDI bits not zero")
+
+	// The device app couldn't prove it has the private key. The
+	// TKey is not what it claims to be.
+	ErrChallengeFailed = constError("challenge/response failed")
 )
 
 // More complex errors get their own type below
@@ -33,3 +37,18 @@ func (e ConnError) Error() string {
 func (e ConnError) Unwrap() error {
 	return e.err
 }
+
+// CommError is a failure to talk to a connected TKey or its device
+// app. Trying again might help.
+type CommError struct {
+	op  string
+	err error
+}
+
+func (e CommError) Error() string {
+	return fmt.Sprintf("%v: %v", e.op, e.err)
+}
+
+func (e CommError) Unwrap() error {
+	return e.err
+}
@@ -20,13 +20,12 @@
 package tkey
 
 import (
-	"crypto/ed25519"
-	"crypto/rand"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/tillitis/tkeyclient"
 	"github.com/tillitis/tkeysign"
@@ -91,7 +90,7 @@ func NewTKey(devPath string, speed int, verbose bool) (*TKey, error) {
 
 	tkUDI, err := tkey.client.GetUDI()
 	if err != nil {
-		return nil, fmt.Errorf("%w", err)
+		return nil, CommError{op: "couldn't get UDI", err: err}
 	}
 
 	var udi UDI
@@ -122,7 +121,7 @@ func (t *TKey) LoadSigner(bin []byte) ([]byte, error) {
 
 	// No USS.
 	if err = t.client.LoadApp(bin, []byte{}); err != nil {
-		return nil, fmt.Errorf("%w", err)
+		return nil, CommError{op: "couldn't load app", err: err}
 	}
 	if t.verbose {
 		le.Printf("App loaded.\n")
@@ -132,7 +131,7 @@ func (t *TKey) LoadSigner(bin []byte) ([]byte, error) {
 
 	nameVer, err := t.signer.GetAppNameVersion()
 	if err != nil {
-		return nil, fmt.Errorf("%w", err)
+		return nil, CommError{op: "couldn't get app name", err: err}
 	}
 
 	if t.verbose {
@@ -142,7 +141,7 @@ func (t *TKey) LoadSigner(bin []byte) ([]byte, error) {
 
 	pubKey, err := t.signer.GetPubkey()
 	if err != nil {
-		return nil, fmt.Errorf("%w", err)
+		return nil, CommError{op: "couldn't get public key", err: err}
 	}
 
 	return pubKey, nil
@@ -153,7 +152,7 @@ func (t *TKey) LoadSigner(bin []byte) ([]byte, error) {
 func (t TKey) Sign(message []byte) ([]byte, error) {
 	signature, err := t.signer.Sign(message)
 	if err != nil {
-		return nil, fmt.Errorf("%w", err)
+		return nil, CommError{op: "couldn't sign", err: err}
 	}
 
 	return signature, nil
@@ -164,7 +163,7 @@ func (t TKey) Sign(message []byte) ([]byte, error) {
 func (t TKey) GetFirmwareHash(firmwareSize int) ([]byte, error) {
 	fwHash, err := t.signer.GetFWDigest(firmwareSize)
 	if err != nil {
-		return nil, fmt.Errorf("%w", err)
+		return nil, CommError{op: "couldn't get firmware digest", err: err}
 	}
 
 	return fwHash, nil
@@ -175,7 +174,7 @@ func (t TKey) GetFirmwareHash(firmwareSize int) ([]byte, error) {
 func (t TKey) GetPubkey() ([]byte, error) {
 	pubkey, err := t.signer.GetPubkey()
 	if err != nil {
-		return nil, fmt.Errorf("%w", err)
+		return nil, CommError{op: "couldn't get public key", err: err}
 	}
 
 	return pubkey, nil
@@ -193,24 +192,32 @@ func handleSignals(action func(), sig ...os.Signal) chan<- os.Signal {
 	return ch
 }
 
-// Challenge gets a device signature over a random challenge.
+// Challenge asks the device app with pubKey to sign n fresh
+// challenges, see ChallengeRecord. n less than 1 means 1.
 //
-// It returns true if verification was a success. False otherwise.
-func (t *TKey) Challenge(pubKey []byte) error {
-	challenge := make([]byte, 32)
-	if _, err := rand.Read(challenge); err != nil {
-		return fmt.Errorf("rand.Read failed: %w", err)
-	}
+// It returns the transcript of the challenges so far and
+// ErrChallengeFailed if any signature doesn't verify with pubKey, or
+// a CommError if the TKey couldn't be asked.
+func (t *TKey) Challenge(pubKey []byte, n int) (Transcript, error) {
+	var transcript Transcript
+
+	for i := 0; i < max(n, 1); i++ {
+		c, err := newChallenge(pubKey, time.Now())
+		if err != nil {
+			return transcript, err
+		}
 
-	signature, err := t.Sign(challenge)
-	if err != nil {
-		return fmt.Errorf("%w", err)
-	}
+		if c.Signature, err = t.Sign(c.Message()); err != nil {
+			return transcript, err
+		}
+
+		transcript = append(transcript, c)
 
-	// Verify device signature against device public key
-	if !ed25519.Verify(pubKey, challenge, signature) {
-		return fmt.Errorf("%w", err)
+		// Verify device signature against device public key
+		if err = c.Verify(); err != nil {
+			return transcript, fmt.Errorf("challenge %d: %w", i+1, err)
+		}
 	}
 
-	return nil
+	return transcript, nil
 }
@@ -45,3 +45,18 @@ func (u *UDI) fromRawLE(udiLE []byte) error {
 	u.Bytes[4], u.Bytes[5], u.Bytes[6], u.Bytes[7] = udiLE[7], udiLE[6], udiLE[5], udiLE[4]
 	return nil
 }
+
+// FromBE parses a Big Endian Unique Device Identifier, as used in
+// file names and verification files.
+func (u *UDI) FromBE(udiBE []byte) error {
+	if l := len(udiBE); l != UDISize {
+		return ErrWrongUDILen
+	}
+
+	udiLE := []byte{
+		udiBE[3], udiBE[2], udiBE[1], udiBE[0],
+		udiBE[7], udiBE[6], udiBE[5], udiBE[4],
+	}
+
+	return u.fromRawLE(udiLE)
+}
@@ -7,10 +7,13 @@ import (
 	"bytes"
 	"crypto/ed25519"
 	"crypto/sha512"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"runtime/debug"
+	"strings"
+	"time"
 
 	"github.com/tillitis/tkey-verification/internal/tkey"
 )
@@ -49,6 +52,13 @@ func BuildMessage(udiBE, fwHash, pubKey []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// TimestampMessage returns msg, as from BuildMessage, followed by t
+// as big endian Unix time in 8 bytes. A vendor signature over it
+// also covers the verification timestamp.
+func TimestampMessage(msg []byte, t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(bytes.Clone(msg), uint64(t.Unix())) // nolint:gosec
+}
+
 func Version(version string) string {
 	if version == "" {
 		if info, ok := debug.ReadBuildInfo(); ok {
@@ -62,3 +72,46 @@ func Version(version string) string {
 
 	return version
 }
+
+// SignList signs the text file body, prefixed by prefix to separate
+// it from anything else signed with the same key, with sign. It
+// returns body with a last line "signature <signature in hex>".
+func SignList(body string, prefix string, sign func(message []byte) ([]byte, error)) (string, error) {
+	sig, err := sign(append([]byte(prefix), body...))
+	if err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	return fmt.Sprintf("%ssignature %x\n", body, sig), nil
+}
+
+// VerifyList verifies the signature on the last line of s, made by
+// SignList with prefix, against any of the trusted public keys. It
+// returns the signed body. Errors start with what, like "revocation
+// list".
+func VerifyList(s string, prefix string, what string, trusted [][ed25519.PublicKeySize]byte) (string, error) {
+	trimmed := strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+
+	i := strings.LastIndex(trimmed, "\n")
+	body, last := trimmed[:i+1], trimmed[i+1:]
+
+	fields := strings.Fields(last)
+	if len(fields) != 2 || fields[0] != "signature" {
+		return "", fmt.Errorf("%s not signed", what)
+	}
+
+	sig := make([]byte, ed25519.SignatureSize)
+	if err := DecodeHex(sig, fields[1]); err != nil {
+		return "", fmt.Errorf("couldn't decode %s signature: %w", what, err)
+	}
+
+	msg := append([]byte(prefix), body...)
+
+	for _, key := range trusted {
+		if ed25519.Verify(key[:], msg, sig) {
+			return body, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s signature not verified", what)
+}
@@ -11,20 +11,74 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/tillitis/tkey-verification/internal/appbins"
 	"github.com/tillitis/tkey-verification/internal/data"
+	"github.com/tillitis/tkey-verification/internal/revocation"
 	"github.com/tillitis/tkey-verification/internal/util"
 )
 
 type PubKey struct {
-	PubKey [ed25519.PublicKeySize]byte // Vendor public key
-	Tag    string                      // Name and tag of the device app
-	AppBin appbins.AppBin              // The actual device app binary
+	PubKey       [ed25519.PublicKeySize]byte // Vendor public key
+	Tag          string                      // Name and tag of the device app
+	AppBin       appbins.AppBin              // The actual device app binary
+	Start        time.Time                   // Start of validity, zero if none
+	End          time.Time                   // End of validity, zero if none
+	Revoked      bool
+	RevokeReason string
 }
 
 func (p *PubKey) String() string {
-	return fmt.Sprintf("pubkey:%0x… %s", p.PubKey[:16], p.AppBin.String())
+	s := fmt.Sprintf("pubkey:%0x… %s", p.PubKey[:16], p.AppBin.String())
+
+	if p.HasWindow() {
+		s += fmt.Sprintf(" valid:%v - %v", formatTime(p.Start), formatTime(p.End))
+	}
+
+	if p.Revoked {
+		s += fmt.Sprintf(" REVOKED: %s", p.RevokeReason)
+	}
+
+	return s
+}
+
+// Entry formats p as a line in the vendor public keys, as read by
+// VendorKeys.FromString.
+func (p *PubKey) Entry() string {
+	s := fmt.Sprintf("%x %s %x", p.PubKey, p.Tag, p.AppBin.Hash())
+
+	if p.HasWindow() {
+		s += fmt.Sprintf(" %s %s", p.Start.Format(time.RFC3339), p.End.Format(time.RFC3339))
+	}
+
+	return s + "\n"
+}
+
+// HasWindow returns true if the key has a validity window.
+func (p *PubKey) HasWindow() bool {
+	return !p.Start.IsZero() || !p.End.IsZero()
+}
+
+// ValidAt returns true if t is within the key's validity window.
+func (p *PubKey) ValidAt(t time.Time) bool {
+	if !p.Start.IsZero() && t.Before(p.Start) {
+		return false
+	}
+
+	if !p.End.IsZero() && !t.Before(p.End) {
+		return false
+	}
+
+	return true
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "…"
+	}
+
+	return t.Format(time.RFC3339)
 }
 
 // VendorKeys is a built-in database of vendor PubKeys
@@ -46,6 +100,10 @@ func (v *VendorKeys) String() string {
 // needs to know the existing device applications (get them with
 // NewAppBins())
 //
+// Each line contains the public key in hex, the signer-app tag and
+// its hash in hex, optionally followed by the start and end of the
+// key's validity in RFC3339.
+//
 // It returns the vendor public keys and any error.
 func (v *VendorKeys) FromString(pubkeys string, appBins appbins.AppBins) error {
 	lines := strings.Split(strings.Trim(strings.ReplaceAll(pubkeys, "\r\n", "\n"), "\n"), "\n")
@@ -60,12 +118,32 @@ func (v *VendorKeys) FromString(pubkeys string, appBins appbins.AppBins) error {
 			continue
 		}
 
-		if len(fields) != 3 {
-			return errors.New("expected 3 space-separated fields: pubkey in hex, signer-app tag, and its hash in hex")
+		if len(fields) != 3 && len(fields) != 5 {
+			return errors.New("expected 3 or 5 space-separated fields: pubkey in hex, signer-app tag, and its hash in hex, optionally start and end of validity")
 		}
 
 		pubKeyHex, tag, appHashHex := fields[0], fields[1], fields[2]
 
+		var start, end time.Time
+
+		if len(fields) == 5 {
+			var err error
+
+			start, err = time.Parse(time.RFC3339, fields[3])
+			if err != nil {
+				return fmt.Errorf("couldn't parse key start time: %w", err)
+			}
+
+			end, err = time.Parse(time.RFC3339, fields[4])
+			if err != nil {
+				return fmt.Errorf("couldn't parse key end time: %w", err)
+			}
+
+			if !end.After(start) {
+				return errors.New("key end time not after start time")
+			}
+		}
+
 		pubKey, err := hex.DecodeString(pubKeyHex)
 		if err != nil {
 			return fmt.Errorf("couldn't decode public key: %w", err)
@@ -101,12 +179,28 @@ func (v *VendorKeys) FromString(pubkeys string, appBins appbins.AppBins) error {
 			PubKey: *(*[ed25519.PublicKeySize]byte)(pubKey),
 			Tag:    tag,
 			AppBin: appBin,
+			Start:  start,
+			End:    end,
 		}
 	}
 
 	return nil
 }
 
+// Revoke marks all keys in the revocation list as revoked.
+//
+// A vendor signature carries no trustworthy time, so a revoked vendor
+// key is distrusted completely, regardless of the time of compromise.
+func (v *VendorKeys) Revoke(list revocation.List) {
+	for hash, key := range v.Keys {
+		if r, ok := list.Revoked(key.PubKey); ok {
+			key.Revoked = true
+			key.RevokeReason = r.Reason
+			v.Keys[hash] = key
+		}
+	}
+}
+
 func (v *VendorKeys) FromEmbedded(appBins appbins.AppBins) error {
 	return v.FromString(string(data.VendorPubKeys), appBins)
 }
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package verification
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrWrongUDI means a verification file was for another TKey
+	// than the requested one, probably because it is misnamed.
+	ErrWrongUDI = errors.New("verification file for wrong TKey")
+
+	// ErrUnsupportedVersion means a verification file in a format
+	// version we don't know.
+	ErrUnsupportedVersion = errors.New("unsupported verification file version")
+
+	// ErrSignatureInvalid means no vendor key verified the vendor
+	// signature.
+	ErrSignatureInvalid = errors.New("vendor signature not verified")
+
+	// ErrProofInvalid means the Sigsum proof didn't verify.
+	ErrProofInvalid = errors.New("invalid Sigsum proof")
+
+	// ErrKeyRevoked means the signature or proof was made with a
+	// revoked key, or logged after the key was compromised.
+	ErrKeyRevoked = errors.New("revoked key")
+
+	// ErrKeyOutsideLifetime means the signature or cosignature
+	// was made outside of the lifetime of the key.
+	ErrKeyOutsideLifetime = errors.New("outside of key lifetime")
+)
+
+// ParseError is a verification file that couldn't be parsed.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// kindError is an error with its own message that also is one of the
+// sentinel errors above.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// errorf formats an error that errors.Is kind.
+func errorf(kind error, format string, a ...any) error {
+	return kindError{kind: kind, err: fmt.Errorf(format, a...)}
+}
@@ -11,14 +11,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"math"
-	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/tillitis/tkey-verification/internal/fetch"
+	"github.com/tillitis/tkey-verification/internal/firmware"
 	"github.com/tillitis/tkey-verification/internal/sigsum"
+	"github.com/tillitis/tkey-verification/internal/tkey"
 	"github.com/tillitis/tkey-verification/internal/util"
 	"github.com/tillitis/tkey-verification/internal/vendorkey"
 	sumcrypto "sigsum.org/sigsum-go/pkg/crypto"
@@ -32,6 +33,12 @@ const (
 	VerProof
 )
 
+// Version is the verification file format version written for new
+// verification files with version information.
+const Version = 2
+
+// verificationJSON is the original, version 1, format. It has no
+// version field.
 type verificationJSON struct {
 	Timestamp string `json:"timestamp"`
 	AppTag    string `json:"apptag"`
@@ -40,54 +47,178 @@ type verificationJSON struct {
 	Proof     string `json:"proof"`
 }
 
+type verificationJSONv2 struct {
+	Version       int      `json:"version"`
+	UDI           string   `json:"udi"`
+	ProductID     uint8    `json:"productid"`
+	FirmwareSize  int      `json:"firmware_size"`
+	FirmwareLabel string   `json:"firmware_label"`
+	Timestamp     string   `json:"timestamp"`
+	AppTag        string   `json:"apptag"`
+	AppHash       string   `json:"apphash"`
+	Signature     string   `json:"signature,omitempty"`
+	Proof         string   `json:"proof,omitempty"`
+	Proofs        []string `json:"proofs,omitempty"`
+
+	SignedTimestamp bool `json:"signed_timestamp,omitempty"`
+}
+
 type Verification struct {
+	Version   int // File format version, 1 or 2
 	Type      Type
 	Timestamp time.Time
 	AppTag    string
 	AppHash   [sha512.Size]byte
 	Signature []byte
 	Proof     proof.SigsumProof
+
+	// Only in version 2 and later.
+	UDI           []byte // Big Endian
+	ProductID     uint8
+	FirmwareSize  int                 // Checked against the firmware database
+	FirmwareLabel string              // Informational, labels can change with the firmware database
+	Proofs        []proof.SigsumProof // Additional proofs, for instance from other logs
+
+	// The vendor signature also covers Timestamp, see
+	// util.TimestampMessage.
+	SignedTimestamp bool
 }
 
+// FromJSON parses a verification file of any version. Any error is a
+// *ParseError.
 func (v *Verification) FromJSON(b []byte) error {
+	if err := v.fromJSON(b); err != nil {
+		return &ParseError{Err: err}
+	}
+
+	return nil
+}
+
+func (v *Verification) fromJSON(b []byte) error {
+	var version struct {
+		Version int `json:"version"`
+	}
+
+	if err := json.Unmarshal(b, &version); err != nil {
+		return fmt.Errorf("couldn't unmarshal JSON: %w", err)
+	}
+
+	switch version.Version {
+	case 0, 1:
+		// Version 1 files have no version field, but take one
+		return v.fromJSONv1(b)
+	case 2:
+		return v.fromJSONv2(b)
+	}
+
+	return errorf(ErrUnsupportedVersion, "unsupported verification file version %d", version.Version)
+}
+
+func (v *Verification) fromJSONv1(b []byte) error {
 	var vJ verificationJSON
 
 	if err := json.Unmarshal(b, &vJ); err != nil {
 		return fmt.Errorf("couldn't unmarshal JSON: %w", err)
 	}
 
+	*v = Verification{Version: 1}
+
+	return v.parse(vJ.Timestamp, vJ.AppTag, vJ.AppHash, vJ.Signature, vJ.Proof)
+}
+
+func (v *Verification) fromJSONv2(b []byte) error {
+	var vJ verificationJSONv2
+
+	if err := json.Unmarshal(b, &vJ); err != nil {
+		return fmt.Errorf("couldn't unmarshal JSON: %w", err)
+	}
+
+	*v = Verification{Version: 2}
+
+	if err := v.parse(vJ.Timestamp, vJ.AppTag, vJ.AppHash, vJ.Signature, vJ.Proof); err != nil {
+		return err
+	}
+
+	var udi tkey.UDI
+
+	udiBE, err := hex.DecodeString(vJ.UDI)
+	if err != nil {
+		return errors.New("couldn't decode UDI")
+	}
+
+	if err = udi.FromBE(udiBE); err != nil {
+		return fmt.Errorf("invalid UDI: %w", err)
+	}
+
+	if vJ.ProductID != udi.ProductID {
+		return fmt.Errorf("product ID %d doesn't match UDI product ID %d", vJ.ProductID, udi.ProductID)
+	}
+
+	v.UDI = udiBE
+	v.ProductID = vJ.ProductID
+	v.FirmwareSize = vJ.FirmwareSize
+	v.FirmwareLabel = vJ.FirmwareLabel
+
+	if vJ.SignedTimestamp && v.Type != VerSig {
+		return errors.New("signed timestamp without a vendor signature")
+	}
+	v.SignedTimestamp = vJ.SignedTimestamp
+
+	if len(vJ.Proofs) != 0 && v.Type != VerProof {
+		return errors.New("additional Sigsum proofs without a Sigsum proof")
+	}
+
+	for i, p := range vJ.Proofs {
+		var extra proof.SigsumProof
+
+		if err = extra.FromASCII(bytes.NewBufferString(p)); err != nil {
+			return fmt.Errorf("couldn't parse additional proof %d: %w", i, err)
+		}
+
+		if extra.Leaf != v.Proof.Leaf {
+			return fmt.Errorf("additional proof %d is for another leaf", i)
+		}
+
+		v.Proofs = append(v.Proofs, extra)
+	}
+
+	return nil
+}
+
+// parse parses the fields common to all versions.
+func (v *Verification) parse(timestamp string, appTag string, appHash string, signature string, proofASCII string) error {
 	var err error
 
-	v.Timestamp, err = time.Parse(time.RFC3339, vJ.Timestamp)
+	v.Timestamp, err = time.Parse(time.RFC3339, timestamp)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	if vJ.AppTag == "" {
+	if appTag == "" {
 		return errors.New("app-tag empty")
 	}
-	v.AppTag = vJ.AppTag
+	v.AppTag = appTag
 
-	if err = util.DecodeHex(v.AppHash[:], vJ.AppHash); err != nil {
+	if err = util.DecodeHex(v.AppHash[:], appHash); err != nil {
 		return errors.New("couldn't decode app digest")
 	}
 
-	if vJ.Proof != "" && vJ.Signature != "" {
+	if proofASCII != "" && signature != "" {
 		return errors.New("verification file contains both Sigsum proof and vendor signature")
 	}
 
-	if vJ.Proof != "" {
+	if proofASCII != "" {
 		// This contains a Sigsum proof
 		v.Type = VerProof
 
-		if err = v.Proof.FromASCII(bytes.NewBufferString(vJ.Proof)); err != nil {
+		if err = v.Proof.FromASCII(bytes.NewBufferString(proofASCII)); err != nil {
 			return fmt.Errorf("couldn't parse proof: %w", err)
 		}
 	} else {
 		// Old type vendor signature
 		v.Type = VerSig
 
-		v.Signature, err = hex.DecodeString(vJ.Signature)
+		v.Signature, err = hex.DecodeString(signature)
 		if err != nil {
 			return errors.New("couldn't decode vendor signature")
 		}
@@ -96,7 +227,13 @@ func (v *Verification) FromJSON(b []byte) error {
 	return nil
 }
 
+// ToJSON returns the verification in the format of v.Version.
+// Version 1 can only hold a Sigsum proof.
 func (v *Verification) ToJSON() ([]byte, error) {
+	if v.Version == 2 {
+		return v.toJSONv2()
+	}
+
 	var vJ verificationJSON
 
 	vJ.Timestamp = v.Timestamp.UTC().Format(time.RFC3339)
@@ -108,12 +245,12 @@ func (v *Verification) ToJSON() ([]byte, error) {
 	}
 
 	if v.Type == VerProof {
-		proofTextBuilder := strings.Builder{}
-		err := v.Proof.ToASCII(&proofTextBuilder)
+		var err error
+
+		vJ.Proof, err = proofToASCII(v.Proof)
 		if err != nil {
-			return nil, fmt.Errorf("couldn't convert proof to ASCII: %w", err)
+			return nil, err
 		}
-		vJ.Proof = proofTextBuilder.String()
 	} else {
 		return nil, errors.New("unknown verification type")
 	}
@@ -126,13 +263,90 @@ func (v *Verification) ToJSON() ([]byte, error) {
 	return json, nil
 }
 
-func (v *Verification) FromFile(fn string) error {
+func (v *Verification) toJSONv2() ([]byte, error) {
+	if l := len(v.UDI); l != tkey.UDISize {
+		return nil, errors.New("wrong length of UDI")
+	}
+
+	vJ := verificationJSONv2{
+		Version:       2,
+		UDI:           hex.EncodeToString(v.UDI),
+		ProductID:     v.ProductID,
+		FirmwareSize:  v.FirmwareSize,
+		FirmwareLabel: v.FirmwareLabel,
+		Timestamp:     v.Timestamp.UTC().Format(time.RFC3339),
+		AppTag:        v.AppTag,
+		AppHash:       hex.EncodeToString(v.AppHash[:]),
+
+		SignedTimestamp: v.SignedTimestamp,
+	}
+
+	var err error
+
+	switch v.Type {
+	case VerSig:
+		if len(v.Proofs) != 0 {
+			return nil, errors.New("additional Sigsum proofs without a Sigsum proof")
+		}
+
+		vJ.Signature = hex.EncodeToString(v.Signature)
+	case VerProof:
+		if len(v.Signature) != 0 {
+			return nil, errors.New("both Sigsum proof and vendor signature")
+		}
+
+		if v.SignedTimestamp {
+			return nil, errors.New("signed timestamp without a vendor signature")
+		}
+
+		vJ.Proof, err = proofToASCII(v.Proof)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range v.Proofs {
+			extra, err := proofToASCII(p)
+			if err != nil {
+				return nil, err
+			}
+
+			vJ.Proofs = append(vJ.Proofs, extra)
+		}
+	default:
+		return nil, errors.New("unknown verification type")
+	}
+
+	json, err := json.Marshal(vJ)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal JSON: %w", err)
+	}
+
+	return json, nil
+}
+
+func proofToASCII(p proof.SigsumProof) (string, error) {
+	proofTextBuilder := strings.Builder{}
+
+	if err := p.ToASCII(&proofTextBuilder); err != nil {
+		return "", fmt.Errorf("couldn't convert proof to ASCII: %w", err)
+	}
+
+	return proofTextBuilder.String(), nil
+}
+
+// FromFile reads the verification file fn, which must be for the
+// TKey with udiBE.
+func (v *Verification) FromFile(fn string, udiBE []byte) error {
 	verificationJSON, err := os.ReadFile(fn)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	return v.FromJSON(verificationJSON)
+	if err = v.FromJSON(verificationJSON); err != nil {
+		return err
+	}
+
+	return v.CheckUDI(udiBE)
 }
 
 func (v *Verification) ToFile(fn string) error {
@@ -149,24 +363,55 @@ func (v *Verification) ToFile(fn string) error {
 	return nil
 }
 
-func (v *Verification) FromURL(verifyURL string) error {
-	client := http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(verifyURL) // #nosec G107
+// FromURL fetches the verification file from verifyURL using f. The
+// file must be for the TKey with udiBE. Any fetch error is a
+// *fetch.Error.
+func (v *Verification) FromURL(f *fetch.Fetcher, verifyURL string, udiBE []byte) error {
+	verificationJSON, err := f.Get(verifyURL)
 	if err != nil {
-		return fmt.Errorf("error accessing %v: %v", verifyURL, resp.Status)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error accessing %v: %v", verifyURL, resp.Status)
+	if err = v.FromJSON(verificationJSON); err != nil {
+		return err
 	}
 
-	verificationJSON, err := io.ReadAll(resp.Body)
+	return v.CheckUDI(udiBE)
+}
+
+// CheckUDI returns an error if the verification states that it is
+// for another TKey than the one with udiBE. Version 1 files don't
+// state a UDI and always pass.
+func (v *Verification) CheckUDI(udiBE []byte) error {
+	if v.Version < 2 || bytes.Equal(v.UDI, udiBE) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: file is for UDI %s, not %s", ErrWrongUDI,
+		hex.EncodeToString(v.UDI), hex.EncodeToString(udiBE))
+}
+
+// SetVersion2 makes v a version 2 verification for the TKey with
+// udiBE. The firmware size and label are taken from firmwares.
+// Nothing that is verified changes.
+func (v *Verification) SetVersion2(udiBE []byte, firmwares firmware.Firmwares) error {
+	var udi tkey.UDI
+	if err := udi.FromBE(udiBE); err != nil {
+		return fmt.Errorf("invalid UDI: %w", err)
+	}
+
+	fw, err := firmwares.GetFirmware(udi)
 	if err != nil {
-		return fmt.Errorf("couldn't ready body: %w", err)
+		return err
 	}
 
-	return v.FromJSON(verificationJSON)
+	v.Version = 2
+	v.UDI = udiBE
+	v.ProductID = udi.ProductID
+	v.FirmwareSize = fw.Size
+	v.FirmwareLabel = fw.Label
+
+	return nil
 }
 
 func (v *Verification) IsProof() bool {
@@ -180,62 +425,137 @@ func (v *Verification) IsSig() bool {
 // VerifySig verifies a signature (Signature in the struct) over
 // message 'msg' against a number of public keys in 'vendorKeys'.
 //
+// If the verification has a signed timestamp the signature is over
+// msg followed by the timestamp, see util.TimestampMessage.
+//
+// The key that made the signature must not be revoked. If the key
+// has a validity window, the timestamp must be signed and within the
+// window. An unsigned timestamp could be moved into any window, so
+// older signatures without one are only accepted by keys without a
+// window.
+//
 // It returns the matching public key that successfully verified the
 // signature, if any, and any error.
 func (v *Verification) VerifySig(msg []byte, vendorKeys vendorkey.VendorKeys) (vendorkey.PubKey, error) {
+	if v.SignedTimestamp {
+		msg = util.TimestampMessage(msg, v.Timestamp)
+	}
+
 	// We allow for any of the known vendor keys and return on the
 	// first which verifies.
 	for _, vendorPubKey := range vendorKeys.Keys {
-		if ed25519.Verify(vendorPubKey.PubKey[:], msg, v.Signature) {
+		if !ed25519.Verify(vendorPubKey.PubKey[:], msg, v.Signature) {
+			continue
+		}
+
+		if vendorPubKey.Revoked {
+			return vendorPubKey, errorf(ErrKeyRevoked, "signed by revoked key: %s", vendorPubKey.RevokeReason)
+		}
+
+		if !vendorPubKey.HasWindow() {
 			return vendorPubKey, nil
 		}
+
+		if !v.SignedTimestamp {
+			return vendorPubKey, errorf(ErrKeyOutsideLifetime, "vendor key has a validity window, but its signature doesn't cover the timestamp")
+		}
+
+		if !vendorPubKey.ValidAt(v.Timestamp) {
+			return vendorPubKey, errorf(ErrKeyOutsideLifetime, "vendor signature outside of key lifetime, %v not in %v - %v",
+				v.Timestamp.Format(time.RFC3339),
+				vendorPubKey.Start.Format(time.RFC3339),
+				vendorPubKey.End.Format(time.RFC3339))
+		}
+
+		return vendorPubKey, nil
 	}
 
-	return vendorkey.PubKey{}, errors.New("vendor signature not verified")
+	return vendorkey.PubKey{}, ErrSignatureInvalid
 }
 
+// VerifyProofDigest verifies the Sigsum proof over digest. If it
+// doesn't verify, any additional proofs are tried in order. The error
+// returned is the one from the first proof.
 func (v *Verification) VerifyProofDigest(digest sumcrypto.Hash, log sigsum.Log) (sigsum.PubKey, error) {
-	var ourPubkey sigsum.PubKey
+	_, ourPubkey, err := v.FindProof(digest, log)
 
-	if err := v.Proof.Verify(&digest, log.SubmitKeys, log.Policy); err != nil {
-		return ourPubkey, fmt.Errorf("%w", err)
+	return ourPubkey, err
+}
+
+// FindProof is like VerifyProofDigest but also returns the proof that
+// verified.
+func (v *Verification) FindProof(digest sumcrypto.Hash, log sigsum.Log) (proof.SigsumProof, sigsum.PubKey, error) {
+	ourPubkey, err := verifyProofDigest(v.Proof, digest, log)
+	if err == nil {
+		return v.Proof, ourPubkey, nil
 	}
 
-	keyFound := false
-	for keyindex, key := range log.Keys {
-		if sumcrypto.HashBytes(keyindex[:]) == v.Proof.Leaf.KeyHash {
-			keyFound = true
-			ourPubkey = key
-			break
+	for _, extra := range v.Proofs {
+		if pubkey, extraErr := verifyProofDigest(extra, digest, log); extraErr == nil {
+			return extra, pubkey, nil
 		}
 	}
 
-	if !keyFound {
-		return ourPubkey, errors.New("couldn't find submit key")
+	return v.Proof, ourPubkey, err
+}
+
+// UseProof makes p the Sigsum proof of v, for instance a proof from
+// a file produced by other Sigsum tools. The previous proof is kept
+// as an additional proof.
+func (v *Verification) UseProof(p proof.SigsumProof) error {
+	if v.Type != VerProof {
+		return errors.New("verification has no Sigsum proof to replace")
+	}
+
+	v.Proofs = append([]proof.SigsumProof{v.Proof}, v.Proofs...)
+	v.Proof = p
+
+	return nil
+}
+
+func verifyProofDigest(p proof.SigsumProof, digest sumcrypto.Hash, log sigsum.Log) (sigsum.PubKey, error) {
+	var ourPubkey sigsum.PubKey
+
+	if err := p.Verify(&digest, log.SubmitKeys, log.Policy); err != nil {
+		return ourPubkey, errorf(ErrProofInvalid, "%w", err)
+	}
+
+	ourPubkey, err := log.SubmitKey(p.Leaf.KeyHash)
+	if err != nil {
+		return ourPubkey, fmt.Errorf("%w", err)
 	}
 
 	// Also check that all cosigning witness signatures timestamps are
 	// within the submit key lifetime
-	for _, c := range v.Proof.TreeHead.Cosignatures {
+	for _, c := range p.TreeHead.Cosignatures {
 		if c.Timestamp > math.MaxInt64 {
-			return ourPubkey, fmt.Errorf("invalid timestamp: %d", c.Timestamp)
+			return ourPubkey, errorf(ErrProofInvalid, "invalid timestamp: %d", c.Timestamp)
 		}
 
 		ts := time.Unix(int64(c.Timestamp), 0)
 
 		if !ts.After(ourPubkey.Start) {
-			return ourPubkey, fmt.Errorf("witness cosignature outside of lifetime, %v not in %v - %v",
+			return ourPubkey, errorf(ErrKeyOutsideLifetime, "witness cosignature outside of lifetime, %v not in %v - %v",
 				ts.Format(time.RFC3339),
 				ourPubkey.Start.Format(time.RFC3339),
 				ourPubkey.End.Format(time.RFC3339))
 		}
 
 		if !ts.Before(ourPubkey.End) {
-			return ourPubkey, fmt.Errorf("witness cosignature outside of lifetime, %v not in %v - %v",
+			return ourPubkey, errorf(ErrKeyOutsideLifetime, "witness cosignature outside of lifetime, %v not in %v - %v",
 				ts.Format(time.RFC3339),
 				ourPubkey.Start.Format(time.RFC3339),
 				ourPubkey.End.Format(time.RFC3339))
 		}
+
+		// Anything cosigned after the submit key was compromised
+		// might have been logged by someone else.
+		if ourPubkey.Revoked && !ts.Before(ourPubkey.RevokedAt) {
+			return ourPubkey, errorf(ErrKeyRevoked, "witness cosignature after submit key compromise, %v not before %v: %v",
+				ts.Format(time.RFC3339),
+				ourPubkey.RevokedAt.Format(time.RFC3339),
+				ourPubkey.RevokeReason)
+		}
 	}
 
 	return ourPubkey, nil
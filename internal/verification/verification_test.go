@@ -6,9 +6,11 @@ package verification
 import (
 	"crypto/ed25519"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/tillitis/tkey-verification/internal/sigsum"
 	"github.com/tillitis/tkey-verification/internal/util"
@@ -112,6 +114,232 @@ func TestVerifySignature(t *testing.T) {
 	}
 }
 
+// TestVersion2 converts a version 1 file to version 2 and back
+// without changing what is verified.
+func TestVersion2(t *testing.T) {
+	var v1, v2 Verification
+
+	if err := v1.FromJSON([]byte(verificationSigJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	if v1.Version != 1 {
+		t.Fatalf("expected version 1, got %d", v1.Version)
+	}
+
+	v := v1
+	v.Version = 2
+	v.UDI = []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	v.ProductID = 8
+	v.FirmwareSize = 4192
+	v.FirmwareLabel = "qemu-1c90b1a"
+
+	j, err := v.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = v2.FromJSON(j); err != nil {
+		t.Fatal(err)
+	}
+
+	if v2.Version != 2 || v2.Type != VerSig || !v2.Timestamp.Equal(v1.Timestamp) ||
+		v2.AppTag != v1.AppTag || v2.AppHash != v1.AppHash ||
+		hex.EncodeToString(v2.Signature) != hex.EncodeToString(v1.Signature) ||
+		hex.EncodeToString(v2.UDI) != "0001020304050607" || v2.ProductID != 8 ||
+		v2.FirmwareSize != 4192 || v2.FirmwareLabel != "qemu-1c90b1a" {
+		t.Fatalf("got %+v, want %+v", v2, v)
+	}
+}
+
+func TestCheckUDI(t *testing.T) {
+	var v Verification
+
+	if err := v.FromJSON([]byte(verificationSigJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 1 doesn't know its UDI.
+	if err := v.CheckUDI([]byte{1, 2, 3, 4, 5, 6, 7, 8}); err != nil {
+		t.Fatal(err)
+	}
+
+	v.Version = 2
+	v.UDI = []byte{0, 1, 2, 3, 4, 5, 6, 7}
+
+	if err := v.CheckUDI([]byte{0, 1, 2, 3, 4, 5, 6, 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := v.CheckUDI([]byte{0, 1, 2, 3, 4, 5, 6, 8})
+	if !errors.Is(err, ErrWrongUDI) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	assertErrorMsgStartsWith(t, err, "verification file for wrong TKey: file is for UDI 0001020304050607, not 0001020304050608")
+}
+
+func TestUseProof(t *testing.T) {
+	var v Verification
+
+	if err := v.FromJSON([]byte(verificationSigJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	err := v.UseProof(v.Proof)
+	assertErrorMsgStartsWith(t, err, "verification has no Sigsum proof to replace")
+}
+
+func TestInvalidVersion2(t *testing.T) {
+	var v Verification
+
+	if err := v.FromJSON([]byte(strings.Replace(verificationSigJSON, "{", `{"version":1,`, 1))); err != nil || v.Version != 1 {
+		t.Fatalf("version 1 with a version field: %v %d", err, v.Version)
+	}
+
+	err := v.FromJSON([]byte(`{"version":3}`))
+	assertErrorMsgStartsWith(t, err, "unsupported verification file version 3")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("unexpected error type %T", err)
+	}
+
+	sig := strings.Replace(verificationSigJSON, "{", `{"version":2,"udi":"0001020304050607","productid":2,"firmware_size":4192,"firmware_label":"",`, 1)
+	err = v.FromJSON([]byte(sig))
+	assertErrorMsgStartsWith(t, err, "product ID 2 doesn't match UDI product ID 8")
+
+	sig = strings.Replace(verificationSigJSON, "{", `{"version":2,"udi":"0001","productid":8,"firmware_size":4192,"firmware_label":"",`, 1)
+	err = v.FromJSON([]byte(sig))
+	assertErrorMsgStartsWith(t, err, "invalid UDI")
+}
+
+// TestVerifySignatureRevokedKey verifies a signature made by a
+// revoked vendor key. Verification should fail.
+func TestVerifySignatureRevokedKey(t *testing.T) {
+	var v Verification
+
+	pubKey, msg := testVendorKeyAndMessage(t)
+	pubKey.Revoked = true
+	pubKey.RevokeReason = "leaked"
+
+	vendorKeys := vendorkey.VendorKeys{
+		Keys: map[string]vendorkey.PubKey{
+			"key": pubKey,
+		},
+	}
+
+	if err := v.FromJSON([]byte(verificationSigJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := v.VerifySig(msg, vendorKeys)
+	assertErrorMsgStartsWith(t, err, "signed by revoked key: leaked")
+	assertErrorIs(t, err, ErrKeyRevoked)
+}
+
+// TestVerifySignatureKeyLifetime verifies signatures with a vendor
+// key with a validity window. Only a signature over a timestamp
+// within the window should verify.
+func TestVerifySignatureKeyLifetime(t *testing.T) {
+	var v Verification
+
+	pubKey, msg := testVendorKeyAndMessage(t)
+	pubKey.Start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pubKey.End = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	vendorKeys := vendorkey.VendorKeys{
+		Keys: map[string]vendorkey.PubKey{
+			"key": pubKey,
+		},
+	}
+
+	// The timestamp of a version 1 file isn't signed.
+	if err := v.FromJSON([]byte(verificationSigJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := v.VerifySig(msg, vendorKeys)
+	assertErrorMsgStartsWith(t, err, "vendor key has a validity window, but its signature doesn't cover the timestamp")
+	assertErrorIs(t, err, ErrKeyOutsideLifetime)
+
+	// Sign the timestamp too, with the key of testVendorKeyAndMessage.
+	privKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	v.Version = 2
+	v.UDI = []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	v.ProductID = 8
+	v.SignedTimestamp = true
+	v.Timestamp = time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	v.Signature = ed25519.Sign(privKey, util.TimestampMessage(msg, v.Timestamp))
+
+	js, err := v.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = v.FromJSON(js); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = v.VerifySig(msg, vendorKeys)
+	assertErrorMsgStartsWith(t, err, "vendor signature outside of key lifetime")
+	assertErrorIs(t, err, ErrKeyOutsideLifetime)
+
+	// Move the lifetime to cover the signed timestamp.
+	pubKey.End = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	vendorKeys.Keys["key"] = pubKey
+
+	if _, err = v.VerifySig(msg, vendorKeys); err != nil {
+		t.Fatal(err)
+	}
+
+	// Moving the timestamp breaks the signature.
+	v.Timestamp = time.Date(2025, 6, 1, 0, 0, 1, 0, time.UTC)
+
+	if _, err = v.VerifySig(msg, vendorKeys); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Without a window, the unsigned timestamp is never checked.
+	pubKey.Start = time.Time{}
+	pubKey.End = time.Time{}
+	vendorKeys.Keys["key"] = pubKey
+
+	if err = v.FromJSON([]byte(verificationSigJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = v.VerifySig(msg, vendorKeys); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testVendorKeyAndMessage returns the test vendor key and the message
+// it signed in verificationSigJSON.
+func testVendorKeyAndMessage(t *testing.T) (vendorkey.PubKey, []byte) {
+	t.Helper()
+
+	udi := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+
+	seed := make([]byte, ed25519.SeedSize)
+	privKey := ed25519.NewKeyFromSeed(seed)
+
+	var pubKey vendorkey.PubKey
+	copy(pubKey.PubKey[:], privKey[32:])
+
+	fwDigest, err := hex.DecodeString("3769540390ee3d990ea3f9e4cc9a0d1af5bcaebb82218185a78c39c6bf01d9cdc305ba253a1fb9f3f9fcc63d97c8e5f34bbb1f7bec56a8f246f1d2239867b623")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := util.BuildMessage(udi, fwDigest, pubKey.PubKey[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pubKey, msg
+}
+
 func TestVerifyProofRawHash(t *testing.T) {
 	var v Verification
 	var log sigsum.Log
@@ -206,6 +434,57 @@ func TestVerifyProofKeyLifetime(t *testing.T) {
 
 	_, err = v.VerifyProof(msg, log)
 	assertErrorMsgStartsWith(t, err, "witness cosignature outside of lifetime")
+	assertErrorIs(t, err, ErrKeyOutsideLifetime)
+}
+
+// TestVerifyProofRevokedKey verifies a proof with a submit key that
+// has been revoked. Verification should fail only if the key was
+// compromised before the witnesses cosigned.
+func TestVerifyProofRevokedKey(t *testing.T) {
+	var v Verification
+	var log sigsum.Log
+
+	if err := log.FromString(submitKey, policyStr); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.FromJSON([]byte(verificationProofJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := sumcrypto.HashFromHex("2291327fbadd2b3b8f8c0c005426700ad9139425a52a9140679e89b3b65c359b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoke := func(at time.Time) {
+		for k, key := range log.Keys {
+			key.Revoked = true
+			key.RevokedAt = at
+			key.RevokeReason = "leaked"
+			log.Keys[k] = key
+		}
+	}
+
+	// Cosigned 2025-08-26, compromised later.
+	revoke(time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC))
+	if _, err := v.VerifyProofDigest(digest, log); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compromised before cosigning.
+	revoke(time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	_, err = v.VerifyProofDigest(digest, log)
+	assertErrorMsgStartsWith(t, err, "witness cosignature after submit key compromise")
+	assertErrorIs(t, err, ErrKeyRevoked)
+}
+
+func assertErrorIs(t *testing.T, err error, target error) {
+	t.Helper()
+
+	if !errors.Is(err, target) {
+		t.Fatalf("expected error %v, got %v", target, err)
+	}
 }
 
 func assertErrorMsgStartsWith(t *testing.T, err error, want string) {
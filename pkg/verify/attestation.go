@@ -0,0 +1,246 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package verify
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// AttestationVersion is the version of the attestation format.
+const AttestationVersion = 1
+
+// AttestationContext is prefixed to the digest of an attestation
+// when the TKey signs it, so the signature can't be used as a
+// signature over anything else.
+const AttestationContext = "tkey-verification attestation v1\x00"
+
+// ErrAttestationInvalid means the attestation isn't signed by the
+// TKey it describes, or isn't consistent.
+var ErrAttestationInvalid = errors.New("invalid attestation")
+
+// Attestation is a report that a TKey was verified, signed by the
+// signer device app of the verified TKey. It contains everything
+// needed to verify the identity of the TKey again later, without the
+// TKey, see CheckAttestation.
+type Attestation struct {
+	Version      int        `json:"version"`
+	UDI          string     `json:"udi"`
+	FirmwareSize int        `json:"firmware_size"`
+	FirmwareHash string     `json:"firmware_hash"`
+	PubKey       string     `json:"pubkey"`
+	Verification string     `json:"verification"` // The verification file used
+	Transcript   Transcript `json:"transcript"`
+	Tool         string     `json:"tool"` // Name and version of the verifying program
+	Timestamp    string     `json:"timestamp"`
+	Signature    string     `json:"signature,omitempty"`
+}
+
+// NewAttestation returns an unsigned attestation of the verification
+// in res, made by tool at now.
+func NewAttestation(res Result, tool string, now time.Time) Attestation {
+	return Attestation{
+		Version:      AttestationVersion,
+		UDI:          hex.EncodeToString(res.UDI.Bytes),
+		FirmwareSize: res.Firmware.Size,
+		FirmwareHash: hex.EncodeToString(res.Firmware.Hash[:]),
+		PubKey:       hex.EncodeToString(res.PubKey),
+		Verification: string(res.Data),
+		Transcript:   res.Transcript,
+		Tool:         tool,
+		Timestamp:    now.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// Message returns what the TKey signs:
+//
+//	AttestationContext || SHA-512(attestation JSON without signature)
+//
+// The digest keeps the message within what the signer device app
+// can sign.
+func (a Attestation) Message() ([]byte, error) {
+	a.Signature = ""
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal JSON: %w", err)
+	}
+
+	digest := sha512.Sum512(b)
+
+	return append([]byte(AttestationContext), digest[:]...), nil
+}
+
+// Sign signs the attestation with sign, typically the Sign method of
+// the just verified TKey.
+func (a *Attestation) Sign(sign func(message []byte) ([]byte, error)) error {
+	msg, err := a.Message()
+	if err != nil {
+		return err
+	}
+
+	sig, err := sign(msg)
+	if err != nil {
+		return fmt.Errorf("couldn't sign attestation: %w", err)
+	}
+
+	a.Signature = hex.EncodeToString(sig)
+
+	return nil
+}
+
+func (a *Attestation) FromJSON(b []byte) error {
+	if err := json.Unmarshal(b, a); err != nil {
+		return fmt.Errorf("couldn't unmarshal JSON: %w", err)
+	}
+
+	return nil
+}
+
+func (a *Attestation) ToJSON() ([]byte, error) {
+	b, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal JSON: %w", err)
+	}
+
+	return b, nil
+}
+
+func (a *Attestation) FromFile(fn string) error {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return a.FromJSON(b)
+}
+
+func (a *Attestation) ToFile(fn string) error {
+	b, err := a.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(fn, append(b, '\n'), 0o644); err != nil { // #nosec G306
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// CheckAttestation verifies an attestation made by NewAttestation and
+// Sign, without the TKey:
+//
+//   - The attestation is signed by the public key in it.
+//
+//   - The challenge transcript verifies with the same public key.
+//
+//   - The firmware is the expected one for the UDI.
+//
+//   - The verification file proves that the UDI, firmware and public
+//     key is a genuine TKey, as during Verify, with the trust store
+//     of v.
+//
+// It returns the result of the verification. Any error is an *Error.
+func (v *Verifier) CheckAttestation(a Attestation) (Result, error) {
+	var res Result
+
+	if a.Version != AttestationVersion {
+		return res, errorf(KindParse, "unsupported attestation version %d", a.Version)
+	}
+
+	udiBE, err := hex.DecodeString(a.UDI)
+	if err != nil {
+		return res, errorf(KindParse, "couldn't decode UDI: %w", err)
+	}
+
+	if err = res.UDI.FromBE(udiBE); err != nil {
+		return res, errorf(KindParse, "invalid UDI: %w", err)
+	}
+
+	res.PubKey, err = hex.DecodeString(a.PubKey)
+	if err != nil || len(res.PubKey) != ed25519.PublicKeySize {
+		return res, errorf(KindParse, "couldn't decode public key")
+	}
+
+	if a.Signature == "" {
+		return res, errorf(KindParse, "attestation not signed")
+	}
+
+	sig, err := hex.DecodeString(a.Signature)
+	if err != nil {
+		return res, errorf(KindParse, "couldn't decode signature: %w", err)
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, a.Timestamp)
+	if err != nil {
+		return res, errorf(KindParse, "couldn't parse timestamp: %w", err)
+	}
+
+	msg, err := a.Message()
+	if err != nil {
+		return res, newError(KindParse, err)
+	}
+
+	if !ed25519.Verify(res.PubKey, msg, sig) {
+		return res, errorf(KindVerification, "%w: signature not verified", ErrAttestationInvalid)
+	}
+
+	if err = a.Transcript.Verify(res.PubKey); err != nil {
+		return res, newError(KindVerification, err)
+	}
+
+	for i, c := range a.Transcript {
+		if c.Time.After(timestamp) {
+			return res, errorf(KindVerification, "%w: challenge %d after the attestation", ErrAttestationInvalid, i+1)
+		}
+	}
+
+	res.Transcript = a.Transcript
+
+	useSigsum, err := v.needSigsum(res.UDI)
+	if err != nil {
+		return res, err
+	}
+
+	res.Data = []byte(a.Verification)
+	res.Origin = "attestation"
+
+	ver, err := v.parseVerification(&res)
+	if err != nil {
+		return res, err
+	}
+
+	expectedFW, err := v.Trust.Firmwares.GetFirmware(res.UDI)
+	if err != nil {
+		return res, errorf(KindVerification, "unexpected firmware: %w", err)
+	}
+
+	fwHash, err := hex.DecodeString(a.FirmwareHash)
+	if err != nil {
+		return res, errorf(KindParse, "couldn't decode firmware digest: %w", err)
+	}
+
+	if a.FirmwareSize != expectedFW.Size {
+		return res, errorf(KindVerification, "%w: firmware size %d, expected %d", ErrFirmwareMismatch, a.FirmwareSize, expectedFW.Size)
+	}
+
+	if err = expectedFW.Check(fwHash); err != nil {
+		return res, newError(KindVerification, err)
+	}
+
+	res.Firmware = expectedFW
+
+	if err = v.verifyIdentity(&res, ver, useSigsum); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
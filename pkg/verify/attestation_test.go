@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package verify
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func (d *fakeDevice) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(d.priv, message), nil
+}
+
+func testAttestation(t *testing.T) (*Verifier, Attestation) {
+	t.Helper()
+
+	trust, dev, ver := setup(t)
+	v := New(trust, bytesFetcher(ver))
+
+	res, err := v.Verify(context.Background(), dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAttestation(res, "test", time.Now())
+	if err = a.Sign(dev.Sign); err != nil {
+		t.Fatal(err)
+	}
+
+	return v, a
+}
+
+func TestAttestation(t *testing.T) {
+	v, a := testAttestation(t)
+
+	fn := filepath.Join(t.TempDir(), "attestation.json")
+	if err := a.ToFile(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	var read Attestation
+	if err := read.FromFile(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := v.CheckAttestation(read)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Method != MethodSignature || len(res.Transcript) != 1 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+}
+
+func TestAttestationInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(a *Attestation)
+		is     error
+	}{
+		{
+			name: "changed tool",
+			modify: func(a *Attestation) {
+				a.Tool = "other"
+			},
+			is: ErrAttestationInvalid,
+		},
+		{
+			name: "changed firmware",
+			modify: func(a *Attestation) {
+				a.FirmwareHash = a.FirmwareHash[2:] + "00"
+			},
+			is: ErrAttestationInvalid,
+		},
+		{
+			name: "no challenges",
+			modify: func(a *Attestation) {
+				a.Transcript = nil
+			},
+			is: ErrAttestationInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, a := testAttestation(t)
+			test.modify(&a)
+
+			_, err := v.CheckAttestation(a)
+			if !IsCounterfeit(err) || !errors.Is(err, test.is) {
+				t.Fatalf("expected %v, got %v", test.is, err)
+			}
+		})
+	}
+
+	v, a := testAttestation(t)
+	a.Signature = ""
+
+	var vErr *Error
+	if _, err := v.CheckAttestation(a); !errors.As(err, &vErr) || vErr.Kind != KindParse {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package verify
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tillitis/tkey-verification/internal/firmware"
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+	"github.com/tillitis/tkey-verification/internal/tkey"
+	"github.com/tillitis/tkey-verification/internal/verification"
+)
+
+// Kind tells what sort of failure an Error is, and so what the user
+// can do about it.
+type Kind int
+
+const (
+	// KindIO is a failure to talk to the TKey, the verification
+	// server or the file system. Trying again might help.
+	KindIO Kind = iota + 1
+	// KindParse is verification data that couldn't be parsed.
+	KindParse
+	// KindMissing is something missing from the trust store.
+	// The program is not built correctly.
+	KindMissing
+	// KindNotFound is something the verification data refers to
+	// that couldn't be found, like the device app, or
+	// verification data for another TKey.
+	KindNotFound
+	// KindVerification is a real verification failure. The TKey
+	// might be manipulated.
+	KindVerification
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindIO:
+		return "I/O failed"
+	case KindParse:
+		return "parse error"
+	case KindMissing:
+		return "missing"
+	case KindNotFound:
+		return "not found"
+	case KindVerification:
+		return "verification failed"
+	}
+
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Error is returned by Verify. Err tells exactly what failed and can
+// be tested with errors.Is and errors.As, see the Err variables.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors that can be tested for with errors.Is on errors from
+// Verify.
+var (
+	// ErrWrongUDI means the verification data is for another
+	// TKey.
+	ErrWrongUDI = verification.ErrWrongUDI
+	// ErrUnsupportedVersion means verification data in a format
+	// version we don't know.
+	ErrUnsupportedVersion = verification.ErrUnsupportedVersion
+	// ErrUnknownVendor means a TKey from another vendor.
+	ErrUnknownVendor = errors.New("unknown vendor ID")
+	// ErrUnknownProduct means we don't know if the product
+	// needs a vendor signature or a Sigsum proof.
+	ErrUnknownProduct = errors.New("unknown product ID")
+	// ErrAppNotFound means the device app in the verification
+	// data isn't in the trust store.
+	ErrAppNotFound = errors.New("device app not found")
+
+	// ErrChallengeFailed means the device app couldn't prove it
+	// has the private key it claims.
+	ErrChallengeFailed = tkey.ErrChallengeFailed
+	// ErrFirmwareNotFound means the hardware of the TKey isn't
+	// in the firmware database.
+	ErrFirmwareNotFound = firmware.ErrFirmwareNotFound
+	// ErrFirmwareMismatch means the TKey doesn't have the
+	// expected firmware.
+	ErrFirmwareMismatch = firmware.ErrFirmwareMismatch
+	// ErrSignatureInvalid means no vendor key verified the vendor
+	// signature.
+	ErrSignatureInvalid = verification.ErrSignatureInvalid
+	// ErrProofInvalid means the Sigsum proof didn't verify.
+	ErrProofInvalid = verification.ErrProofInvalid
+	// ErrUnknownSubmitKey means the Sigsum proof is for a leaf
+	// with a submit key that isn't ours.
+	ErrUnknownSubmitKey = sigsum.ErrUnknownSubmitKey
+	// ErrKeyRevoked means the signature or proof is from a
+	// revoked key.
+	ErrKeyRevoked = verification.ErrKeyRevoked
+	// ErrKeyOutsideLifetime means the signature or proof is from
+	// outside the lifetime of its key.
+	ErrKeyOutsideLifetime = verification.ErrKeyOutsideLifetime
+	// ErrSigsumRequired means the TKey needs a Sigsum proof but
+	// the verification data has a vendor signature.
+	ErrSigsumRequired = errors.New("Sigsum proof required but not available")
+	// ErrUnexpectedProof means the TKey needs a vendor signature
+	// but the verification data has a Sigsum proof.
+	ErrUnexpectedProof = errors.New("expected vendor signature but got a Sigsum proof")
+)
+
+// ParseError is verification data that couldn't be parsed.
+type ParseError = verification.ParseError
+
+// CommError is a failure to talk to a TKey.
+type CommError = tkey.CommError
+
+// IsCounterfeit returns true if err means the TKey failed
+// verification, as opposed to verification not being possible to
+// complete.
+func IsCounterfeit(err error) bool {
+	var vErr *Error
+
+	return errors.As(err, &vErr) && vErr.Kind == KindVerification
+}
+
+func newError(kind Kind, err error) *Error {
+	return &Error{Kind: kind, Err: err}
+}
+
+func errorf(kind Kind, format string, a ...any) *Error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, a...)}
+}
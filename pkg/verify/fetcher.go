@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package verify
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tillitis/tkey-verification/internal/data"
+	"github.com/tillitis/tkey-verification/internal/fetch"
+)
+
+// Fetcher gets the verification data of a TKey.
+type Fetcher interface {
+	// Fetch returns the verification data of the TKey with the
+	// big-endian UDI udiBE, and a description of where it came
+	// from.
+	Fetch(ctx context.Context, udiBE []byte) ([]byte, string, error)
+}
+
+// ErrNotFound means the verification server has no verification
+// data for the TKey.
+var ErrNotFound = fetch.ErrNotFound
+
+// HTTPConfig configures the HTTP client of Mirrors, see NewMirrors.
+type HTTPConfig = fetch.Config
+
+// DirFetcher reads verification data from files in a directory,
+// named after the UDI in hex.
+type DirFetcher string
+
+func (d DirFetcher) Fetch(_ context.Context, udiBE []byte) ([]byte, string, error) {
+	fn := filepath.Join(string(d), hex.EncodeToString(udiBE))
+
+	content, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w", err)
+	}
+
+	return content, fn, nil
+}
+
+// Mirrors fetches files over HTTP from the verification server and
+// its mirrors, trying them in order.
+type Mirrors struct {
+	BaseURLs []string
+	client   *fetch.Fetcher
+
+	// Logf, if set, is called with the failures of mirrors that
+	// are skipped, and with progress if Verbose is set.
+	Logf    func(format string, v ...any)
+	Verbose bool
+}
+
+// NewMirrors returns Mirrors trying baseURLs in order, with an HTTP
+// client configured by conf. If baseURLs is empty, the embedded list
+// of mirrors is used.
+func NewMirrors(baseURLs []string, conf HTTPConfig) (*Mirrors, error) {
+	client, err := fetch.New(conf)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if len(baseURLs) == 0 {
+		baseURLs = EmbeddedMirrors()
+	}
+
+	m := Mirrors{
+		client: client,
+	}
+
+	for _, u := range baseURLs {
+		m.BaseURLs = append(m.BaseURLs, strings.TrimSuffix(u, "/"))
+	}
+
+	return &m, nil
+}
+
+// EmbeddedMirrors returns the embedded base URLs of the verification
+// server and its mirrors.
+func EmbeddedMirrors() []string {
+	var mirrors []string
+
+	for _, line := range strings.Split(data.VerifyMirrors, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		mirrors = append(mirrors, strings.TrimSuffix(line, "/"))
+	}
+
+	return mirrors
+}
+
+func (m *Mirrors) logf(format string, v ...any) {
+	if m.Logf != nil {
+		m.Logf(format, v...)
+	}
+}
+
+// Fetch gets the verification file of a TKey from the first mirror
+// that has it. It returns the base URL of that mirror.
+func (m *Mirrors) Fetch(ctx context.Context, udiBE []byte) ([]byte, string, error) {
+	return m.Get(ctx, hex.EncodeToString(udiBE))
+}
+
+// Get gets name from the first mirror that has it and returns it
+// together with the base URL of the mirror that served it.
+//
+// If all mirrors answered that they don't have it, the error wraps
+// ErrNotFound. Otherwise the error contains the failures of the
+// mirrors that couldn't answer.
+func (m *Mirrors) Get(ctx context.Context, name string) ([]byte, string, error) {
+	var errs, notFoundErrs []error
+
+	if len(m.BaseURLs) == 0 {
+		return nil, "", errors.New("no verification server")
+	}
+
+	client := m.client
+	if client == nil {
+		client = fetch.Default()
+	}
+
+	for _, baseURL := range m.BaseURLs {
+		u := fmt.Sprintf("%s/%s", baseURL, name)
+
+		if m.Verbose {
+			m.logf("Fetching %s ...\n", u)
+		}
+
+		body, err := client.GetContext(ctx, u)
+		if err == nil {
+			return body, baseURL, nil
+		}
+
+		if len(m.BaseURLs) > 1 {
+			m.logf("Couldn't fetch from mirror %s: %v\n", baseURL, err)
+		}
+
+		if errors.Is(err, fetch.ErrNotFound) {
+			notFoundErrs = append(notFoundErrs, err)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, "", errors.Join(notFoundErrs...)
+	}
+
+	return nil, "", errors.Join(errs...)
+}
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package verify
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// StatementVersion is the version of the public key statement
+// format.
+const StatementVersion = 1
+
+// StatementContext is prefixed to the digest of a public key
+// statement when the TKey signs it.
+const StatementContext = "tkey-verification pubkey statement v1\x00"
+
+// ErrStatementInvalid means the public key statement isn't signed by
+// the key it states.
+var ErrStatementInvalid = errors.New("invalid public key statement")
+
+// Statement binds the public key of the signer device app to the UDI
+// of a TKey that was verified to be genuine. It is signed by the TKey
+// itself. Unlike an Attestation it doesn't contain the verification
+// data, so it doesn't prove that the TKey is genuine on its own. It
+// records that the tool did.
+type Statement struct {
+	Version   int    `json:"version"`
+	UDI       string `json:"udi"`
+	PubKey    string `json:"pubkey"`
+	AppTag    string `json:"app_tag"`
+	AppHash   string `json:"app_hash"`
+	Method    string `json:"verified_with"`
+	Tool      string `json:"tool"` // Name and version of the verifying program
+	Timestamp string `json:"timestamp"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// NewStatement returns an unsigned statement of the public key in
+// res, verified by tool at now.
+func NewStatement(res Result, tool string, now time.Time) Statement {
+	return Statement{
+		Version:   StatementVersion,
+		UDI:       hex.EncodeToString(res.UDI.Bytes),
+		PubKey:    hex.EncodeToString(res.PubKey),
+		AppTag:    res.AppTag,
+		AppHash:   hex.EncodeToString(res.AppHash[:]),
+		Method:    res.Method.String(),
+		Tool:      tool,
+		Timestamp: now.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// Message returns what the TKey signs:
+//
+//	StatementContext || SHA-512(statement JSON without signature)
+func (s Statement) Message() ([]byte, error) {
+	s.Signature = ""
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal JSON: %w", err)
+	}
+
+	digest := sha512.Sum512(b)
+
+	return append([]byte(StatementContext), digest[:]...), nil
+}
+
+// Sign signs the statement with sign, typically the Sign method of
+// the just verified TKey.
+func (s *Statement) Sign(sign func(message []byte) ([]byte, error)) error {
+	msg, err := s.Message()
+	if err != nil {
+		return err
+	}
+
+	sig, err := sign(msg)
+	if err != nil {
+		return fmt.Errorf("couldn't sign statement: %w", err)
+	}
+
+	s.Signature = hex.EncodeToString(sig)
+
+	return nil
+}
+
+// Verify checks that the statement is signed by the public key in it.
+func (s Statement) Verify() error {
+	if s.Version != StatementVersion {
+		return fmt.Errorf("unsupported statement version %d", s.Version)
+	}
+
+	pubKey, err := hex.DecodeString(s.PubKey)
+	if err != nil || len(pubKey) != ed25519.PublicKeySize {
+		return errors.New("couldn't decode public key")
+	}
+
+	sig, err := hex.DecodeString(s.Signature)
+	if err != nil {
+		return fmt.Errorf("couldn't decode signature: %w", err)
+	}
+
+	msg, err := s.Message()
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pubKey, msg, sig) {
+		return fmt.Errorf("%w: signature not verified", ErrStatementInvalid)
+	}
+
+	return nil
+}
+
+func (s *Statement) FromJSON(b []byte) error {
+	if err := json.Unmarshal(b, s); err != nil {
+		return fmt.Errorf("couldn't unmarshal JSON: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Statement) ToJSON() ([]byte, error) {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal JSON: %w", err)
+	}
+
+	return b, nil
+}
+
+func (s *Statement) FromFile(fn string) error {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return s.FromJSON(b)
+}
+
+func (s *Statement) ToFile(fn string) error {
+	b, err := s.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(fn, append(b, '\n'), 0o644); err != nil { // #nosec G306
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
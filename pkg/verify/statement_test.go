@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package verify
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatement(t *testing.T) {
+	trust, dev, ver := setup(t)
+
+	res, err := New(trust, bytesFetcher(ver)).Verify(context.Background(), dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStatement(res, "test", time.Now())
+	if err = s.Sign(dev.Sign); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := filepath.Join(t.TempDir(), "statement.json")
+	if err = s.ToFile(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	var read Statement
+	if err = read.FromFile(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = read.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	if read.UDI != hex.EncodeToString(dev.udi.Bytes) || read.Method != MethodSignature.String() {
+		t.Fatalf("unexpected statement %+v", read)
+	}
+
+	// Bind the key to another TKey
+	read.UDI = "0133708200000002"
+	if err = read.Verify(); !errors.Is(err, ErrStatementInvalid) {
+		t.Fatalf("expected %v, got %v", ErrStatementInvalid, err)
+	}
+}
@@ -0,0 +1,505 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package verify verifies that a TKey is genuine.
+//
+// A Verifier is configured with a TrustStore, which holds everything
+// trusted: the Sigsum log, the vendor signing keys, the known
+// firmwares and the device apps, and with a Fetcher, which gets the
+// verification data of a TKey. Verify then does the whole
+// verification against a connected TKey:
+//
+//	trust, err := verify.EmbeddedTrustStore()
+//	...
+//	mirrors, err := verify.NewMirrors(nil, verify.HTTPConfig{})
+//	...
+//	tk, err := verify.Open("", tkeyclient.SerialSpeed)
+//	...
+//	defer tk.Close()
+//
+//	res, err := verify.New(trust, mirrors).Verify(ctx, tk)
+//
+// Any error from Verify is an *Error, telling what kind of failure
+// it was. Only KindVerification means that the TKey might be
+// manipulated, see IsCounterfeit.
+package verify
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/appbins"
+	"github.com/tillitis/tkey-verification/internal/data"
+	"github.com/tillitis/tkey-verification/internal/firmware"
+	"github.com/tillitis/tkey-verification/internal/revocation"
+	"github.com/tillitis/tkey-verification/internal/sigsum"
+	"github.com/tillitis/tkey-verification/internal/tkey"
+	"github.com/tillitis/tkey-verification/internal/util"
+	"github.com/tillitis/tkey-verification/internal/vendorkey"
+	"github.com/tillitis/tkey-verification/internal/verification"
+	"github.com/tillitis/tkeyclient"
+	sumcrypto "sigsum.org/sigsum-go/pkg/crypto"
+	"sigsum.org/sigsum-go/pkg/proof"
+)
+
+// VendorID is the vendor ID of genuine TKeys.
+const VendorID = 0x1337
+
+// UDI is the Unique Device Identifier of a TKey.
+type UDI = tkey.UDI
+
+// TKey is a connected TKey, see Open.
+type TKey = tkey.TKey
+
+// Transcript is a record of the challenges a TKey answered during
+// verification. It can be verified again later with its Verify
+// method.
+type Transcript = tkey.Transcript
+
+// Device is a TKey to verify. A *TKey is a Device.
+type Device interface {
+	GetUDI() UDI
+	// LoadSigner loads the signer device app bin without USS and
+	// returns its public key.
+	LoadSigner(bin []byte) ([]byte, error)
+	// Challenge proves n times that the device app has the
+	// private key of pubKey. It returns the transcript of the
+	// challenges.
+	Challenge(pubKey []byte, n int) (Transcript, error)
+	// GetFirmwareHash returns the digest of the first
+	// firmwareSize bytes of the firmware.
+	GetFirmwareHash(firmwareSize int) ([]byte, error)
+}
+
+// AppManifest describes where an embedded device app comes from:
+// source repository, tag, commit, toolchain, build date and license.
+type AppManifest = appbins.Manifest
+
+// AppBin is a signer device app binary.
+type AppBin = appbins.AppBin
+
+// AppBins are the device apps a TrustStore knows, by digest.
+type AppBins = appbins.AppBins
+
+// Firmware is a known firmware of a TKey hardware.
+type Firmware = firmware.Firmware
+
+// Firmwares is the firmware database, see NewTrustStore for its
+// format.
+type Firmwares = firmware.Firmwares
+
+// VendorKeys are the vendor signing public keys.
+type VendorKeys = vendorkey.VendorKeys
+
+// SigsumLog is the Sigsum submit keys and policy.
+type SigsumLog = sigsum.Log
+
+// RevocationList is a verified, signed list of revoked keys, see
+// ParseRevocationList.
+type RevocationList = revocation.List
+
+// Open connects to the TKey on the serial port devPath. If devPath
+// is empty, the port is auto-detected.
+func Open(devPath string, speed int) (*TKey, error) {
+	tk, err := tkey.NewTKey(devPath, speed, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return tk, nil
+}
+
+// TrustStore holds everything a Verifier trusts.
+type TrustStore struct {
+	Log        SigsumLog
+	VendorKeys VendorKeys
+	Firmwares  Firmwares
+	AppBins    AppBins
+}
+
+// TrustConfig is what a TrustStore trusts, in the formats embedded
+// in this program, see NewTrustStore.
+type TrustConfig struct {
+	Firmwares  string // Firmware database
+	VendorKeys string // Vendor signing public keys
+	SigsumConf string // Sigsum submit keys
+	Policy     string // Sigsum policy
+}
+
+// NewTrustStore returns a trust store with the embedded device apps
+// and everything else in conf. The formats are those of the
+// embedded trust store, see internal/data in the source. Add other
+// device apps with AddAppDir. Any error is of KindMissing.
+func NewTrustStore(conf TrustConfig) (TrustStore, error) {
+	var t TrustStore
+	var err error
+
+	if err = t.Firmwares.FromString(conf.Firmwares); err != nil {
+		return t, errorf(KindMissing, "no firmware database: %w", err)
+	}
+
+	if t.AppBins, err = appbins.NewAppBins(); err != nil {
+		return t, errorf(KindMissing, "no embedded device apps: %w", err)
+	}
+
+	if err = t.VendorKeys.FromString(conf.VendorKeys, t.AppBins); err != nil {
+		return t, errorf(KindMissing, "no vendor signing public key: %w", err)
+	}
+
+	if err = t.Log.FromString(conf.SigsumConf, conf.Policy); err != nil {
+		return t, errorf(KindMissing, "Sigsum configuration missing: %w", err)
+	}
+
+	return t, nil
+}
+
+// EmbeddedTrustStore returns the trust store embedded in this
+// program. Any error is of KindMissing.
+func EmbeddedTrustStore() (TrustStore, error) {
+	return NewTrustStore(TrustConfig{
+		Firmwares:  data.FirmwaresConf,
+		VendorKeys: data.VendorPubKeys,
+		SigsumConf: data.SigsumConf,
+		Policy:     data.PolicyStr,
+	})
+}
+
+// AddAppDir adds the device apps in dir that aren't already in t.
+// The apps are *.bin files, each with a *.bin.sha512 digest and a
+// *.bin.manifest. This lets the verification data select a device
+// app newer than this program. The digest of the app is still the
+// one in the verification data. It returns the apps added.
+func (t *TrustStore) AddAppDir(dir string) ([]AppBin, error) {
+	extra, err := appbins.FromDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if t.AppBins.Bins == nil {
+		t.AppBins.Bins = map[[sha512.Size]byte]AppBin{}
+	}
+
+	var added []AppBin
+
+	for _, appBin := range extra.List() {
+		hash := appBin.Hash()
+		if _, ok := t.AppBins.Bins[hash]; ok {
+			continue
+		}
+
+		t.AppBins.Bins[hash] = appBin
+		added = append(added, appBin)
+	}
+
+	return added, nil
+}
+
+// Revoke marks all keys in list as revoked, both vendor keys and
+// Sigsum submit keys.
+func (t *TrustStore) Revoke(list RevocationList) {
+	t.VendorKeys.Revoke(list)
+	t.Log.Revoke(list)
+}
+
+// EmbeddedRevocationKeys returns the public keys embedded in this
+// program that are trusted to sign revocation lists. There might be
+// none.
+func EmbeddedRevocationKeys() ([][ed25519.PublicKeySize]byte, error) {
+	keys, err := revocation.ParseTrusted(data.RevocationPubKeys)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return keys, nil
+}
+
+// ParseRevocationList parses the signed revocation list s and
+// verifies its signature against any of the trusted public keys.
+func ParseRevocationList(s string, trusted [][ed25519.PublicKeySize]byte) (RevocationList, error) {
+	var list RevocationList
+
+	if err := list.FromString(s, trusted); err != nil {
+		return list, fmt.Errorf("%w", err)
+	}
+
+	return list, nil
+}
+
+// Method is how the identity of a TKey was verified.
+type Method int
+
+const (
+	// MethodSignature is a vendor signature.
+	MethodSignature Method = iota + 1
+	// MethodSigsum is a Sigsum proof of logging.
+	MethodSigsum
+)
+
+func (m Method) String() string {
+	switch m {
+	case MethodSignature:
+		return "vendor signature"
+	case MethodSigsum:
+		return "Sigsum proof"
+	}
+
+	return fmt.Sprintf("Method(%d)", int(m))
+}
+
+// Result describes a genuine TKey.
+type Result struct {
+	UDI    UDI
+	Method Method
+
+	// The verification data as fetched, where it came from and
+	// when it was created.
+	Data    []byte
+	Origin  string
+	Created time.Time
+
+	AppTag      string
+	AppHash     [sha512.Size]byte
+	AppManifest AppManifest // Where the signer device app comes from
+	PubKey      []byte      // Public key of the signer device app
+
+	Firmware Firmware
+
+	// Transcript of the challenge/responses proving that the TKey
+	// has the private key of PubKey.
+	Transcript Transcript
+
+	// Message is the identity message that was signed or logged.
+	Message []byte
+
+	// VendorKey is the vendor key that made the signature, with
+	// MethodSignature.
+	VendorKey [ed25519.PublicKeySize]byte
+
+	// SubmitKey and Proof are the submit key and the Sigsum proof
+	// that verified, with MethodSigsum.
+	SubmitKey [ed25519.PublicKeySize]byte
+	Proof     proof.SigsumProof
+}
+
+// Verifier verifies TKeys.
+type Verifier struct {
+	Trust   TrustStore
+	Fetcher Fetcher
+
+	// Challenges is the number of challenge/responses to do with
+	// the TKey. Less than 1 means 1.
+	Challenges int
+
+	// RequireSigsum demands a Sigsum proof, whatever the product
+	// of the TKey.
+	RequireSigsum bool
+
+	// Proof, if set, is used instead of the Sigsum proof in the
+	// verification data.
+	Proof *proof.SigsumProof
+}
+
+// New returns a Verifier trusting trust and getting verification
+// data from fetcher.
+func New(trust TrustStore, fetcher Fetcher) *Verifier {
+	return &Verifier{
+		Trust:   trust,
+		Fetcher: fetcher,
+	}
+}
+
+// Verify verifies that dev is a genuine TKey by:
+//
+//   - Fetching the verification data, indexed by the UDI.
+//
+//   - Loading the signer indicated in the verification data, which
+//     returns the public key.
+//
+//   - Doing a challenge/response to prove the signer's identity
+//     against the public key we just got.
+//
+//   - Verifying that the device has the expected firmware.
+//
+//   - Recreating the identity message and verifying the vendor
+//     signature or the Sigsum proof over it.
+//
+// Any error is an *Error.
+func (v *Verifier) Verify(ctx context.Context, dev Device) (Result, error) {
+	udi := dev.GetUDI()
+	res := Result{
+		UDI: udi,
+	}
+
+	useSigsum, err := v.needSigsum(udi)
+	if err != nil {
+		return res, err
+	}
+
+	res.Data, res.Origin, err = v.Fetcher.Fetch(ctx, udi.Bytes)
+	if err != nil {
+		if errors.Is(err, ErrWrongUDI) {
+			return res, newError(KindNotFound, err)
+		}
+
+		return res, newError(KindIO, err)
+	}
+
+	ver, err := v.parseVerification(&res)
+	if err != nil {
+		return res, err
+	}
+
+	// Find the right app to run
+	appBin, ok := v.Trust.AppBins.Bins[ver.AppHash]
+	if !ok {
+		return res, errorf(KindNotFound, "%w: app digest %0x…", ErrAppNotFound, ver.AppHash[:16])
+	}
+
+	res.AppManifest = appBin.Manifest
+
+	if err = ctx.Err(); err != nil {
+		return res, newError(KindIO, err)
+	}
+
+	res.PubKey, err = dev.LoadSigner(appBin.Bin)
+	if err != nil {
+		return res, newError(KindIO, err)
+	}
+
+	// Check device identity
+	res.Transcript, err = dev.Challenge(res.PubKey, v.Challenges)
+	if err != nil {
+		if errors.Is(err, ErrChallengeFailed) {
+			return res, newError(KindVerification, err)
+		}
+
+		return res, newError(KindIO, err)
+	}
+
+	// Check we have the right firmware.
+	expectedFW, err := v.Trust.Firmwares.GetFirmware(udi)
+	if err != nil {
+		return res, errorf(KindVerification, "unexpected firmware: %w", err)
+	}
+
+	fwHash, err := dev.GetFirmwareHash(expectedFW.Size)
+	if err != nil {
+		return res, errorf(KindIO, "couldn't get firmware digest from TKey: %w", err)
+	}
+
+	if err = expectedFW.Check(fwHash); err != nil {
+		return res, newError(KindVerification, err)
+	}
+
+	res.Firmware = expectedFW
+
+	if err = v.verifyIdentity(&res, ver, useSigsum); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+// needSigsum returns true if the TKey with udi needs a Sigsum proof,
+// false if it needs a vendor signature.
+func (v *Verifier) needSigsum(udi UDI) (bool, error) {
+	if udi.VendorID != VendorID {
+		return false, errorf(KindNotFound, "%w %#x", ErrUnknownVendor, udi.VendorID)
+	}
+
+	if v.RequireSigsum {
+		return true, nil
+	}
+
+	// Castor means we demand a Sigsum proof. Bellatrix means
+	// vendor signature.
+	switch udi.ProductID {
+	case tkeyclient.UDIPIDBellatrix:
+		return false, nil
+	case tkeyclient.UDIPIDCastor:
+		return true, nil
+	}
+
+	return false, errorf(KindNotFound, "%w %d, don't know if we need signature or Sigsum proof", ErrUnknownProduct, udi.ProductID)
+}
+
+// parseVerification parses the verification data in res.Data, for
+// the TKey with res.UDI, and describes it in res.
+func (v *Verifier) parseVerification(res *Result) (verification.Verification, error) {
+	var ver verification.Verification
+
+	if err := ver.FromJSON(res.Data); err != nil {
+		return ver, newError(KindParse, err)
+	}
+
+	if err := ver.CheckUDI(res.UDI.Bytes); err != nil {
+		return ver, newError(KindNotFound, err)
+	}
+
+	if v.Proof != nil {
+		if err := ver.UseProof(*v.Proof); err != nil {
+			return ver, newError(KindParse, err)
+		}
+	}
+
+	res.Created = ver.Timestamp
+	res.AppTag = ver.AppTag
+	res.AppHash = ver.AppHash
+
+	return ver, nil
+}
+
+// verifyIdentity recreates the identity message of res.UDI,
+// res.Firmware and res.PubKey and verifies the vendor signature or
+// Sigsum proof in ver over it. The firmware size in ver must match
+// res.Firmware.
+func (v *Verifier) verifyIdentity(res *Result, ver verification.Verification, useSigsum bool) error {
+	var err error
+
+	// Version 2 tells the size of the firmware it was made for
+	if ver.Version >= 2 && ver.FirmwareSize != res.Firmware.Size {
+		return errorf(KindVerification, "%w: verification data for firmware size %d, expected %d",
+			ErrFirmwareMismatch, ver.FirmwareSize, res.Firmware.Size)
+	}
+
+	// Recreate message the vendor signed
+	res.Message, err = util.BuildMessage(res.UDI.Bytes, res.Firmware.Hash[:], res.PubKey)
+	if err != nil {
+		return newError(KindParse, err)
+	}
+
+	// Verify the vendor signature or Sigsum proof over the
+	// recreated message.
+	switch {
+	case ver.IsProof() && !useSigsum:
+		return newError(KindVerification, ErrUnexpectedProof)
+
+	case ver.IsProof():
+		verifiedProof, submitKey, err := ver.FindProof(sumcrypto.HashBytes(res.Message), v.Trust.Log)
+		if err != nil {
+			return newError(KindVerification, err)
+		}
+
+		res.Method = MethodSigsum
+		res.Proof = verifiedProof
+		res.SubmitKey = submitKey.Key
+
+	case useSigsum:
+		return newError(KindVerification, ErrSigsumRequired)
+
+	default:
+		verifiedWith, err := ver.VerifySig(res.Message, v.Trust.VendorKeys)
+		if err != nil {
+			return newError(KindVerification, err)
+		}
+
+		res.Method = MethodSignature
+		res.VendorKey = verifiedWith.PubKey
+	}
+
+	return nil
+}
@@ -0,0 +1,384 @@
+// SPDX-FileCopyrightText: 2025 Tillitis AB <tillitis.se>
+// SPDX-License-Identifier: BSD-2-Clause
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tillitis/tkey-verification/internal/data"
+	"github.com/tillitis/tkey-verification/internal/revocation"
+	"github.com/tillitis/tkey-verification/internal/tkey"
+	"github.com/tillitis/tkey-verification/internal/util"
+	"github.com/tillitis/tkey-verification/internal/vendorkey"
+	"github.com/tillitis/tkey-verification/internal/verification"
+)
+
+// fakeDevice is a TKey running the signer with a fixed key.
+type fakeDevice struct {
+	udi    UDI
+	priv   ed25519.PrivateKey
+	fwHash []byte
+	forge  bool // Answer challenges without the private key
+}
+
+func (d *fakeDevice) GetUDI() UDI {
+	return d.udi
+}
+
+func (d *fakeDevice) LoadSigner(_ []byte) ([]byte, error) {
+	pub, ok := d.priv.Public().(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an ed25519 key")
+	}
+
+	return pub, nil
+}
+
+func (d *fakeDevice) Challenge(pubKey []byte, n int) (Transcript, error) {
+	var transcript Transcript
+
+	for i := 0; i < max(n, 1); i++ {
+		c := tkey.ChallengeRecord{
+			Time:   time.Now(),
+			PubKey: pubKey,
+		}
+		c.Nonce[0] = byte(i)
+		c.Signature = ed25519.Sign(d.priv, c.Message())
+
+		if d.forge {
+			c.Signature[0] ^= 1
+		}
+
+		transcript = append(transcript, c)
+
+		if err := c.Verify(); err != nil {
+			return transcript, err
+		}
+	}
+
+	return transcript, nil
+}
+
+func (d *fakeDevice) GetFirmwareHash(_ int) ([]byte, error) {
+	return d.fwHash, nil
+}
+
+// bytesFetcher always returns the same verification data.
+type bytesFetcher []byte
+
+func (b bytesFetcher) Fetch(_ context.Context, _ []byte) ([]byte, string, error) {
+	return b, "test", nil
+}
+
+// setup returns a trust store with a test vendor key, a device, and
+// verification data for the device signed with the vendor key.
+func setup(t *testing.T) (TrustStore, *fakeDevice, []byte) {
+	t.Helper()
+
+	trust, err := EmbeddedTrustStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A Bellatrix with a known firmware.
+	dev := fakeDevice{
+		priv: ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)),
+	}
+
+	udiBE, _ := hex.DecodeString("0133708200000001")
+	if err = dev.udi.FromBE(udiBE); err != nil {
+		t.Fatal(err)
+	}
+
+	fw, err := trust.Firmwares.GetFirmware(dev.udi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev.fwHash = fw.Hash[:]
+
+	vendorPub, vendorPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v verification.Verification
+	for hash, bin := range trust.AppBins.Bins {
+		v.AppHash = hash
+		v.AppTag = bin.Tag
+
+		break
+	}
+
+	var vendorKey vendorkey.PubKey
+	copy(vendorKey.PubKey[:], vendorPub)
+	trust.VendorKeys.Keys = map[string]vendorkey.PubKey{"test": vendorKey}
+
+	devPub, _ := dev.LoadSigner(nil)
+	msg, err := util.BuildMessage(udiBE, fw.Hash[:], devPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v.Type = verification.VerSig
+	v.Timestamp = time.Now().UTC().Truncate(time.Second)
+	v.Signature = ed25519.Sign(vendorPriv, msg)
+
+	if err = v.SetVersion2(udiBE, trust.Firmwares); err != nil {
+		t.Fatal(err)
+	}
+
+	ver, err := v.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return trust, &dev, ver
+}
+
+func TestVerify(t *testing.T) {
+	trust, dev, ver := setup(t)
+
+	res, err := New(trust, bytesFetcher(ver)).Verify(context.Background(), dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Method != MethodSignature || res.Origin != "test" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	if len(res.Transcript) != 1 {
+		t.Fatalf("expected 1 challenge, got %d", len(res.Transcript))
+	}
+
+	if err = res.Transcript.Verify(res.PubKey); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyChallenges(t *testing.T) {
+	trust, dev, ver := setup(t)
+
+	v := New(trust, bytesFetcher(ver))
+	v.Challenges = 3
+
+	res, err := v.Verify(context.Background(), dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Transcript) != 3 {
+		t.Fatalf("expected 3 challenges, got %d", len(res.Transcript))
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	trust, dev, ver := setup(t)
+
+	tests := []struct {
+		name    string
+		modify  func(v *Verifier, d *fakeDevice)
+		kind    Kind
+		counter bool  // Expected IsCounterfeit
+		is      error // Expected error, if any
+	}{
+		{
+			name: "wrong firmware",
+			modify: func(_ *Verifier, d *fakeDevice) {
+				d.fwHash = make([]byte, 64)
+			},
+			kind:    KindVerification,
+			counter: true,
+			is:      ErrFirmwareMismatch,
+		},
+		{
+			name: "firmware size in data",
+			modify: func(v *Verifier, _ *fakeDevice) {
+				v.Fetcher = bytesFetcher(bytes.Replace(ver, []byte(`"firmware_size":`), []byte(`"firmware_size":1`), 1))
+			},
+			kind:    KindVerification,
+			counter: true,
+			is:      ErrFirmwareMismatch,
+		},
+		{
+			name: "other device key",
+			modify: func(_ *Verifier, d *fakeDevice) {
+				d.priv = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+			},
+			kind:    KindVerification,
+			counter: true,
+			is:      ErrSignatureInvalid,
+		},
+		{
+			name: "forged challenge",
+			modify: func(_ *Verifier, d *fakeDevice) {
+				d.forge = true
+			},
+			kind:    KindVerification,
+			counter: true,
+			is:      ErrChallengeFailed,
+		},
+		{
+			name: "sigsum required",
+			modify: func(v *Verifier, _ *fakeDevice) {
+				v.RequireSigsum = true
+			},
+			kind:    KindVerification,
+			counter: true,
+			is:      ErrSigsumRequired,
+		},
+		{
+			name: "bad data",
+			modify: func(v *Verifier, _ *fakeDevice) {
+				v.Fetcher = bytesFetcher("{")
+			},
+			kind: KindParse,
+		},
+		{
+			name: "no data",
+			modify: func(v *Verifier, _ *fakeDevice) {
+				v.Fetcher = DirFetcher(t.TempDir())
+			},
+			kind: KindIO,
+		},
+		{
+			name: "unknown vendor",
+			modify: func(_ *Verifier, d *fakeDevice) {
+				d.udi.VendorID = 0x4711
+			},
+			kind: KindNotFound,
+			is:   ErrUnknownVendor,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := New(trust, bytesFetcher(ver))
+			d := *dev
+			test.modify(v, &d)
+
+			_, err := v.Verify(context.Background(), &d)
+
+			var vErr *Error
+			if !errors.As(err, &vErr) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+
+			if vErr.Kind != test.kind {
+				t.Fatalf("expected %v, got %v: %v", test.kind, vErr.Kind, err)
+			}
+
+			if IsCounterfeit(err) != test.counter {
+				t.Fatalf("IsCounterfeit %v for %v", !test.counter, err)
+			}
+
+			if test.is != nil && !errors.Is(err, test.is) {
+				t.Fatalf("expected %v, got %v", test.is, err)
+			}
+		})
+	}
+}
+
+func TestNewTrustStore(t *testing.T) {
+	conf := TrustConfig{
+		Firmwares:  data.FirmwaresConf,
+		VendorKeys: data.VendorPubKeys,
+		SigsumConf: data.SigsumConf,
+		Policy:     data.PolicyStr,
+	}
+
+	if _, err := NewTrustStore(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.VendorKeys = "00 verisigner-v0.0.3 00"
+
+	_, err := NewTrustStore(conf)
+
+	var vErr *Error
+	if !errors.As(err, &vErr) || vErr.Kind != KindMissing {
+		t.Fatalf("expected KindMissing, got %v", err)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	trust, dev, ver := setup(t)
+
+	signer := fakeDevice{priv: ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))}
+
+	var trusted [ed25519.PublicKeySize]byte
+	copy(trusted[:], signer.priv.Public().(ed25519.PublicKey))
+
+	list, err := revocation.Sign(fmt.Sprintf("timestamp 2025-10-01T12:00:00Z\nrevoke %x 2025-09-01T00:00:00Z test\n",
+		trust.VendorKeys.Keys["test"].PubKey), &signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ParseRevocationList(list, nil); err == nil {
+		t.Fatal("expected error without trusted keys")
+	}
+
+	revocations, err := ParseRevocationList(list, [][ed25519.PublicKeySize]byte{trusted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trust.Revoke(revocations)
+
+	_, err = New(trust, bytesFetcher(ver)).Verify(context.Background(), dev)
+	if !IsCounterfeit(err) || !errors.Is(err, ErrKeyRevoked) {
+		t.Fatalf("expected revoked key, got %v", err)
+	}
+}
+
+// TestEmbeddedRevocationKeys checks that only lists signed by a key
+// set at build time, as by make REVOCATION_PUBKEYS, are accepted.
+func TestEmbeddedRevocationKeys(t *testing.T) {
+	vendor := fakeDevice{priv: ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))}
+	other := fakeDevice{priv: ed25519.NewKeyFromSeed(bytes.Repeat([]byte{3}, ed25519.SeedSize))}
+
+	embedded := data.RevocationPubKeys
+	t.Cleanup(func() { data.RevocationPubKeys = embedded })
+
+	data.RevocationPubKeys = fmt.Sprintf("%x,%x",
+		bytes.Repeat([]byte{0xaa}, ed25519.PublicKeySize), vendor.priv.Public().(ed25519.PublicKey))
+
+	trusted, err := EmbeddedRevocationKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trusted) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(trusted))
+	}
+
+	body := "timestamp 2025-10-01T12:00:00Z\n"
+
+	list, err := revocation.Sign(body, &vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ParseRevocationList(list, trusted); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err = revocation.Sign(body, &other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ParseRevocationList(list, trusted); err == nil {
+		t.Fatal("expected error for list signed by another key")
+	}
+}